@@ -0,0 +1,291 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatVersion is the bundle format written by Export.
+const FormatVersion = 1
+
+// Bundle is a portable copy of the pin registry. Directory and SSH key
+// paths are stored relative to $HOME ("~/...") or to a named root
+// ("${name}/..."), so the bundle can be re-materialised on another machine.
+type Bundle struct {
+	Version int `yaml:"version"`
+
+	// Roots lists the named roots referenced by the pins. Their paths are
+	// supplied again on import.
+	Roots []string `yaml:"roots,omitempty"`
+
+	Pins []config.Pin `yaml:"pins"`
+}
+
+// Root maps a name to a directory, e.g. work=/home/bob/src/work.
+type Root struct {
+	Name string
+	Path string
+}
+
+// ParseRoots parses "name=path" flag values. A leading ~ in path is
+// expanded, since shells do not expand it after "=".
+func ParseRoots(values []string) ([]Root, error) {
+	var roots []Root
+	for _, v := range values {
+		name, path, ok := strings.Cut(v, "=")
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid root %q (expected name=path)", v)
+		}
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("cannot expand root %q: %w", v, err)
+			}
+			path = filepath.Join(home, path[1:])
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve root %q: %w", v, err)
+		}
+		roots = append(roots, Root{Name: name, Path: abs})
+	}
+	return roots, nil
+}
+
+// PortablePath rewrites an absolute path relative to the longest matching
+// root, or to home. Paths outside both are returned unchanged and ok is
+// false.
+func PortablePath(path, home string, roots []Root) (portable string, ok bool) {
+	sorted := append([]Root(nil), roots...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i].Path) > len(sorted[j].Path) })
+	for _, r := range sorted {
+		if rel, ok := relativeTo(r.Path, path); ok {
+			return "${" + r.Name + "}" + rel, true
+		}
+	}
+	if home != "" {
+		if rel, ok := relativeTo(home, path); ok {
+			return "~" + rel, true
+		}
+	}
+	return path, false
+}
+
+// MaterializePath turns a portable path back into an absolute path.
+func MaterializePath(portable, home string, roots []Root) (string, error) {
+	switch {
+	case portable == "~" || strings.HasPrefix(portable, "~/"):
+		if home == "" {
+			return "", fmt.Errorf("cannot expand %s: home directory unknown", portable)
+		}
+		return filepath.Join(home, strings.TrimPrefix(portable, "~")), nil
+	case strings.HasPrefix(portable, "${"):
+		end := strings.Index(portable, "}")
+		if end == -1 {
+			return "", fmt.Errorf("malformed root reference in %s", portable)
+		}
+		name := portable[2:end]
+		for _, r := range roots {
+			if r.Name == name {
+				return filepath.Join(r.Path, portable[end+1:]), nil
+			}
+		}
+		return "", fmt.Errorf("%s refers to root %q; pass --root %s=<path>", portable, name, name)
+	default:
+		return portable, nil
+	}
+}
+
+// Export converts the registry into a bundle. Warnings name pins whose
+// paths could not be made portable.
+func Export(registry *config.PinRegistry, home string, roots []Root) (*Bundle, []string) {
+	b := &Bundle{Version: FormatVersion}
+	used := map[string]bool{}
+	var warnings []string
+
+	for _, pin := range registry.Pins {
+		dir, ok := PortablePath(pin.Dir, home, roots)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s is outside $HOME and all roots; kept absolute", pin.Dir))
+		}
+		pin.Dir = dir
+		if pin.SSHKey != "" {
+			pin.SSHKey, _ = PortablePath(pin.SSHKey, home, roots)
+		}
+		for _, r := range roots {
+			if strings.HasPrefix(pin.Dir, "${"+r.Name+"}") || strings.HasPrefix(pin.SSHKey, "${"+r.Name+"}") {
+				used[r.Name] = true
+			}
+		}
+		b.Pins = append(b.Pins, pin)
+	}
+	for name := range used {
+		b.Roots = append(b.Roots, name)
+	}
+	sort.Strings(b.Roots)
+	return b, warnings
+}
+
+// Materialize returns the bundle's pins with absolute paths for this machine.
+// An envrc_file that is not a direnv script inside the pin's directory is
+// refused.
+func (b *Bundle) Materialize(home string, roots []Root) ([]config.Pin, error) {
+	var pins []config.Pin
+	for _, pin := range b.Pins {
+		dir, err := MaterializePath(pin.Dir, home, roots)
+		if err != nil {
+			return nil, err
+		}
+		pin.Dir = dir
+		if pin.SSHKey != "" {
+			if pin.SSHKey, err = MaterializePath(pin.SSHKey, home, roots); err != nil {
+				return nil, err
+			}
+		}
+		if pin.EnvrcFile, err = config.NormalizeEnvrcFile(pin.EnvrcFile); err != nil {
+			return nil, fmt.Errorf("%s: %w", pin.Dir, err)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// Marshal encodes the bundle as YAML.
+func (b *Bundle) Marshal() ([]byte, error) {
+	return yaml.Marshal(b)
+}
+
+// Load reads a bundle from path.
+func Load(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bundle: %w", err)
+	}
+	var b Bundle
+	if err := yaml.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("cannot parse bundle %s: %w", path, err)
+	}
+	if b.Version > FormatVersion {
+		return nil, fmt.Errorf("bundle %s has version %d; this gh-autoprofile supports up to %d", path, b.Version, FormatVersion)
+	}
+	return &b, nil
+}
+
+// relativeTo returns path relative to base as "/rest" (or "" for base
+// itself) when path is inside base.
+func relativeTo(base, path string) (string, bool) {
+	base = filepath.Clean(base)
+	path = filepath.Clean(path)
+	if path == base {
+		return "", true
+	}
+	if strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return filepath.ToSlash(path[len(base):]), true
+	}
+	return "", false
+}
+
+// ConflictPolicy decides what happens when an imported pin targets a
+// directory that is already pinned.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the existing pin.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing pin.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictMerge keeps the existing pin's settings and fills in the
+	// fields it leaves empty from the imported pin.
+	ConflictMerge ConflictPolicy = "merge"
+)
+
+// ParseConflictPolicy validates a --conflict flag value.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictSkip, ConflictOverwrite, ConflictMerge:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid conflict policy %q (expected skip, overwrite or merge)", s)
+}
+
+// Action records what Apply did with one imported pin. Result is one of
+// "add", "overwrite", "merge", "skip" or "unchanged".
+type Action struct {
+	Pin    config.Pin
+	Result string
+}
+
+// Apply adds pins to the registry according to policy and reports the
+// outcome for each. Pin holds the resulting registry entry.
+func Apply(registry *config.PinRegistry, pins []config.Pin, policy ConflictPolicy) []Action {
+	var actions []Action
+	for _, pin := range pins {
+		existing := registry.FindPin(pin.Dir)
+		switch {
+		case existing == nil:
+			registry.AddPin(pin)
+			actions = append(actions, Action{Pin: pin, Result: "add"})
+		case policy == ConflictOverwrite:
+			registry.AddPin(pin)
+			actions = append(actions, Action{Pin: pin, Result: "overwrite"})
+		case policy == ConflictMerge:
+			merged := mergePin(*existing, pin)
+			if reflect.DeepEqual(merged, *existing) {
+				actions = append(actions, Action{Pin: merged, Result: "unchanged"})
+				continue
+			}
+			registry.AddPin(merged)
+			actions = append(actions, Action{Pin: merged, Result: "merge"})
+		default:
+			actions = append(actions, Action{Pin: *existing, Result: "skip"})
+		}
+	}
+	return actions
+}
+
+// mergePin fills the empty fields of existing from incoming. The account
+// itself is never changed by a merge.
+func mergePin(existing, incoming config.Pin) config.Pin {
+	merged := existing
+	if merged.Mode == "" {
+		merged.Mode = incoming.Mode
+	}
+	if merged.GitEmail == "" {
+		merged.GitEmail = incoming.GitEmail
+	}
+	if merged.GitName == "" {
+		merged.GitName = incoming.GitName
+	}
+	if merged.SSHKey == "" {
+		merged.SSHKey = incoming.SSHKey
+	}
+	if merged.Host == "" {
+		merged.Host = incoming.Host
+	}
+	if merged.EnvrcFile == "" {
+		merged.EnvrcFile = incoming.EnvrcFile
+	}
+	merged.Protected = merged.Protected || incoming.Protected
+	merged.Strict = merged.Strict || incoming.Strict
+	merged.Indirect = merged.Indirect || incoming.Indirect
+	for _, org := range incoming.Orgs {
+		found := false
+		for _, have := range merged.Orgs {
+			if strings.EqualFold(have, org) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Orgs = append(append([]string(nil), merged.Orgs...), org)
+		}
+	}
+	return merged
+}
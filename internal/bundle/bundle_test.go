@@ -0,0 +1,193 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func TestPortablePath(t *testing.T) {
+	roots := []Root{{Name: "src", Path: "/home/bob/src"}, {Name: "work", Path: "/home/bob/src/work"}}
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/home/bob/src/work/api", "${work}/api", true},
+		{"/home/bob/src/oss", "${src}/oss", true},
+		{"/home/bob/src", "${src}", true},
+		{"/home/bob/notes", "~/notes", true},
+		{"/home/bobby/x", "/home/bobby/x", false},
+		{"/srv/repos", "/srv/repos", false},
+	}
+	for _, tt := range tests {
+		got, ok := PortablePath(tt.path, "/home/bob", roots)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("PortablePath(%q) = %q, %v; want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMaterializePath(t *testing.T) {
+	roots := []Root{{Name: "work", Path: "/Users/alice/code/work"}}
+
+	tests := []struct {
+		portable string
+		want     string
+	}{
+		{"${work}/api", "/Users/alice/code/work/api"},
+		{"${work}", "/Users/alice/code/work"},
+		{"~/notes", "/Users/alice/notes"},
+		{"~", "/Users/alice"},
+		{"/srv/repos", "/srv/repos"},
+	}
+	for _, tt := range tests {
+		got, err := MaterializePath(tt.portable, "/Users/alice", roots)
+		if err != nil {
+			t.Fatalf("MaterializePath(%q) failed: %v", tt.portable, err)
+		}
+		if got != tt.want {
+			t.Errorf("MaterializePath(%q) = %q, want %q", tt.portable, got, tt.want)
+		}
+	}
+
+	if _, err := MaterializePath("${oss}/x", "/Users/alice", roots); err == nil {
+		t.Error("expected error for unknown root")
+	}
+}
+
+func TestExportAndLoadRoundTrip(t *testing.T) {
+	registry := &config.PinRegistry{Pins: []config.Pin{
+		{User: "bob-work", Dir: "/home/bob/src/work/api", Mode: config.ModeWrapper, SSHKey: "/home/bob/.ssh/id_work"},
+		{User: "alice", Dir: "/home/bob/personal", Mode: config.ModeExport},
+		{User: "ops", Dir: "/srv/ops"},
+	}}
+
+	b, warnings := Export(registry, "/home/bob", []Root{{Name: "work", Path: "/home/bob/src/work"}})
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning for /srv/ops, got %v", warnings)
+	}
+	if len(b.Roots) != 1 || b.Roots[0] != "work" {
+		t.Errorf("expected roots [work], got %v", b.Roots)
+	}
+	if b.Pins[0].Dir != "${work}/api" || b.Pins[0].SSHKey != "~/.ssh/id_work" {
+		t.Errorf("unexpected portable pin: %+v", b.Pins[0])
+	}
+
+	data, err := b.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "pins.bundle.yml")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("cannot write bundle: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	pins, err := loaded.Materialize("/Users/bob", []Root{{Name: "work", Path: "/Users/bob/work"}})
+	if err != nil {
+		t.Fatalf("Materialize failed: %v", err)
+	}
+	if pins[0].Dir != "/Users/bob/work/api" || pins[0].SSHKey != "/Users/bob/.ssh/id_work" {
+		t.Errorf("unexpected materialized pin: %+v", pins[0])
+	}
+	if pins[1].Dir != "/Users/bob/personal" || pins[1].Mode != config.ModeExport {
+		t.Errorf("unexpected materialized pin: %+v", pins[1])
+	}
+	if pins[2].Dir != "/srv/ops" {
+		t.Errorf("absolute path not preserved: %+v", pins[2])
+	}
+
+	if _, err := loaded.Materialize("/Users/bob", nil); err == nil {
+		t.Error("expected error when a referenced root is missing")
+	}
+}
+
+func TestMaterialize_EnvrcFile(t *testing.T) {
+	b := &Bundle{Version: FormatVersion, Pins: []config.Pin{
+		{User: "alice", Dir: "~/a", EnvrcFile: "./.envrc.local"},
+		{User: "alice", Dir: "~/b", EnvrcFile: ".envrc"},
+	}}
+	pins, err := b.Materialize("/home/bob", nil)
+	if err != nil {
+		t.Fatalf("Materialize failed: %v", err)
+	}
+	if pins[0].EnvrcFile != ".envrc.local" || pins[1].EnvrcFile != "" {
+		t.Errorf("envrc files not normalized: %q, %q", pins[0].EnvrcFile, pins[1].EnvrcFile)
+	}
+
+	b.Pins = append(b.Pins, config.Pin{User: "alice", Dir: "~/c", EnvrcFile: "../../.bashrc"})
+	if _, err := b.Materialize("/home/bob", nil); err == nil {
+		t.Error("expected an envrc_file outside the directory to be refused")
+	}
+}
+
+func TestApply(t *testing.T) {
+	newRegistry := func() *config.PinRegistry {
+		return &config.PinRegistry{Pins: []config.Pin{
+			{User: "bob-work", Dir: "/work", GitEmail: "bob@company.com", Orgs: []string{"acme"}},
+		}}
+	}
+	incoming := []config.Pin{
+		{User: "bob-other", Dir: "/work", GitEmail: "other@company.com", GitName: "Bob", Orgs: []string{"ACME", "acme-labs"}},
+		{User: "alice", Dir: "/home"},
+	}
+
+	reg := newRegistry()
+	actions := Apply(reg, incoming, ConflictSkip)
+	if actions[0].Result != "skip" || actions[1].Result != "add" {
+		t.Errorf("skip: unexpected actions %+v", actions)
+	}
+	if reg.FindPin("/work").User != "bob-work" || len(reg.Pins) != 2 {
+		t.Errorf("skip: registry changed unexpectedly: %+v", reg.Pins)
+	}
+
+	reg = newRegistry()
+	actions = Apply(reg, incoming, ConflictOverwrite)
+	if actions[0].Result != "overwrite" || reg.FindPin("/work").User != "bob-other" {
+		t.Errorf("overwrite: unexpected result %+v", reg.Pins)
+	}
+
+	reg = newRegistry()
+	actions = Apply(reg, incoming, ConflictMerge)
+	merged := reg.FindPin("/work")
+	if actions[0].Result != "merge" || merged.User != "bob-work" || merged.GitEmail != "bob@company.com" || merged.GitName != "Bob" {
+		t.Errorf("merge: unexpected pin %+v", *merged)
+	}
+	if len(merged.Orgs) != 2 || merged.Orgs[1] != "acme-labs" {
+		t.Errorf("merge: expected orgs [acme acme-labs], got %v", merged.Orgs)
+	}
+
+	actions = Apply(reg, incoming[:1], ConflictMerge)
+	if actions[0].Result != "unchanged" {
+		t.Errorf("merge twice: expected unchanged, got %s", actions[0].Result)
+	}
+
+	if _, err := ParseConflictPolicy("replace"); err == nil {
+		t.Error("expected error for invalid conflict policy")
+	}
+}
+
+func TestParseRoots(t *testing.T) {
+	t.Setenv("HOME", "/home/bob")
+
+	roots, err := ParseRoots([]string{"work=~/src/work", "ops=/srv/ops"})
+	if err != nil {
+		t.Fatalf("ParseRoots failed: %v", err)
+	}
+	if roots[0].Name != "work" || roots[0].Path != "/home/bob/src/work" || roots[1].Path != "/srv/ops" {
+		t.Errorf("unexpected roots: %+v", roots)
+	}
+
+	for _, bad := range []string{"work", "=/srv", "work="} {
+		if _, err := ParseRoots([]string{bad}); err == nil {
+			t.Errorf("ParseRoots(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// checkBackendInstalled returns an error when what setup installs for the
+// registry's activation backend is missing.
+func checkBackendInstalled() error {
+	registry, err := config.LoadPins()
+	if err == nil && registry.Native() {
+		if !direnvlib.NativeHookInstalled() || !direnvlib.CheckShellHookInstalled() {
+			return fmt.Errorf("native shell hook not installed. Run first: gh autoprofile setup --backend native")
+		}
+		return nil
+	}
+	if !direnvlib.IsShellLibInstalled() {
+		return fmt.Errorf("direnv shell library not installed. Run first: gh autoprofile setup")
+	}
+	return nil
+}
+
+// switchBackend records backend in pins.yml and converts the pins'
+// files: leaving direnv removes every managed .envrc block, returning to
+// it writes them again, each through guardGitEnvrc with ifTracked. The
+// change is recorded in the history. It returns the number of pins whose
+// files were converted.
+func switchBackend(backend config.Backend, ifTracked string) (int, error) {
+	unlock, err := config.LockPins()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return 0, fmt.Errorf("cannot load pin registry: %w", err)
+	}
+	change, ok, err := backendChange(registry, backend, ifTracked)
+	if !ok || err != nil {
+		return 0, err
+	}
+	if err := commitPins("setup --backend "+string(backend), registry, change); err != nil {
+		return 0, err
+	}
+	allowPins(registry, change.written)
+	return len(change.written) + len(change.removed), nil
+}
+
+// previewBackend records in p what switchBackend would change, applying
+// the switch to registry in memory.
+func previewBackend(p *plan.Plan, registry *config.PinRegistry, backend config.Backend, ifTracked string) (int, error) {
+	change, ok, err := backendChange(registry, backend, ifTracked)
+	if !ok || err != nil {
+		return 0, err
+	}
+	return len(change.written) + len(change.removed), planPins(p, registry, change)
+}
+
+// backendChange sets backend in registry and returns the block changes it
+// needs. Pins whose block is written go through guardGitEnvrc, which may
+// move the block to another file; a pin it rejects fails the switch. ok
+// is false when the registry already uses backend. Pins of missing
+// directories are left alone.
+func backendChange(registry *config.PinRegistry, backend config.Backend, ifTracked string) (change pinChange, ok bool, err error) {
+	if registry.EffectiveBackend() == backend {
+		return change, false, nil
+	}
+	registry.Backend = backend
+	if backend == config.BackendDirenv {
+		registry.Backend = ""
+	}
+
+	var pins []config.Pin
+	for _, pin := range registry.Pins {
+		if _, err := os.Stat(pin.Dir); err == nil {
+			pins = append(pins, pin)
+		}
+	}
+	if backend == config.BackendNative {
+		return pinChange{removed: pins}, true, nil
+	}
+	for _, pin := range pins {
+		guarded, excluded, err := guardGitEnvrc(pin, ifTracked)
+		if err != nil {
+			return change, true, err
+		}
+		registry.AddPin(guarded)
+		change.written = append(change.written, guarded)
+		change.excluded = append(change.excluded, excluded...)
+	}
+	return change, true, nil
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+	"github.com/mdiloreto/gh-autoprofile/internal/history"
+	"github.com/mdiloreto/gh-autoprofile/internal/importer"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// pinChange is a set of registry-backed file changes: the managed blocks
+// of removed pins are dropped, those of written pins are placed,
+// superseded lines of hand-written files are commented out and the
+// excluded files are added to their repository's info/exclude.
+type pinChange struct {
+	written, removed []config.Pin
+	superseded       []importer.Candidate
+	excluded         []string
+}
+
+// commitPins applies change and then saves the registry. If any step
+// fails, every file touched so far is restored and the registry is left as
+// it was on disk. A successful change is recorded in the history as
+// command. With the native backend no blocks are written; removals and
+// superseded lines still apply.
+func commitPins(command string, registry *config.PinRegistry, change pinChange) error {
+	rec, err := history.Begin(command)
+	if err != nil {
+		return err
+	}
+	var snap direnvlib.Snapshot
+	if err := applyPins(&snap, rec, registry, change); err != nil {
+		return rollbackPins(&snap, err)
+	}
+	commitHistory(rec)
+	return nil
+}
+
+// applyPins performs change and saves the registry, capturing each file
+// in snap and rec before it is changed.
+func applyPins(snap *direnvlib.Snapshot, rec *history.Recorder, registry *config.PinRegistry, change pinChange) error {
+	if registry.Native() {
+		change.written = nil
+	}
+	for _, c := range change.superseded {
+		if len(c.Superseded) == 0 {
+			continue
+		}
+		if err := snap.CaptureFile(c.Origin); err != nil {
+			return err
+		}
+		if err := rec.Capture(c.Origin); err != nil {
+			return err
+		}
+		if err := importer.DisableLines(plan.Disk, c.Origin, c.Superseded); err != nil {
+			return fmt.Errorf("cannot disable superseded lines in %s: %w", c.Origin, err)
+		}
+	}
+	// Removals go before writes so a pin re-written with another target
+	// file drops its old block before the new one is placed.
+	for _, pin := range change.removed {
+		if _, err := os.Stat(pin.Dir); err != nil {
+			continue
+		}
+		if err := capturePin(snap, rec, pin); err != nil {
+			return err
+		}
+		if err := direnvlib.RemoveEnvrc(pin, registry.PermissionPolicy()); err != nil {
+			return fmt.Errorf("cannot clean .envrc in %s: %w", pin.Dir, err)
+		}
+	}
+	for _, pin := range change.written {
+		if err := capturePin(snap, rec, pin); err != nil {
+			return err
+		}
+		if err := direnvlib.WriteEnvrc(pin, registry.PermissionPolicy()); err != nil {
+			return fmt.Errorf("cannot write .envrc in %s: %w", pin.Dir, err)
+		}
+	}
+
+	if err := captureExcludes(snap, rec, change.excluded); err != nil {
+		return err
+	}
+	for _, path := range change.excluded {
+		if err := excludeFromGit(plan.Disk, path); err != nil {
+			return err
+		}
+	}
+
+	if err := config.SavePins(registry); err != nil {
+		return fmt.Errorf("cannot save pin registry: %w", err)
+	}
+	return nil
+}
+
+// rollbackPins restores the files in snap after cause stopped a change.
+func rollbackPins(snap *direnvlib.Snapshot, cause error) error {
+	if err := snap.Restore(); err != nil {
+		return fmt.Errorf("%w (rollback of .envrc files failed: %v)", cause, err)
+	}
+	return fmt.Errorf("%w; no changes were made", cause)
+}
+
+func capturePin(snap *direnvlib.Snapshot, rec *history.Recorder, pin config.Pin) error {
+	if err := snap.CapturePin(pin); err != nil {
+		return err
+	}
+	return rec.CapturePin(pin)
+}
+
+// previewPins prints, as a dry run, the diff commitPins and allowPins
+// would apply for the same change, after the changes already in p.
+func previewPins(p *plan.Plan, registry *config.PinRegistry, change pinChange) error {
+	if err := planPins(p, registry, change); err != nil {
+		return err
+	}
+	fmt.Println("\nDry run: nothing was written. Planned changes:")
+	fmt.Println()
+	p.Print(os.Stdout)
+	return nil
+}
+
+// planPins records in p what commitPins and allowPins would do for change.
+func planPins(p *plan.Plan, registry *config.PinRegistry, change pinChange) error {
+	if registry.Native() {
+		change.written = nil
+	}
+	for _, c := range change.superseded {
+		if err := importer.DisableLines(p, c.Origin, c.Superseded); err != nil {
+			return fmt.Errorf("cannot plan %s: %w", c.Origin, err)
+		}
+	}
+	for _, pin := range change.removed {
+		if _, err := os.Stat(pin.Dir); err != nil {
+			continue
+		}
+		if err := direnvlib.RemoveEnvrcWith(p, pin, registry.PermissionPolicy()); err != nil {
+			return fmt.Errorf("cannot plan .envrc in %s: %w", pin.Dir, err)
+		}
+	}
+	for _, pin := range change.written {
+		if err := direnvlib.WriteEnvrcWith(p, pin, registry.PermissionPolicy()); err != nil {
+			return fmt.Errorf("cannot plan .envrc in %s: %w", pin.Dir, err)
+		}
+	}
+	for _, path := range change.excluded {
+		if err := excludeFromGit(p, path); err != nil {
+			return err
+		}
+	}
+	if err := planPinsFile(p, registry); err != nil {
+		return err
+	}
+	if direnvlib.IsInstalled() {
+		for _, pin := range change.written {
+			_ = direnvlib.AllowEnvrcWith(p, pin.Dir)
+		}
+	}
+	return nil
+}
+
+// planPinsFile records in p the pins.yml SavePins would write.
+func planPinsFile(p *plan.Plan, registry *config.PinRegistry) error {
+	path, err := config.PinsFilePath()
+	if err != nil {
+		return err
+	}
+	data, err := config.MarshalPins(registry)
+	if err != nil {
+		return err
+	}
+	return p.WriteFile(path, data, 0600)
+}
+
+// allowPins runs direnv allow for each pin, warning on failures. The
+// native backend has nothing to allow.
+func allowPins(registry *config.PinRegistry, pins []config.Pin) {
+	if registry.Native() || !direnvlib.IsInstalled() {
+		return
+	}
+	for _, pin := range pins {
+		if err := direnvlib.AllowEnvrc(pin.Dir); err != nil {
+			fmt.Printf("Warning: could not auto-allow %s/.envrc: %v\n", pin.Dir, err)
+		}
+	}
+}
+
+// bulkReport collects per-directory outcomes of a multi-directory command.
+type bulkReport struct {
+	done, skipped int
+}
+
+func (r *bulkReport) ok(label, dir, detail string) {
+	r.done++
+	fmt.Printf("%-7s %s%s\n", label, dir, detail)
+}
+
+func (r *bulkReport) skip(dir string, reason error) {
+	r.skipped++
+	fmt.Printf("%-7s %s: %v\n", "SKIP", dir, reason)
+}
+
+// print summarizes the run. It returns an error when any directory was
+// skipped or none was changed, so scripts see the command fail.
+func (r *bulkReport) print(verb string) error {
+	fmt.Printf("\n%s %d director%s, skipped %d.\n", verb, r.done, plural(r.done, "y", "ies"), r.skipped)
+	switch {
+	case r.skipped > 0:
+		return fmt.Errorf("skipped %d director%s", r.skipped, plural(r.skipped, "y", "ies"))
+	case r.done == 0:
+		return fmt.Errorf("no directories matched")
+	}
+	return nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// readDirList reads newline-delimited directories from path ("-" for
+// stdin), ignoring blank lines and # comments.
+func readDirList(path string) ([]string, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, fmt.Errorf("cannot read directory list: %w", err)
+		}
+		defer f.Close()
+	}
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dirs = append(dirs, fsutil.ExpandHome(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read directory list: %w", err)
+	}
+	return dirs, nil
+}
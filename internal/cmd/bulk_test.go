@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/importer"
+)
+
+func TestCommitPins_UsesRegistryPermissionPolicy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("PATH", t.TempDir()) // no direnv
+	if err := config.SavePins(&config.PinRegistry{EnvrcPermissions: config.PermPreserve}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	envrc := filepath.Join(dir, ".envrc")
+	if err := os.WriteFile(envrc, []byte("export A=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(envrc, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy changed in memory wins over the one still on disk.
+	registry := &config.PinRegistry{EnvrcPermissions: config.PermStrict}
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeWrapper}
+	registry.Pins = append(registry.Pins, pin)
+	if err := commitPins("pin", registry, pinChange{written: []config.Pin{pin}}); err != nil {
+		t.Fatalf("commitPins: %v", err)
+	}
+	fi, err := os.Stat(envrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected .envrc 0600 under the strict policy, got %04o", fi.Mode().Perm())
+	}
+}
+
+func TestCommitPins_RollsBackSupersededLines(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("PATH", t.TempDir()) // no direnv
+
+	good := t.TempDir()
+	origin := filepath.Join(good, ".envrc")
+	const handWritten = "export GH_TOKEN=$(gh auth token --user alice)\n"
+	if err := os.WriteFile(origin, []byte(handWritten), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A directory where the .envrc should be makes the second write fail.
+	bad := t.TempDir()
+	if err := os.Mkdir(filepath.Join(bad, ".envrc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := &config.PinRegistry{}
+	first := config.Pin{User: "alice", Dir: good}
+	second := config.Pin{User: "alice", Dir: bad}
+	registry.AddPin(first)
+	registry.AddPin(second)
+	change := pinChange{
+		written:    []config.Pin{first, second},
+		superseded: []importer.Candidate{{Pin: first, Origin: origin, Superseded: []int{1}}},
+	}
+	if err := commitPins("import", registry, change); err == nil {
+		t.Fatal("expected commitPins to fail")
+	}
+
+	data, err := os.ReadFile(origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != handWritten {
+		t.Errorf("expected %s restored, got:\n%s", origin, data)
+	}
+	loaded, err := config.LoadPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Pins) != 0 {
+		t.Errorf("expected no pins saved, got %+v", loaded.Pins)
+	}
+}
+
+func TestEdit_GuardsTrackedEnvrc(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	t.Setenv("PATH", filepath.Dir(mustLookPath(t, "git"))) // git, but no direnv
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeWrapper}
+	if err := config.SavePins(&config.PinRegistry{Pins: []config.Pin{pin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// stdin is not a terminal: the default "ask" refuses.
+	cmd := NewEditCmd()
+	cmd.SilenceUsage, cmd.SilenceErrors = true, true
+	cmd.SetArgs([]string{dir, "--git-email", "a@example.com"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected edit to refuse an untracked, unignored .envrc")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".envrc")); !os.IsNotExist(err) {
+		t.Errorf("refused edit wrote .envrc: %v", err)
+	}
+
+	cmd = NewEditCmd()
+	cmd.SetArgs([]string{dir, "--git-email", "a@example.com", "--if-tracked", "local"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("edit --if-tracked local: %v", err)
+	}
+	loaded, err := config.LoadPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.FindPin(dir); got == nil || got.EnvrcFile != localEnvrcFile {
+		t.Fatalf("expected the pin moved to %s, got %+v", localEnvrcFile, got)
+	}
+	exclude, err := os.ReadFile(filepath.Join(dir, ".git", "info", "exclude"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(exclude), "/"+localEnvrcFile+"\n") {
+		t.Errorf("expected %s excluded, got:\n%s", localEnvrcFile, exclude)
+	}
+}
+
+func TestCommitPins_RollsBackExcludes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	t.Setenv("PATH", filepath.Dir(mustLookPath(t, "git")))
+	excludePath := filepath.Join(dir, ".git", "info", "exclude")
+	before, err := os.ReadFile(excludePath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	// pins.yml cannot be saved over a directory, after the exclude was added.
+	pinsPath, err := config.PinsFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(pinsPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := &config.PinRegistry{}
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeWrapper}
+	registry.AddPin(pin)
+	change := pinChange{written: []config.Pin{pin}, excluded: []string{filepath.Join(dir, ".envrc")}}
+	if err := commitPins("pin", registry, change); err == nil {
+		t.Fatal("expected commitPins to fail")
+	}
+	after, err := os.ReadFile(excludePath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("info/exclude not restored:\n%s", after)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".envrc")); !os.IsNotExist(err) {
+		t.Errorf(".envrc not removed on rollback: %v", err)
+	}
+}
+
+func mustLookPath(t *testing.T, name string) string {
+	t.Helper()
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/spf13/cobra"
+)
+
+// tokenExpiryWarning is how close to its expiry a token is reported.
+const tokenExpiryWarning = 7 * 24 * time.Hour
+
+// NewCheckCmd creates the `check` subcommand.
+func NewCheckCmd() *cobra.Command {
+	var apiURL, hostname string
+	var scopes []string
+
+	cmd := &cobra.Command{
+		Use:   "check [user]",
+		Short: "Check the tokens of pinned accounts against the GitHub API",
+		Long: `Call GET /user with each pinned account's token and report what the
+response headers reveal: the OAuth scopes granted, when the token
+expires, SAML SSO state and the remaining rate limit. Each pin's
+required scopes are compared with the granted ones: repo always, plus
+read:org for pins with --org, plus any --scope. Organisations listed in
+pins are queried too, to find tokens their SSO has not authorised.
+
+Without an argument every pinned account is checked; with one, only that
+account, even if it has no pin. --hostname limits the check to one
+host. Tokens are fetched for each account's host, and the API root
+follows the host; --api-url overrides it when every checked account is
+on the same host. Fine-grained and app tokens do not report scopes, so
+only their other checks apply. The command exits non-zero when a
+problem is found.
+
+Examples:
+  gh autoprofile check
+  gh autoprofile check bob-work --scope workflow
+  gh autoprofile check carol --hostname ghe.example.com
+  gh autoprofile check --hostname ghe.example.com --api-url https://ghe.example.com/api/v3`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+			user := ""
+			if len(args) == 1 {
+				user = args[0]
+			}
+			targets := checkTargets(registry, user, hostname)
+			if len(targets) == 0 {
+				fmt.Println("No pinned accounts to check.")
+				return nil
+			}
+			if apiURL != "" {
+				if hosts := targetHosts(targets); len(hosts) > 1 {
+					return fmt.Errorf("--api-url applies to a single host, but the accounts to check are on %s; select one with --hostname", strings.Join(hosts, ", "))
+				}
+			}
+
+			problems := 0
+			for i, t := range targets {
+				if i > 0 {
+					fmt.Println()
+				}
+				base := apiURL
+				if base == "" {
+					base = ghauth.APIBase(t.host)
+				}
+				problems += checkAccount(t, base, scopes)
+			}
+			if problems > 0 {
+				return fmt.Errorf("%d problem(s) found", problems)
+			}
+			fmt.Println("\nAll tokens passed.")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&apiURL, "api-url", "", "GitHub REST API root, when all checked accounts share one host (default: derived from the host)")
+	cmd.Flags().StringVar(&hostname, "hostname", "", "Only check accounts on this host (default for an account without pins: github.com)")
+	cmd.Flags().StringSliceVar(&scopes, "scope", nil, "Additional scope every checked pin requires (repeatable)")
+	return cmd
+}
+
+// checkTarget is an account to check and the pins that use it.
+type checkTarget struct {
+	user, host string
+	pins       []config.Pin
+}
+
+// checkTargets groups the pins by account, in pin order. A named user
+// without pins is checked on hostname.
+func checkTargets(registry *config.PinRegistry, user, hostname string) []checkTarget {
+	var targets []checkTarget
+	index := map[string]int{}
+	for _, pin := range registry.Pins {
+		if user != "" && !strings.EqualFold(pin.User, user) {
+			continue
+		}
+		if hostname != "" && !strings.EqualFold(pin.EffectiveHost(), hostname) {
+			continue
+		}
+		key := pin.User + "@" + pin.EffectiveHost()
+		i, ok := index[key]
+		if !ok {
+			i = len(targets)
+			index[key] = i
+			targets = append(targets, checkTarget{user: pin.User, host: pin.EffectiveHost()})
+		}
+		targets[i].pins = append(targets[i].pins, pin)
+	}
+	if user != "" && len(targets) == 0 {
+		if hostname == "" {
+			hostname = config.DefaultHost
+		}
+		targets = append(targets, checkTarget{user: user, host: hostname})
+	}
+	return targets
+}
+
+// targetHosts returns the distinct hosts of targets, in order.
+func targetHosts(targets []checkTarget) []string {
+	var hosts []string
+	for _, t := range targets {
+		if !slices.Contains(hosts, t.host) {
+			hosts = append(hosts, t.host)
+		}
+	}
+	return hosts
+}
+
+// checkAccount prints the health of one account's token and returns the
+// number of problems found.
+func checkAccount(t checkTarget, base string, extraScopes []string) int {
+	fmt.Printf("%s (%s)\n", t.user, t.host)
+	token, err := ghauth.GetTokenForHost(t.user, t.host)
+	if err != nil {
+		fmt.Printf("  WARN %v\n", err)
+		return 1
+	}
+	checker := &ghauth.Checker{Base: base, Token: token}
+	health, err := checker.CheckToken()
+	if err != nil {
+		fmt.Printf("  WARN token rejected: %v\n", err)
+		return 1
+	}
+
+	problems := 0
+	warn := func(format string, a ...any) {
+		fmt.Printf("  WARN "+format+"\n", a...)
+		problems++
+	}
+	ok := func(format string, a ...any) {
+		fmt.Printf("  OK   "+format+"\n", a...)
+	}
+
+	if strings.EqualFold(health.Login, t.user) {
+		ok("token valid for %s", health.Login)
+	} else {
+		warn("token authenticates as %s, not %s", health.Login, t.user)
+	}
+
+	switch {
+	case health.Expires.IsZero():
+		ok("token does not expire")
+	case time.Until(health.Expires) <= 0:
+		warn("token expired on %s", health.Expires.Format("2006-01-02"))
+	case time.Until(health.Expires) < tokenExpiryWarning:
+		warn("token expires on %s (fix: gh auth login -h %s)", health.Expires.Format("2006-01-02 15:04 MST"), t.host)
+	default:
+		ok("token expires on %s", health.Expires.Format("2006-01-02"))
+	}
+
+	if health.RateLimit > 0 {
+		if health.RateRemaining == 0 {
+			warn("rate limit exhausted (%d requests) until %s", health.RateLimit, health.RateReset.Format("15:04"))
+		} else {
+			ok("rate limit: %d/%d remaining", health.RateRemaining, health.RateLimit)
+		}
+	}
+
+	if !health.ScopesKnown {
+		fmt.Println("       scopes not reported (fine-grained or app token)")
+	} else {
+		granted := strings.Join(health.Scopes, ", ")
+		if granted == "" {
+			granted = "(none)"
+		}
+		fmt.Printf("       scopes granted: %s\n", granted)
+		pins := t.pins
+		if len(pins) == 0 {
+			pins = []config.Pin{{User: t.user}}
+		}
+		for _, pin := range pins {
+			label := pin.Dir
+			if label == "" {
+				label = "account"
+			}
+			required := requiredScopes(pin, extraScopes)
+			missing := ghauth.MissingScopes(health.Scopes, required)
+			if len(missing) == 0 {
+				ok("%s: requires %s", label, strings.Join(required, ", "))
+				continue
+			}
+			warn("%s: requires %s; missing %s\n"+
+				"       fix: gh auth switch -h %s -u %s && gh auth refresh -h %s -s %s",
+				label, strings.Join(required, ", "), strings.Join(missing, ", "),
+				t.host, t.user, t.host, strings.Join(missing, ","))
+		}
+	}
+	if health.SSO != "" {
+		fmt.Printf("       SSO: %s\n", health.SSO)
+	}
+
+	seen := map[string]bool{}
+	for _, pin := range t.pins {
+		for _, org := range pin.Orgs {
+			if seen[strings.ToLower(org)] {
+				continue
+			}
+			seen[strings.ToLower(org)] = true
+			access, err := checker.CheckOrg(org)
+			switch {
+			case err != nil:
+				warn("org %s: %v", org, err)
+			case access.SSORequired():
+				if u := access.SSOURL(); u != "" {
+					warn("org %s: token not authorised for SAML SSO; authorise it at %s", org, u)
+				} else {
+					warn("org %s: token not authorised for SAML SSO", org)
+				}
+			case access.Status != http.StatusOK:
+				warn("org %s: not accessible with this token (HTTP %d)", org, access.Status)
+			default:
+				ok("org %s: token accepted", org)
+			}
+		}
+	}
+	return problems
+}
+
+// requiredScopes lists the OAuth scopes a pin needs: repo to push over
+// HTTPS, read:org to see the organisations it is limited to, and extra.
+func requiredScopes(pin config.Pin, extra []string) []string {
+	required := []string{"repo"}
+	if len(pin.Orgs) > 0 {
+		required = append(required, "read:org")
+	}
+	for _, s := range extra {
+		if !slices.Contains(required, s) {
+			required = append(required, s)
+		}
+	}
+	return required
+}
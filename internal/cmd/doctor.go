@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
 	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/migrate"
 	"github.com/spf13/cobra"
 )
 
@@ -15,10 +17,21 @@ func NewDoctorCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "doctor",
 		Short: "Check setup and migration health",
-		Long:  "Validate shell integration, pin schema, and managed .envrc permissions.",
-		RunE:  runDoctor,
+		Long: `Validate shell integration, the pins.yml schema version, and every
+migration step's checks (pin modes, file permissions, managed .envrc
+blocks).
+
+Pins whose directory was moved or renamed are detected by searching the
+parents of the missing directories, plus the roots listed under "roots:"
+in pins.yml and given with --root, for managed .envrc blocks the registry
+does not know. --fix re-points such pins when the block's account and
+email identify a single stale pin. Blocks it rewrites to a file git could
+commit follow --if-tracked, as with pin.`,
+		RunE: runDoctor,
 	}
-	cmd.Flags().Bool("fix", false, "Run setup migration automatically")
+	cmd.Flags().Bool("fix", false, "Re-point moved pins, then run setup migration")
+	cmd.Flags().StringSlice("root", nil, "Additional directory to search for moved pins (repeatable)")
+	cmd.Flags().String("if-tracked", ifTrackedAsk, ifTrackedUsage)
 	return cmd
 }
 
@@ -27,11 +40,25 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	roots, err := cmd.Flags().GetStringSlice("root")
+	if err != nil {
+		return err
+	}
+	ifTracked, err := cmd.Flags().GetString("if-tracked")
+	if err != nil {
+		return err
+	}
 	if fix {
+		if err := repairMovedPins(roots, ifTracked); err != nil {
+			return err
+		}
 		setupCmd := NewSetupCmd()
 		if err := setupCmd.Flags().Set("migrate", "true"); err != nil {
 			return err
 		}
+		if err := setupCmd.Flags().Set("if-tracked", ifTracked); err != nil {
+			return err
+		}
 		return runSetup(setupCmd, args)
 	}
 
@@ -39,9 +66,24 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 	fmt.Println("gh-autoprofile doctor")
 	fmt.Println("=====================")
 
-	if direnvlib.IsShellLibInstalled() {
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pins: %w", err)
+	}
+
+	if _, err := config.ParseBackend(string(registry.Backend)); err != nil {
+		fmt.Printf("WARN pins.yml: %v; using direnv\n", err)
+		issues++
+	}
+	switch {
+	case registry.Native() && direnvlib.NativeHookInstalled():
+		fmt.Println("OK   native backend hook installed")
+	case registry.Native():
+		fmt.Println("WARN native backend hook missing (run gh autoprofile setup --backend native)")
+		issues++
+	case direnvlib.IsShellLibInstalled():
 		fmt.Println("OK   direnv library installed")
-	} else {
+	default:
 		fmt.Println("WARN direnv library missing")
 		issues++
 	}
@@ -53,36 +95,136 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 		issues++
 	}
 
-	registry, err := config.LoadPins()
-	if err != nil {
-		return fmt.Errorf("cannot load pins: %w", err)
+	rcProblems := 0
+	for _, rc := range direnvlib.ShellRCFiles() {
+		problems, err := direnvlib.CheckHookSource(rc)
+		if err != nil {
+			continue
+		}
+		for _, p := range problems {
+			if rcProblems == 0 {
+				fmt.Println("WARN malformed hook block in shell RC (repaired by --fix):")
+			}
+			fmt.Printf("     %s %v\n", rc, p)
+			rcProblems++
+		}
+	}
+	if rcProblems == 0 {
+		fmt.Println("OK   shell RC hook blocks well-formed")
+	} else {
+		issues++
 	}
 
-	missingModes := 0
-	envrcPermIssues := 0
+	var policyViolations []error
 	for _, pin := range registry.Pins {
-		if pin.Mode == "" {
-			missingModes++
-		}
-		envrcPath := filepath.Join(pin.Dir, ".envrc")
-		if fi, err := os.Stat(envrcPath); err == nil {
-			if fi.Mode().Perm() != 0600 {
-				envrcPermIssues++
+		if p := policyForDir(pin.Dir); p != nil {
+			if err := policyError(p, &pin); err != nil {
+				policyViolations = append(policyViolations, err)
 			}
 		}
 	}
 
-	if missingModes == 0 {
-		fmt.Println("OK   pin modes normalized")
+	stale, moves, err := findMovedPins(registry, roots)
+	if err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		fmt.Println("OK   pinned directories exist")
 	} else {
-		fmt.Printf("WARN %d pin(s) missing mode (will default to wrapper)\n", missingModes)
+		fmt.Printf("WARN %d pin(s) point at missing directories\n", len(stale))
+		for _, m := range moves.Moves {
+			fmt.Printf("     %s moved to %s (fixable)\n", m.From.Dir, m.To)
+		}
+		for _, pin := range moves.Ambiguous {
+			fmt.Printf("     %s matches several stale pins (use gh autoprofile mv)\n", pin.Dir)
+		}
+		for _, pin := range unmatchedIndirect(stale, moves) {
+			fmt.Printf("     %s holds an indirect block no stale pin matches (use gh autoprofile mv)\n", pin.Dir)
+		}
+		issues++
+	}
+
+	if registry.Version >= migrate.Latest() {
+		fmt.Printf("OK   pins.yml schema v%d\n", registry.Version)
+	} else {
+		fmt.Printf("WARN pins.yml schema v%d, current is v%d\n", registry.Version, migrate.Latest())
+		issues++
+	}
+
+	if _, err := config.ParsePermissionPolicy(string(registry.EnvrcPermissions)); err != nil {
+		fmt.Printf("WARN %v; using strict\n", err)
+		issues++
+	} else {
+		fmt.Printf("OK   .envrc permission policy: %s\n", registry.PermissionPolicy())
+	}
+
+	for _, st := range migrate.Check(registry) {
+		if len(st.Findings) == 0 {
+			fmt.Printf("OK   %s\n", st.Step.Healthy)
+			continue
+		}
+		fmt.Printf("WARN %s: %d issue(s)\n", st.Step.Name, len(st.Findings))
+		for _, f := range st.Findings {
+			fmt.Printf("     %s\n", f)
+		}
+		issues++
+	}
+
+	if len(policyViolations) == 0 {
+		fmt.Println("OK   pins satisfy repository policies")
+	} else {
+		for _, err := range policyViolations {
+			fmt.Printf("WARN %s\n", strings.ReplaceAll(err.Error(), "\n", "\n     "))
+		}
 		issues++
 	}
 
-	if envrcPermIssues == 0 {
-		fmt.Println("OK   managed .envrc permissions are 0600")
+	if _, err := config.NormalizeEnvrcFile(registry.EnvrcFile); err != nil {
+		fmt.Printf("WARN pins.yml envrc_file: %v\n", err)
+		issues++
+	}
+	// The native backend writes no .envrc files, so neither check below
+	// applies to it.
+	envrcPins := registry.Pins
+	if registry.Native() {
+		envrcPins = nil
+	}
+	var unloaded []string
+	for _, pin := range envrcPins {
+		name := pin.EnvrcName()
+		if name == config.DefaultEnvrcFile {
+			continue
+		}
+		if _, err := os.Stat(pin.Dir); err != nil {
+			continue
+		}
+		if ok, err := direnvlib.Loads(pin.Dir, name); err != nil || !ok {
+			unloaded = append(unloaded, fmt.Sprintf("%s is not loaded by %s/.envrc", filepath.Join(pin.Dir, name), pin.Dir))
+		}
+	}
+	if len(unloaded) == 0 {
+		fmt.Println("OK   pin envrc files loaded by .envrc")
 	} else {
-		fmt.Printf("WARN %d managed .envrc file(s) not 0600\n", envrcPermIssues)
+		fmt.Printf("WARN %d pin(s) write to files direnv never loads (fixable)\n", len(unloaded))
+		for _, u := range unloaded {
+			fmt.Printf("     %s\n", u)
+		}
+		issues++
+	}
+
+	var exposed []string
+	for _, pin := range envrcPins {
+		if path, state := direnvlib.GitExposure(pin); state.Committable() {
+			exposed = append(exposed, fmt.Sprintf("%s is %s (fix: gh autoprofile edit %s --indirect)", path, state, pin.Dir))
+		}
+	}
+	if len(exposed) == 0 {
+		fmt.Println("OK   pin settings kept out of git")
+	} else {
+		fmt.Printf("WARN %d pin(s) keep settings in files git could commit\n", len(exposed))
+		for _, e := range exposed {
+			fmt.Printf("     %s\n", e)
+		}
 		issues++
 	}
 
@@ -91,6 +233,6 @@ func runDoctor(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	fmt.Println("\nRun `gh autoprofile setup --migrate` to fix detected issues.")
+	fmt.Println("\nRun `gh autoprofile doctor --fix` to fix detected issues.")
 	return nil
 }
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/spf13/cobra"
+)
+
+// NewEditCmd creates the `edit` subcommand.
+func NewEditCmd() *cobra.Command {
+	var opts pinOptions
+	var user, mode string
+	var noGitEmail, noGitName, noSSHKey, noHost, noOrgs bool
+
+	cmd := &cobra.Command{
+		Use:   "edit [directory...]",
+		Short: "Change individual settings of existing pins",
+		Long: `Change only the settings given as flags; everything else in the pin
+is kept. The .envrc block is regenerated and re-allowed, and the changed
+fields are shown before and after. The block of an indirect pin carries
+no settings, so its .envrc is left alone: direnv reloads the pin from
+pins.yml.
+
+Use the --no-* flags to unset a field, and --protected=false,
+--strict=false or --indirect=false to turn an option off. Several
+directories can be edited at once; if writing the .envrc files or the
+registry fails, all changes are rolled back. A rewritten block whose file
+git could commit follows --if-tracked, as with pin.
+
+Examples:
+  gh autoprofile edit --ssh-key ~/.ssh/id_work
+  gh autoprofile edit ~/work --git-email bob@company.com --no-git-name
+  gh autoprofile edit ~/oss --mode export
+  gh autoprofile edit ~/work/api ~/work/web --ssh-key ~/.ssh/id_work
+  gh autoprofile edit ~/acme --org acme --org acme-labs --strict
+  gh autoprofile edit ~/oss --indirect
+  gh autoprofile edit ~/work/api --envrc-file .envrc.local`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			if flags.Changed("ssh-key") {
+				absKey, err := filepath.Abs(opts.sshKey)
+				if err != nil {
+					return fmt.Errorf("cannot resolve SSH key: %w", err)
+				}
+				if _, err := os.Stat(absKey); err != nil {
+					return fmt.Errorf("SSH key not found: %s", absKey)
+				}
+				opts.sshKey = absKey
+			}
+			if flags.Changed("mode") {
+				switch config.PinMode(mode) {
+				case config.ModeWrapper, config.ModeExport:
+				default:
+					return fmt.Errorf("invalid mode %q (expected wrapper or export)", mode)
+				}
+			}
+			if flags.Changed("user") {
+				if err := ghauth.ValidateUser(user); err != nil {
+					return err
+				}
+			}
+			if flags.Changed("envrc-file") {
+				name, err := config.NormalizeEnvrcFile(opts.envrcFile)
+				if err != nil {
+					return err
+				}
+				opts.envrcFile = name
+			}
+
+			// patch applies the given flags to one pin.
+			patch := func(after config.Pin) config.Pin {
+				if flags.Changed("user") {
+					after.User = user
+				}
+				if flags.Changed("mode") {
+					after.Mode = config.PinMode(mode)
+				}
+				if flags.Changed("git-email") {
+					after.GitEmail = opts.gitEmail
+				}
+				if noGitEmail {
+					after.GitEmail = ""
+				}
+				if flags.Changed("git-name") {
+					after.GitName = opts.gitName
+				}
+				if noGitName {
+					after.GitName = ""
+				}
+				if flags.Changed("ssh-key") {
+					after.SSHKey = opts.sshKey
+				}
+				if noSSHKey {
+					after.SSHKey = ""
+				}
+				if flags.Changed("protected") {
+					after.Protected = opts.protected
+				}
+				if flags.Changed("host") {
+					after.Host = opts.host
+					if after.Host == config.DefaultHost {
+						after.Host = ""
+					}
+				}
+				if noHost {
+					after.Host = ""
+				}
+				if flags.Changed("org") {
+					after.Orgs = opts.orgs
+				}
+				if noOrgs {
+					after.Orgs = nil
+				}
+				if flags.Changed("strict") {
+					after.Strict = opts.strict
+				}
+				if flags.Changed("indirect") {
+					after.Indirect = opts.indirect
+				}
+				if flags.Changed("envrc-file") {
+					after.EnvrcFile = opts.envrcFile
+				}
+				return after
+			}
+
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			unlock, err := config.LockPins()
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+
+			// A single directory fails outright; several are skipped
+			// individually and summarised.
+			single := len(args) == 1
+			var report bulkReport
+			skip := func(dir string, err error) error {
+				if single {
+					return err
+				}
+				report.skip(dir, err)
+				return nil
+			}
+
+			var edited []config.Pin
+			var change pinChange
+			changes := map[string][]config.FieldChange{}
+			unchanged := map[string]bool{}
+			for _, dir := range args {
+				absDir, err := filepath.Abs(dir)
+				if err != nil {
+					if err := skip(dir, fmt.Errorf("cannot resolve directory: %w", err)); err != nil {
+						return err
+					}
+					continue
+				}
+				existing := registry.FindPin(absDir)
+				if existing == nil {
+					if err := skip(absDir, fmt.Errorf("no pin found for directory: %s", absDir)); err != nil {
+						return err
+					}
+					continue
+				}
+				after := patch(*existing)
+				diff := config.DiffPins(*existing, after)
+				if len(diff) == 0 {
+					if single {
+						fmt.Printf("Nothing to change for %s.\n", absDir)
+						return nil
+					}
+					report.skip(absDir, fmt.Errorf("nothing to change"))
+					continue
+				}
+				if p := policyForDir(absDir); p != nil {
+					if err := policyError(p, &after); err != nil {
+						if err := skip(absDir, err); err != nil {
+							return err
+						}
+						continue
+					}
+				}
+				// Only blocks that change are rewritten and re-allowed; an
+				// indirect pin's block stays the same whatever is edited.
+				// The native backend has no blocks.
+				rewrite := false
+				if !registry.Native() {
+					if current, err := direnvlib.BlockCurrent(after); err != nil || !current {
+						rewrite = true
+					}
+				}
+				var excluded []string
+				if rewrite {
+					if after, excluded, err = guardGitEnvrc(after, opts.ifTracked); err != nil {
+						if err := skip(absDir, err); err != nil {
+							return err
+						}
+						continue
+					}
+					diff = config.DiffPins(*existing, after)
+				}
+				if existing.EnvrcName() != after.EnvrcName() {
+					change.removed = append(change.removed, *existing)
+				}
+				if rewrite {
+					change.written = append(change.written, after)
+					change.excluded = append(change.excluded, excluded...)
+				} else {
+					unchanged[absDir] = true
+				}
+				registry.AddPin(after)
+				edited = append(edited, after)
+				changes[absDir] = diff
+			}
+
+			if len(edited) > 0 {
+				if err := commitPins("edit", registry, change); err != nil {
+					return err
+				}
+				allowPins(registry, change.written)
+			}
+
+			if single {
+				fmt.Printf("Updated pin for %s\n", edited[0].Dir)
+				printPinChanges(changes[edited[0].Dir])
+				switch {
+				case registry.Native():
+					fmt.Println("  Shells already in the directory pick it up with: gh_autoprofile_reload")
+				case unchanged[edited[0].Dir]:
+					fmt.Println("  .envrc unchanged; direnv reloads the pin from pins.yml.")
+				}
+				return nil
+			}
+			for _, pin := range edited {
+				detail := ""
+				if unchanged[pin.Dir] {
+					detail = " (.envrc unchanged)"
+				}
+				report.ok("EDIT", pin.Dir, detail)
+				printPinChanges(changes[pin.Dir])
+			}
+			return report.print("Edited")
+		},
+	}
+
+	cmd.Flags().StringVar(&user, "user", "", "GitHub account to pin")
+	cmd.Flags().StringVar(&mode, "mode", "", "Token mode: wrapper or export")
+	cmd.Flags().StringVar(&opts.gitEmail, "git-email", "", "Git author/committer email")
+	cmd.Flags().BoolVar(&noGitEmail, "no-git-email", false, "Unset the git email")
+	cmd.Flags().StringVar(&opts.gitName, "git-name", "", "Git author/committer name")
+	cmd.Flags().BoolVar(&noGitName, "no-git-name", false, "Unset the git name")
+	cmd.Flags().StringVar(&opts.sshKey, "ssh-key", "", "Path to SSH private key")
+	cmd.Flags().BoolVar(&noSSHKey, "no-ssh-key", false, "Unset the SSH key")
+	cmd.Flags().BoolVar(&opts.protected, "protected", false, "Require confirmation before pushes and destructive gh operations")
+	cmd.Flags().StringVar(&opts.host, "host", "", "GitHub host of the account")
+	cmd.Flags().BoolVar(&noHost, "no-host", false, "Unset the host (github.com)")
+	cmd.Flags().StringSliceVar(&opts.orgs, "org", nil, "Organisations the account may push to (replaces the list)")
+	cmd.Flags().BoolVar(&noOrgs, "no-orgs", false, "Clear the organisation list")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "Refuse pushes to remotes whose owner does not match the account or its orgs")
+	cmd.Flags().BoolVar(&opts.indirect, "indirect", false, "Keep settings out of .envrc and resolve them from pins.yml")
+	cmd.Flags().StringVar(&opts.envrcFile, "envrc-file", "", "Move the managed block to this file (.envrc for the default)")
+	cmd.Flags().StringVar(&opts.ifTracked, "if-tracked", ifTrackedAsk, ifTrackedUsage)
+
+	cmd.MarkFlagsMutuallyExclusive("git-email", "no-git-email")
+	cmd.MarkFlagsMutuallyExclusive("git-name", "no-git-name")
+	cmd.MarkFlagsMutuallyExclusive("ssh-key", "no-ssh-key")
+	cmd.MarkFlagsMutuallyExclusive("host", "no-host")
+	cmd.MarkFlagsMutuallyExclusive("org", "no-orgs")
+
+	return cmd
+}
+
+// printPinChanges shows changed pin fields as a before/after diff.
+func printPinChanges(changes []config.FieldChange) {
+	show := func(v string) string {
+		if v == "" {
+			return "(unset)"
+		}
+		return v
+	}
+	for _, c := range changes {
+		fmt.Printf("  - %-10s %s\n", c.Field+":", show(c.Old))
+		fmt.Printf("  + %-10s %s\n", c.Field+":", show(c.New))
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/spf13/cobra"
+)
+
+// NewEnvCmd creates the `env` subcommand.
+func NewEnvCmd() *cobra.Command {
+	var dir, format string
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print the environment of the pin covering a directory for other tools",
+		Long: `Print the variables the pin covering a directory sets (the pin of the
+directory itself or of its closest pinned parent), for tools that manage
+the environment without direnv. The output is generated from the same
+pin settings as the .envrc block.
+
+Formats:
+  sh    export commands, for eval or a script sourced by another tool
+        (mise's _.source, a Nix devShell shellHook)
+  mise  an [env] table for mise.toml
+
+Export-mode pins read the token from gh when the output is evaluated; it
+is never printed. For mise, sourcing ~/.config/gh-autoprofile/mise.sh
+(installed by setup) keeps account details out of mise.toml:
+
+  [env]
+  _.source = "~/.config/gh-autoprofile/mise.sh"
+
+Examples:
+  eval "$(gh autoprofile env)"
+  gh autoprofile env --dir ~/work/api --format mise >> mise.local.toml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return fmt.Errorf("cannot resolve directory: %w", err)
+			}
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+			pin, err := activePin(cmd, registry, absDir)
+			if err != nil {
+				return err
+			}
+			if pin == nil {
+				return fmt.Errorf("no pin covers %s", absDir)
+			}
+			switch format {
+			case "sh":
+				fmt.Fprint(cmd.OutOrStdout(), direnvlib.ShellExports(*pin))
+			case "mise":
+				fmt.Fprint(cmd.OutOrStdout(), direnvlib.MiseEnv(*pin))
+			default:
+				return fmt.Errorf("invalid format %q (expected sh or mise)", format)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory whose pin to print")
+	cmd.Flags().StringVar(&format, "format", "sh", "Output format: sh or mise")
+	return cmd
+}
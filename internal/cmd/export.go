@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/bundle"
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// NewExportCmd creates the `export` subcommand.
+func NewExportCmd() *cobra.Command {
+	var output string
+	var rootFlags []string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the pin registry as a portable bundle",
+		Long: `Write the pin registry as a portable bundle. Directory and SSH key
+paths are rewritten relative to $HOME ("~/...") or to named roots
+("${work}/..."), so the bundle can be imported on another machine with
+'gh autoprofile import <bundle-file>'.
+
+Examples:
+  gh autoprofile export > pins.bundle.yml
+  gh autoprofile export -o pins.bundle.yml --root work=~/src/work`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			roots, err := bundle.ParseRoots(rootFlags)
+			if err != nil {
+				return err
+			}
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("cannot determine home directory: %w", err)
+			}
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+
+			b, warnings := bundle.Export(registry, home, roots)
+			for _, w := range warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", w)
+			}
+			data, err := b.Marshal()
+			if err != nil {
+				return fmt.Errorf("cannot marshal bundle: %w", err)
+			}
+
+			if output == "" || output == "-" {
+				_, err = cmd.OutOrStdout().Write(data)
+				return err
+			}
+			if err := os.WriteFile(output, data, 0600); err != nil {
+				return fmt.Errorf("cannot write bundle: %w", err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d pin(s) to %s\n", len(b.Pins), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the bundle to a file instead of stdout")
+	cmd.Flags().StringArrayVar(&rootFlags, "root", nil, "Named root to make paths relative to (name=path, repeatable)")
+	return cmd
+}
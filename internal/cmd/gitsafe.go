@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/gitrepo"
+	"github.com/mdiloreto/gh-autoprofile/internal/history"
+	"github.com/mdiloreto/gh-autoprofile/internal/migrate"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+	"github.com/mdiloreto/gh-autoprofile/internal/wizard"
+)
+
+// What to do when the file that would hold a pin's block can be committed
+// (the --if-tracked flag).
+const (
+	ifTrackedAsk     = "ask"
+	ifTrackedExclude = "exclude"
+	ifTrackedLocal   = "local"
+	ifTrackedAbort   = "abort"
+	ifTrackedWrite   = "write"
+)
+
+// ifTrackedUsage is the help text of every --if-tracked flag.
+const ifTrackedUsage = "When git could commit the file that would hold a pin's block: ask, exclude, local, write or abort"
+
+// localEnvrcFile is the file the "local" choice moves a pin's block to;
+// .envrc loads it with source_env_if_exists.
+const localEnvrcFile = ".envrc.local"
+
+// guardGitEnvrc checks whether git could commit the file that would hold
+// pin's settings and applies choice: exclude adds the file to the
+// repository's info/exclude, local moves the block to .envrc.local (kept
+// out of git the same way), write goes ahead and abort refuses. ask
+// prompts in a terminal and refuses elsewhere. Nothing is written: the
+// files to exclude are returned for the caller to add with the block.
+// Indirect pins put no settings in the file and pass as is.
+func guardGitEnvrc(pin config.Pin, choice string) (guarded config.Pin, excluded []string, err error) {
+	if pin.Indirect {
+		return pin, nil, nil
+	}
+	path := filepath.Join(pin.Dir, pin.EnvrcName())
+	state, err := gitrepo.StatFile(path)
+	if err != nil || !state.Committable() {
+		return pin, nil, err
+	}
+
+	if choice == ifTrackedAsk {
+		if !wizard.IsTerminal(os.Stdin) {
+			return pin, nil, fmt.Errorf("%s is %s; the next commit would publish the pin's account, email and SSH key path.\n"+
+				"Choose with --if-tracked exclude|local|write|abort, or pin with --indirect", path, state)
+		}
+		if choice, err = askGitEnvrc(path, state); err != nil {
+			return pin, nil, err
+		}
+	}
+
+	switch choice {
+	case ifTrackedWrite:
+		fmt.Printf("Warning: %s is %s; its block holds the pin's settings.\n", path, state)
+		return pin, nil, nil
+	case ifTrackedExclude:
+		if state == gitrepo.Tracked {
+			return pin, nil, fmt.Errorf("%s is tracked by git, so excluding it has no effect; use --if-tracked local or --indirect", path)
+		}
+		return pin, []string{path}, nil
+	case ifTrackedLocal:
+		pin.EnvrcFile = localEnvrcFile
+		local := filepath.Join(pin.Dir, localEnvrcFile)
+		state, err := gitrepo.StatFile(local)
+		switch {
+		case err != nil:
+			return pin, nil, err
+		case state == gitrepo.Tracked:
+			return pin, nil, fmt.Errorf("%s is tracked by git too; use --indirect instead", local)
+		case state == gitrepo.Untracked:
+			return pin, []string{local}, nil
+		}
+		return pin, nil, nil
+	case ifTrackedAbort:
+		return pin, nil, fmt.Errorf("aborted: %s is %s", path, state)
+	}
+	return pin, nil, fmt.Errorf("invalid --if-tracked value %q (expected ask, exclude, local, write or abort)", choice)
+}
+
+// askGitEnvrc lets the user pick what to do about a committable path.
+func askGitEnvrc(path string, state gitrepo.FileState) (string, error) {
+	fmt.Printf("\n%s is %s.\nWriting the pin's block there would let the next commit publish its account, email and SSH key path.\n", path, state)
+	choices := []string{ifTrackedLocal, ifTrackedAbort, ifTrackedWrite}
+	labels := []string{
+		"Write the block to " + localEnvrcFile + " and load it from .envrc",
+		"Abort",
+		"Write it anyway",
+	}
+	if state == gitrepo.Untracked {
+		choices = append([]string{ifTrackedExclude}, choices...)
+		labels = append([]string{"Add it to .git/info/exclude"}, labels...)
+	}
+	i, err := wizard.NewPrompter(os.Stdin, os.Stdout).Select("What should gh-autoprofile do?", labels, 0)
+	if err != nil {
+		return "", err
+	}
+	return choices[i], nil
+}
+
+// excludeFromGit adds path to its repository's info/exclude file through
+// x.
+func excludeFromGit(x plan.Executor, path string) error {
+	file, entry, err := gitrepo.ExcludeFile(path)
+	if err != nil {
+		return err
+	}
+	current, err := x.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot read %s: %w", file, err)
+	}
+	data, changed := gitrepo.AddExclude(current, entry)
+	if !changed {
+		return nil
+	}
+	if err := x.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if fi, err := x.Stat(file); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	if err := x.WriteFile(file, data, perm); err != nil {
+		return fmt.Errorf("cannot update %s: %w", file, err)
+	}
+	if x == plan.Disk {
+		fmt.Printf("Added %s to %s\n", filepath.Base(path), file)
+	}
+	return nil
+}
+
+// captureExcludes records, in snap and rec, the info/exclude files that
+// excludeFromGit would change for paths.
+func captureExcludes(snap *direnvlib.Snapshot, rec *history.Recorder, paths []string) error {
+	for _, path := range paths {
+		file, _, err := gitrepo.ExcludeFile(path)
+		if err != nil {
+			return err
+		}
+		if snap != nil {
+			if err := snap.CaptureFile(file); err != nil {
+				return err
+			}
+		}
+		if err := rec.Capture(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationGuard returns the migrate.Guard that passes each pin through
+// guardGitEnvrc with choice. The files it excludes are recorded in rec,
+// when given, and written through the step's executor.
+func migrationGuard(choice string, rec *history.Recorder) migrate.Guard {
+	return func(pin config.Pin, x plan.Executor) (config.Pin, error) {
+		pin, excluded, err := guardGitEnvrc(pin, choice)
+		if err != nil {
+			return pin, err
+		}
+		if rec != nil {
+			if err := captureExcludes(nil, rec, excluded); err != nil {
+				return pin, err
+			}
+		}
+		for _, path := range excluded {
+			if err := excludeFromGit(x, path); err != nil {
+				return pin, err
+			}
+		}
+		return pin, nil
+	}
+}
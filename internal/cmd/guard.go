@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/guard"
+	"github.com/spf13/cobra"
+)
+
+// NewGuardCmd creates the `guard` subcommand and its children.
+func NewGuardCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "guard",
+		Short: "Enforce the pinned git identity with managed git hooks",
+		Long: `Install pre-commit and pre-push hooks that reject commits whose author
+email does not match the pin resolved for the repository. This catches
+commits made from an IDE or a shell where direnv is not loaded.
+pre-commit checks the identity git is about to record; pre-push checks
+the author of every commit being pushed.`,
+	}
+
+	cmd.AddCommand(newGuardInstallCmd(), newGuardUninstallCmd(), newGuardCheckCmd())
+	return cmd
+}
+
+func newGuardInstallCmd() *cobra.Command {
+	var hooksPath string
+	var all, force bool
+
+	cmd := &cobra.Command{
+		Use:   "install [directory...]",
+		Short: "Install identity hooks into pinned repositories",
+		Long: `Install the managed pre-commit and pre-push hooks into the given
+repositories (default: current directory), or into every pinned
+repository with --all.
+
+With --hooks-path, the hooks are written to a shared directory instead.
+Point git at it with: git config --global core.hooksPath <dir>
+
+Examples:
+  gh autoprofile guard install
+  gh autoprofile guard install --all
+  gh autoprofile guard install --hooks-path ~/.config/git/hooks`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if hooksPath != "" {
+				return installGuardHooks(hooksPath, force)
+			}
+			dirs, err := guardTargetDirs(args, all)
+			if err != nil {
+				return err
+			}
+			for _, dir := range dirs {
+				hooksDir, err := guard.HooksDir(dir)
+				if err != nil {
+					fmt.Printf("SKIP %s: %v\n", dir, err)
+					continue
+				}
+				if err := installGuardHooks(hooksDir, force); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&hooksPath, "hooks-path", "", "Install into a shared core.hooksPath directory")
+	cmd.Flags().BoolVar(&all, "all", false, "Install into every pinned directory that is a git repository")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace existing hooks not managed by gh-autoprofile")
+	return cmd
+}
+
+func newGuardUninstallCmd() *cobra.Command {
+	var hooksPath string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "uninstall [directory...]",
+		Short: "Remove the managed identity hooks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var hooksDirs []string
+			if hooksPath != "" {
+				hooksDirs = append(hooksDirs, hooksPath)
+			} else {
+				dirs, err := guardTargetDirs(args, all)
+				if err != nil {
+					return err
+				}
+				for _, dir := range dirs {
+					hooksDir, err := guard.HooksDir(dir)
+					if err != nil {
+						fmt.Printf("SKIP %s: %v\n", dir, err)
+						continue
+					}
+					hooksDirs = append(hooksDirs, hooksDir)
+				}
+			}
+
+			for _, hooksDir := range hooksDirs {
+				removed, err := guard.Uninstall(hooksDir)
+				if err != nil {
+					return err
+				}
+				for _, path := range removed {
+					fmt.Printf("Removed %s\n", path)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&hooksPath, "hooks-path", "", "Remove from a shared core.hooksPath directory")
+	cmd.Flags().BoolVar(&all, "all", false, "Remove from every pinned directory")
+	return cmd
+}
+
+func newGuardCheckCmd() *cobra.Command {
+	var hook string
+
+	cmd := &cobra.Command{
+		Use:    "check",
+		Short:  "Verify the git author identity against the pin (run by the hooks)",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("cannot get current directory: %w", err)
+			}
+
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+			pin := registry.ResolvePin(cwd)
+			if pin == nil {
+				return nil
+			}
+
+			if hook == "pre-push" {
+				refs, err := guard.ParsePushRefs(os.Stdin)
+				if err != nil {
+					return err
+				}
+				commits, err := guard.PushedCommits(cwd, refs)
+				if err != nil {
+					return err
+				}
+				if err := guard.CheckCommits(pin, commits); err != nil {
+					return fmt.Errorf("gh-autoprofile: pre-push rejected: %w\n"+
+						"  Fix the author with: git rebase -x 'git commit --amend --no-edit --reset-author' <base>\n"+
+						"  (with git config user.email %s)", err, pin.GitEmail)
+				}
+				return nil
+			}
+
+			email, err := guard.AuthorEmail(cwd)
+			if err != nil {
+				return err
+			}
+			if err := guard.CheckIdentity(pin, email); err != nil {
+				return fmt.Errorf("gh-autoprofile: %s rejected: %w\n"+
+					"  Load the pin (cd . with direnv) or set: git config user.email %s", hook, err, pin.GitEmail)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&hook, "hook", "pre-commit", "Name of the git hook being run")
+	return cmd
+}
+
+// guardTargetDirs returns the directories named on the command line, every
+// pinned directory when all is set, or the current directory.
+func guardTargetDirs(args []string, all bool) ([]string, error) {
+	if all {
+		registry, err := config.LoadPins()
+		if err != nil {
+			return nil, fmt.Errorf("cannot load pin registry: %w", err)
+		}
+		var dirs []string
+		for _, pin := range registry.Pins {
+			dirs = append(dirs, pin.Dir)
+		}
+		return dirs, nil
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var dirs []string
+	for _, arg := range args {
+		absDir, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve directory: %w", err)
+		}
+		dirs = append(dirs, absDir)
+	}
+	return dirs, nil
+}
+
+func installGuardHooks(hooksDir string, force bool) error {
+	installed, err := guard.Install(hooksDir, force)
+	if err != nil {
+		return err
+	}
+	for _, path := range installed {
+		fmt.Printf("Installed %s\n", path)
+	}
+	return nil
+}
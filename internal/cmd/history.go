@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/history"
+	"github.com/spf13/cobra"
+)
+
+// NewHistoryCmd creates the `history` subcommand.
+func NewHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history",
+		Short: "List recent operations that can be undone",
+		Long: fmt.Sprintf(`Show the operations that changed pins.yml or managed .envrc files,
+newest first. Before each change the previous files are saved under
+the config directory; the last %d operations are kept.`, history.MaxEntries),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := history.List()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				fmt.Println("No recorded operations.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "WHEN\tCOMMAND\tFILES")
+			fmt.Fprintln(w, "----\t-------\t-----")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%d\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Command, len(e.Files))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// NewUndoCmd creates the `undo` subcommand.
+func NewUndoCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Revert the last pin, unpin, edit, mv, import or migration",
+		Long: `Restore pins.yml and every .envrc the last recorded operation changed,
+and move back a directory renamed by mv. Restored .envrc files are
+re-allowed with direnv.
+
+Undo refuses when one of those files changed after the operation;
+--force overwrites them anyway.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			unlock, err := config.LockPins()
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			entry, err := history.Undo(force)
+			if errors.Is(err, history.ErrEmpty) {
+				fmt.Println("Nothing to undo.")
+				return nil
+			}
+			if entry == nil {
+				return err
+			}
+			for _, f := range entry.Files {
+				if f.Existed {
+					fmt.Printf("RESTORE %s\n", f.Path)
+				} else {
+					fmt.Printf("REMOVE  %s\n", f.Path)
+				}
+			}
+			for _, r := range entry.Renames {
+				fmt.Printf("MOVE    %s -> %s\n", r.To, r.From)
+			}
+			if err != nil {
+				return fmt.Errorf("undo of '%s' incomplete: %w", entry.Command, err)
+			}
+			allowRestored(entry)
+			fmt.Printf("\nUndid '%s' from %s.\n", entry.Command, entry.Time.Local().Format("2006-01-02 15:04:05"))
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite files changed since the operation")
+	return cmd
+}
+
+// allowRestored re-allows restored .envrc files, whose direnv approval the
+// operation invalidated.
+func allowRestored(entry *history.Entry) {
+	if !direnvlib.IsInstalled() {
+		return
+	}
+	for _, f := range entry.Files {
+		if !f.Existed || filepath.Base(f.Path) != ".envrc" {
+			continue
+		}
+		dir := filepath.Dir(f.Path)
+		for _, r := range entry.Renames {
+			if dir == r.To {
+				dir = r.From
+			}
+		}
+		if err := direnvlib.AllowEnvrc(dir); err != nil {
+			fmt.Printf("Warning: could not auto-allow %s/.envrc: %v\n", dir, err)
+		}
+	}
+}
+
+// commitHistory records a finished operation. History is best effort: a
+// failure only warns, since the operation itself already succeeded.
+func commitHistory(rec *history.Recorder) {
+	if err := rec.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot record operation for undo: %v\n", err)
+	}
+}
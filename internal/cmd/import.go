@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/bundle"
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/mdiloreto/gh-autoprofile/internal/importer"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+	"github.com/spf13/cobra"
+)
+
+// importOptions holds the flag values of the `import` subcommand.
+type importOptions struct {
+	from      []string
+	scan      []string
+	gitconfig string
+	user      string
+	dryRun    bool
+	overwrite bool
+	ifTracked string
+	roots     []string
+	conflict  string
+}
+
+// NewImportCmd creates the `import` subcommand.
+func NewImportCmd() *cobra.Command {
+	var opts importOptions
+
+	cmd := &cobra.Command{
+		Use:   "import [bundle-file] | --from <source>",
+		Short: "Import pins from a bundle, gh-profile, ~/.gitconfig or .envrc files",
+		Long: `Create pins and managed .envrc blocks from a bundle written by
+'gh autoprofile export', or from existing configuration.
+
+Bundle paths relative to a named root ("${work}/api") need the root's
+location on this machine: --root work=~/code/work. Pins for directories
+that are already pinned follow --conflict:
+  skip       keep the existing pin (default)
+  overwrite  replace it with the bundle's pin (also --overwrite)
+  merge      keep the existing pin, filling empty fields from the bundle
+Pins of accounts that are not logged in to gh are skipped.
+
+Sources:
+  gh-profile  .envrc files exporting GH_CONFIG_DIR=<gh config>/profiles/<name>
+              (written by gh-profile); the account is read from the profile.
+              gh-profile records no directories itself, so profiles that no
+              scanned .envrc activates are listed as warnings, not imported
+  gitconfig   [includeIf "gitdir:<dir>/"] sections of ~/.gitconfig; the account
+              comes from github.user in the included file, or --user
+  envrc       hand-written .envrc files exporting
+              GH_TOKEN=$(gh auth token --user <name>)
+
+.envrc files are searched under --scan (default: current directory).
+Lines superseded by the managed block are commented out, not deleted.
+Directories that are already pinned are skipped unless --overwrite is set.
+A block bound for a file git could commit follows --if-tracked, as with
+pin; the .envrc files imported from are often committed.
+
+Examples:
+  gh autoprofile import pins.bundle.yml --root work=~/code/work --dry-run
+  gh autoprofile import pins.bundle.yml --conflict merge
+  gh autoprofile import --from gh-profile --scan ~/src
+  gh autoprofile import --from gitconfig --dry-run
+  gh autoprofile import --from envrc,gitconfig --scan ~/work --user bob-work`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				if len(opts.from) > 0 {
+					return fmt.Errorf("pass either a bundle file or --from, not both")
+				}
+				return runImportBundle(args[0], opts)
+			}
+			if len(opts.from) == 0 {
+				return fmt.Errorf("nothing to import: pass a bundle file or --from <source>")
+			}
+			return runImport(opts)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opts.from, "from", nil, "Source(s) to import from: gh-profile, gitconfig, envrc")
+	cmd.Flags().StringSliceVar(&opts.scan, "scan", []string{"."}, "Directories to search for .envrc files")
+	cmd.Flags().StringVar(&opts.gitconfig, "gitconfig", "", "Git config file to read includeIf sections from (default ~/.gitconfig)")
+	cmd.Flags().StringVar(&opts.user, "user", "", "Account to use for gitconfig sections without github.user")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show what would be imported without changing anything")
+	cmd.Flags().BoolVar(&opts.overwrite, "overwrite", false, "Replace existing pins for the same directory (same as --conflict overwrite)")
+	cmd.Flags().StringArrayVar(&opts.roots, "root", nil, "Location of a named bundle root on this machine (name=path, repeatable)")
+	cmd.Flags().StringVar(&opts.conflict, "conflict", string(bundle.ConflictSkip), "Bundle conflict policy: skip, overwrite or merge")
+	cmd.Flags().StringVar(&opts.ifTracked, "if-tracked", ifTrackedAsk, ifTrackedUsage)
+	cmd.MarkFlagsMutuallyExclusive("overwrite", "conflict")
+
+	return cmd
+}
+
+func runImport(opts importOptions) error {
+	var candidates []importer.Candidate
+	var warnings []string
+
+	var envrcs []string
+	needEnvrcs := false
+	for _, source := range opts.from {
+		if source == importer.SourceGhProfile || source == importer.SourceEnvrc {
+			needEnvrcs = true
+		}
+	}
+	if needEnvrcs {
+		found, err := importer.ScanEnvrcs(opts.scan)
+		if err != nil {
+			return err
+		}
+		envrcs = found
+	}
+
+	for _, source := range opts.from {
+		var res *importer.Result
+		var err error
+		switch source {
+		case importer.SourceGhProfile:
+			res, err = importer.FromGhProfile(envrcs)
+		case importer.SourceEnvrc:
+			res, err = importer.FromEnvrcs(envrcs)
+		case importer.SourceGitconfig:
+			path := opts.gitconfig
+			if path == "" {
+				home, herr := os.UserHomeDir()
+				if herr != nil {
+					return fmt.Errorf("cannot determine home directory: %w", herr)
+				}
+				path = filepath.Join(home, ".gitconfig")
+			}
+			res, err = importer.FromGitconfig(path, opts.user)
+		default:
+			return fmt.Errorf("unknown import source %q (expected gh-profile, gitconfig or envrc)", source)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot import from %s: %w", source, err)
+		}
+		candidates = append(candidates, res.Candidates...)
+		warnings = append(warnings, res.Warnings...)
+	}
+
+	for _, w := range warnings {
+		fmt.Printf("WARN %s\n", w)
+	}
+	if len(candidates) == 0 {
+		fmt.Println("Nothing to import.")
+		return nil
+	}
+
+	unlock, err := config.LockPins()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+
+	var change pinChange
+	for _, c := range candidates {
+		if _, err := os.Stat(c.Pin.Dir); err != nil {
+			fmt.Printf("SKIP %s: directory does not exist\n", c.Pin.Dir)
+			continue
+		}
+		if existing := registry.FindPin(c.Pin.Dir); existing != nil && !opts.overwrite {
+			fmt.Printf("SKIP %s: already pinned to '%s' (use --overwrite)\n", c.Pin.Dir, existing.User)
+			continue
+		}
+		if !opts.dryRun {
+			if err := ghauth.ValidateUser(c.Pin.User); err != nil {
+				fmt.Printf("SKIP %s: account '%s' is not logged in to gh (run: gh auth login)\n", c.Pin.Dir, c.Pin.User)
+				continue
+			}
+		}
+		// Placed like pin places them; the hand-written files import
+		// reads are often committed.
+		var placed pinChange
+		if c.Pin, err = placePin(registry, c.Pin, pinOptions{ifTracked: opts.ifTracked}, &placed); err != nil {
+			fmt.Printf("SKIP %s: %v\n", c.Pin.Dir, err)
+			continue
+		}
+
+		verb := "IMPORT"
+		if opts.dryRun {
+			verb = "WOULD IMPORT"
+		}
+		fmt.Printf("%s %s -> '%s' (%s, %s from %s)\n", verb, c.Pin.Dir, c.Pin.User, c.Pin.EffectiveMode(), c.Source, c.Origin)
+		registry.AddPin(c.Pin)
+		change.written = append(change.written, placed.written...)
+		change.removed = append(change.removed, placed.removed...)
+		change.excluded = append(change.excluded, placed.excluded...)
+		change.superseded = append(change.superseded, c)
+	}
+
+	if len(change.written) == 0 {
+		return nil
+	}
+	if opts.dryRun {
+		return previewPins(plan.New(), registry, change)
+	}
+	if err := commitPins("import", registry, change); err != nil {
+		return err
+	}
+	allowPins(registry, change.written)
+
+	fmt.Printf("\nImported %d pin(s).\n", len(change.written))
+	return nil
+}
+
+func runImportBundle(path string, opts importOptions) error {
+	policy, err := bundle.ParseConflictPolicy(opts.conflict)
+	if err != nil {
+		return err
+	}
+	if opts.overwrite {
+		policy = bundle.ConflictOverwrite
+	}
+	roots, err := bundle.ParseRoots(opts.roots)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("cannot determine home directory: %w", err)
+	}
+
+	b, err := bundle.Load(path)
+	if err != nil {
+		return err
+	}
+	pins, err := b.Materialize(home, roots)
+	if err != nil {
+		return err
+	}
+
+	// Each account is checked once, as pin does, before anything is
+	// written; its pins are skipped if gh has no token for it.
+	loggedIn := map[string]bool{}
+	var present []config.Pin
+	for _, pin := range pins {
+		if _, err := os.Stat(pin.Dir); err != nil {
+			fmt.Printf("SKIP %s: directory does not exist\n", pin.Dir)
+			continue
+		}
+		if !opts.dryRun {
+			ok, checked := loggedIn[pin.User]
+			if !checked {
+				ok = ghauth.ValidateUser(pin.User) == nil
+				loggedIn[pin.User] = ok
+			}
+			if !ok {
+				fmt.Printf("SKIP %s: account '%s' is not logged in to gh (run: gh auth login)\n", pin.Dir, pin.User)
+				continue
+			}
+		}
+		present = append(present, pin)
+	}
+
+	unlock, err := config.LockPins()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+	// Apply changes registry in place. Its pins are then placed like pin
+	// places them, against the registry as it was: a copy keeps the pins
+	// Apply replaces, to remove their blocks or to put them back when
+	// placement refuses the new one.
+	prior := *registry
+	prior.Pins = append([]config.Pin(nil), registry.Pins...)
+	actions := bundle.Apply(registry, present, policy)
+
+	var change pinChange
+	for _, a := range actions {
+		changed := a.Result != "skip" && a.Result != "unchanged"
+		if changed {
+			pin, err := placePin(&prior, a.Pin, pinOptions{envrcFile: a.Pin.EnvrcFile, ifTracked: opts.ifTracked}, &change)
+			if err != nil {
+				registry.RemovePin(a.Pin.Dir)
+				if p := prior.FindPin(a.Pin.Dir); p != nil {
+					registry.AddPin(*p)
+				}
+				fmt.Printf("SKIP %s: %v\n", a.Pin.Dir, err)
+				continue
+			}
+			registry.AddPin(pin)
+			a.Pin = pin
+		}
+		label := strings.ToUpper(a.Result)
+		if opts.dryRun && changed {
+			label = "WOULD " + label
+		}
+		fmt.Printf("%s %s -> '%s' (%s)\n", label, a.Pin.Dir, a.Pin.User, a.Pin.EffectiveMode())
+	}
+
+	if len(change.written) == 0 {
+		return nil
+	}
+	if opts.dryRun {
+		return previewPins(plan.New(), registry, change)
+	}
+	if err := commitPins("import", registry, change); err != nil {
+		return err
+	}
+	allowPins(registry, change.written)
+
+	fmt.Printf("\nImported %d pin(s) from %s.\n", len(change.written), path)
+	return nil
+}
@@ -46,6 +46,12 @@ func runList(cmd *cobra.Command, args []string) error {
 		}
 
 		mode := string(pin.EffectiveMode())
+		if pin.Protected {
+			mode += " (protected)"
+		}
+		if pin.Indirect {
+			mode += " (indirect)"
+		}
 		email := pin.GitEmail
 		if email == "" {
 			email = "-"
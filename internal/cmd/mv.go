@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/history"
+	"github.com/spf13/cobra"
+)
+
+// NewMvCmd creates the `mv` subcommand.
+func NewMvCmd() *cobra.Command {
+	var ifTracked string
+	cmd := &cobra.Command{
+		Use:   "mv <old-directory> <new-directory>",
+		Short: "Move or rename a pinned directory and its pin",
+		Long: `Move the pin for <old-directory> to <new-directory>.
+
+If <old-directory> still exists, it is renamed to <new-directory> first.
+If it was already moved (e.g. with plain mv or an IDE), only the pin is
+updated. The .envrc block is rewritten and re-allowed at the new path;
+if git could commit it there, --if-tracked applies as with pin. If a step
+fails, the directory is moved back and its files restored.
+
+Examples:
+  gh autoprofile mv ~/work/foo ~/work/bar
+  mv ~/work/foo ~/work/bar && gh autoprofile mv ~/work/foo ~/work/bar`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMv(args[0], args[1], ifTracked)
+		},
+	}
+	cmd.Flags().StringVar(&ifTracked, "if-tracked", ifTrackedAsk, ifTrackedUsage)
+	return cmd
+}
+
+func runMv(oldDir, newDir, ifTracked string) error {
+	absOld, err := filepath.Abs(oldDir)
+	if err != nil {
+		return fmt.Errorf("cannot resolve directory: %w", err)
+	}
+	absNew, err := filepath.Abs(newDir)
+	if err != nil {
+		return fmt.Errorf("cannot resolve directory: %w", err)
+	}
+
+	unlock, err := config.LockPins()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+	pin, err := registry.MovePin(absOld, absNew)
+	if err != nil {
+		return err
+	}
+	moved := *pin
+	old := moved
+	old.Dir = absOld
+
+	_, oldErr := os.Stat(absOld)
+	_, newErr := os.Stat(absNew)
+	switch {
+	case oldErr == nil && newErr == nil:
+		return fmt.Errorf("both %s and %s exist; move the directory yourself, then re-run", absOld, absNew)
+	case oldErr != nil && newErr != nil:
+		return fmt.Errorf("neither %s nor %s exists", absOld, absNew)
+	}
+	rename := oldErr == nil
+
+	rec, err := history.Begin("mv")
+	if err != nil {
+		return err
+	}
+	// The pin's files are captured before the move under their new path,
+	// where rollback and undo restore them before moving back.
+	var snap direnvlib.Snapshot
+	for i, as := range moved.ManagedFiles() {
+		path := as
+		if rename {
+			path = old.ManagedFiles()[i]
+		}
+		if err := snap.CaptureAs(path, as); err != nil {
+			return err
+		}
+		if err := rec.CaptureAs(path, as); err != nil {
+			return err
+		}
+	}
+	if rename {
+		if err := os.Rename(absOld, absNew); err != nil {
+			return fmt.Errorf("cannot move directory: %w", err)
+		}
+		rec.Rename(absOld, absNew)
+	}
+	rollback := func(cause error) error {
+		err := rollbackPins(&snap, cause)
+		if rename {
+			if mvErr := os.Rename(absNew, absOld); mvErr != nil {
+				return fmt.Errorf("%w (cannot move %s back: %v)", err, absNew, mvErr)
+			}
+		}
+		return err
+	}
+
+	// direnv approvals are tied to the path, so the block is rewritten and
+	// re-allowed at the new one. The native backend needs neither.
+	var change pinChange
+	if !registry.Native() {
+		guarded, excluded, err := guardGitEnvrc(moved, ifTracked)
+		if err != nil {
+			return rollback(err)
+		}
+		if guarded.EnvrcName() != moved.EnvrcName() {
+			change.removed = []config.Pin{moved}
+		}
+		*pin, moved = guarded, guarded
+		change.written = []config.Pin{moved}
+		change.excluded = excluded
+	}
+	if err := applyPins(&snap, rec, registry, change); err != nil {
+		return rollback(err)
+	}
+	commitHistory(rec)
+
+	if rename {
+		fmt.Printf("Moved %s -> %s\n", absOld, absNew)
+	}
+	allowMovedEnvrc(registry, moved)
+	fmt.Printf("Pin for '%s' now points at %s\n", moved.User, absNew)
+	return nil
+}
+
+// allowMovedEnvrc re-allows the .envrc at the pin's new directory;
+// direnv approvals are tied to the path. The native backend resolves pins
+// by directory and needs none.
+func allowMovedEnvrc(registry *config.PinRegistry, pin config.Pin) {
+	if registry.Native() || !direnvlib.IsInstalled() {
+		return
+	}
+	if err := direnvlib.AllowEnvrc(pin.Dir); err != nil {
+		fmt.Printf("Warning: could not auto-allow .envrc: %v\n", err)
+		fmt.Printf("  Run manually: direnv allow %s/.envrc\n", pin.Dir)
+	}
+}
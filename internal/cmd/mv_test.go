@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/history"
+)
+
+func TestMv_UndoMovesBackAndRestoresEnvrc(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("PATH", t.TempDir()) // no direnv
+
+	parent := t.TempDir()
+	from, to := filepath.Join(parent, "a"), filepath.Join(parent, "b")
+	if err := os.Mkdir(from, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A .envrc without the block: mv writes it, undo must bring back this.
+	const before = "export A=1\n"
+	if err := os.WriteFile(filepath.Join(from, ".envrc"), []byte(before), 0600); err != nil {
+		t.Fatal(err)
+	}
+	registry := &config.PinRegistry{}
+	registry.AddPin(config.Pin{User: "alice", Dir: from})
+	if err := config.SavePins(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runMv(from, parent, ifTrackedAsk); err == nil {
+		t.Fatal("expected moving onto an existing directory to fail")
+	}
+	if entries, _ := history.List(); len(entries) != 0 {
+		t.Fatalf("a rejected mv recorded %d history entries", len(entries))
+	}
+
+	if err := runMv(from, to, ifTrackedAsk); err != nil {
+		t.Fatalf("runMv: %v", err)
+	}
+	if _, err := history.Undo(false); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(from, ".envrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != before {
+		t.Errorf(".envrc after undo = %q, want %q", data, before)
+	}
+	if _, err := os.Stat(to); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after undo", to)
+	}
+}
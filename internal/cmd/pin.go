@@ -4,21 +4,37 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
 	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
 	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+	"github.com/mdiloreto/gh-autoprofile/internal/wizard"
 	"github.com/spf13/cobra"
 )
 
+// pinOptions holds the flag values of the `pin` subcommand.
+type pinOptions struct {
+	dir, gitEmail, gitName, sshKey string
+	exportToken, protected         bool
+	host                           string
+	orgs                           []string
+	strict                         bool
+	indirect                       bool
+	ifTracked                      string
+	envrcFile                      string
+	dryRun                         bool
+}
+
 // NewPinCmd creates the `pin` subcommand.
 func NewPinCmd() *cobra.Command {
-	var dir, gitEmail, gitName, sshKey string
-	var exportToken bool
+	var opts pinOptions
+	var fromFile string
 
 	cmd := &cobra.Command{
-		Use:   "pin <username>",
-		Short: "Pin a GitHub account to a directory",
+		Use:   "pin [username] [directory...]",
+		Short: "Pin a GitHub account to one or more directories",
 		Long: `Pin a GitHub account to a directory. When you cd into the directory,
 the correct credentials and git identity are automatically activated.
 
@@ -28,98 +44,162 @@ By default, tokens are injected per-command via shell wrapper functions
 Use --export-token for directories where third-party tools (Terraform,
 act, etc.) need GH_TOKEN / GITHUB_TOKEN as environment variables.
 
+Use --protected for sensitive accounts (e.g. org admins). The shell hook
+then asks for confirmation before git push, gh pr merge and gh repo
+delete. Set GH_AUTOPROFILE_CONFIRM=1 to allow them non-interactively.
+
+Use --org to list organisations the account pushes to. Before each push
+the shell hook compares the owner of the remote pushed to with the
+account and its orgs and warns on a mismatch; --strict refuses the push instead.
+
+Use --indirect to keep the account, email and SSH key path out of the
+.envrc: its block is a single "use gh_autoprofile" line that resolves the
+pin from pins.yml when direnv loads it. The .envrc is then safe to commit,
+and editing the pin needs no .envrc rewrite or re-allow.
+
+If the .envrc is tracked by git, or untracked but not ignored, the next
+commit could publish the pin's settings. In a terminal you are asked what
+to do; elsewhere the pin is refused unless --if-tracked says: exclude
+(add .envrc to .git/info/exclude), local (write the block to .envrc.local,
+loaded from .envrc with source_env_if_exists), write, or abort.
+
+Use --envrc-file to write the block to another file of the directory,
+e.g. the .envrc.local a committed .envrc loads. If .envrc does not load
+it already, a source_env_if_exists block is added. Set envrc_file in
+pins.yml to change the default for new pins.
+
+If the directory or a parent contains a .gh-autoprofile.yml policy, the
+pin must satisfy it (see: gh autoprofile policy show).
+
+Run without a username in a terminal to pick the account, git identity,
+SSH key and mode interactively.
+
+Several directories can be pinned at once, as arguments or with
+--from-file (one path per line, "-" for stdin). Directories that cannot
+be pinned are skipped; if writing the .envrc files or the registry fails,
+all changes are rolled back.
+
+Use --dry-run to print a diff of pins.yml and every .envrc that would
+change, and the direnv commands that would run, without writing anything.
+
 Examples:
+  gh autoprofile pin
   gh autoprofile pin alice
   gh autoprofile pin bob-work --dir ~/work --git-email bob@company.com
-  gh autoprofile pin alice-freelance --dir ~/freelance --export-token`,
-		Args: cobra.ExactArgs(1),
+  gh autoprofile pin bob-work ~/work/api ~/work/web ~/work/infra
+  gh autoprofile pin bob-work --from-file work-repos.txt
+  gh autoprofile pin alice-freelance --dir ~/freelance --export-token
+  gh autoprofile pin acme-admin --dir ~/acme/admin --protected
+  gh autoprofile pin bob-work --dir ~/work --org acme --strict
+  gh autoprofile pin alice --dir ~/oss/project --indirect
+  gh autoprofile pin bob-work ~/work/api --dry-run`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runPin(args[0], dir, gitEmail, gitName, sshKey, exportToken)
+			if len(args) == 0 {
+				if fromFile != "" {
+					return fmt.Errorf("username required with --from-file")
+				}
+				if !wizard.IsTerminal(os.Stdin) {
+					return fmt.Errorf("username required (run in a terminal to pick one interactively)")
+				}
+				user, opts, err := runPinWizard(opts)
+				if err != nil {
+					return err
+				}
+				return runPin(user, opts)
+			}
+
+			dirs := args[1:]
+			if fromFile != "" {
+				listed, err := readDirList(fromFile)
+				if err != nil {
+					return err
+				}
+				if len(listed) == 0 {
+					return fmt.Errorf("no directories listed in %s", fromFile)
+				}
+				dirs = append(dirs, listed...)
+			}
+			if len(dirs) > 0 && cmd.Flags().Changed("dir") {
+				return fmt.Errorf("pass directories either as arguments or with --dir, not both")
+			}
+			switch len(dirs) {
+			case 0:
+				return runPin(args[0], opts)
+			case 1:
+				opts.dir = dirs[0]
+				return runPin(args[0], opts)
+			}
+			return runPinBulk(args[0], dirs, opts)
 		},
 	}
 
-	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory to pin (defaults to current directory)")
-	cmd.Flags().StringVar(&gitEmail, "git-email", "", "Git author/committer email for this directory")
-	cmd.Flags().StringVar(&gitName, "git-name", "", "Git author/committer name for this directory")
-	cmd.Flags().StringVar(&sshKey, "ssh-key", "", "Path to SSH private key for this directory")
-	cmd.Flags().BoolVar(&exportToken, "export-token", false, "Export GH_TOKEN/GITHUB_TOKEN into the shell environment (less secure)")
+	cmd.Flags().StringVarP(&opts.dir, "dir", "d", ".", "Directory to pin (defaults to current directory)")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Pin every directory listed in a file (one per line, - for stdin)")
+	cmd.Flags().StringVar(&opts.gitEmail, "git-email", "", "Git author/committer email for this directory")
+	cmd.Flags().StringVar(&opts.gitName, "git-name", "", "Git author/committer name for this directory")
+	cmd.Flags().StringVar(&opts.sshKey, "ssh-key", "", "Path to SSH private key for this directory")
+	cmd.Flags().BoolVar(&opts.exportToken, "export-token", false, "Export GH_TOKEN/GITHUB_TOKEN into the shell environment (less secure)")
+	cmd.Flags().BoolVar(&opts.protected, "protected", false, "Require confirmation before pushes and destructive gh operations")
+	cmd.Flags().StringVar(&opts.host, "host", "", "GitHub host of the account (detected from gh auth status when omitted)")
+	cmd.Flags().StringSliceVar(&opts.orgs, "org", nil, "Organisation the account may push to (repeatable)")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "Refuse pushes to remotes whose owner does not match the account or its orgs")
+	cmd.Flags().BoolVar(&opts.indirect, "indirect", false, "Keep settings out of .envrc and resolve them from pins.yml")
+	cmd.Flags().StringVar(&opts.envrcFile, "envrc-file", "", "File for the managed block, relative to the directory and loaded from .envrc (default: envrc_file in pins.yml, else .envrc)")
+	cmd.Flags().StringVar(&opts.ifTracked, "if-tracked", ifTrackedAsk, ifTrackedUsage)
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Show the changes as a diff without writing anything")
 
 	return cmd
 }
 
-func runPin(user, dir, gitEmail, gitName, sshKey string, exportToken bool) error {
-	// Resolve absolute path
-	absDir, err := filepath.Abs(dir)
+func runPin(user string, opts pinOptions) error {
+	absDir, err := resolvePinDir(opts.dir)
 	if err != nil {
-		return fmt.Errorf("cannot resolve directory: %w", err)
+		return err
 	}
 
-	// Validate directory exists
-	info, err := os.Stat(absDir)
+	pin, err := newPin(user, opts)
 	if err != nil {
-		return fmt.Errorf("directory does not exist: %s", absDir)
-	}
-	if !info.IsDir() {
-		return fmt.Errorf("not a directory: %s", absDir)
-	}
-
-	// Validate user is logged in to gh
-	fmt.Printf("Validating account '%s'... ", user)
-	if err := ghauth.ValidateUser(user); err != nil {
-		fmt.Println("FAILED")
 		return err
 	}
-	fmt.Println("OK")
+	pin.Dir = absDir
 
-	// Validate SSH key exists if specified
-	if sshKey != "" {
-		absKey, err := filepath.Abs(sshKey)
-		if err == nil {
-			sshKey = absKey
-		}
-		if _, err := os.Stat(sshKey); err != nil {
-			return fmt.Errorf("SSH key not found: %s", sshKey)
+	// Refuse pins that violate a policy committed to the repository; direnv
+	// would not activate them anyway.
+	if p := policyForDir(absDir); p != nil {
+		if err := policyError(p, &pin); err != nil {
+			return err
 		}
 	}
 
-	// Check direnv shell library is installed
-	if !direnvlib.IsShellLibInstalled() {
-		return fmt.Errorf("direnv shell library not installed. Run first: gh autoprofile setup")
-	}
-
-	// Determine mode
-	mode := config.ModeWrapper
-	if exportToken {
-		mode = config.ModeExport
-	}
-
-	// Create pin
-	pin := config.Pin{
-		User:     user,
-		Dir:      absDir,
-		Mode:     mode,
-		GitEmail: gitEmail,
-		GitName:  gitName,
-		SSHKey:   sshKey,
+	if !opts.dryRun {
+		unlock, err := config.LockPins()
+		if err != nil {
+			return err
+		}
+		defer unlock()
 	}
 
-	// Save to registry
 	registry, err := config.LoadPins()
 	if err != nil {
 		return fmt.Errorf("cannot load pin registry: %w", err)
 	}
+	var change pinChange
+	pin, err = placePin(registry, pin, opts, &change)
+	if err != nil {
+		return err
+	}
 	registry.AddPin(pin)
-	if err := config.SavePins(registry); err != nil {
-		return fmt.Errorf("cannot save pin registry: %w", err)
+	if opts.dryRun {
+		return previewPins(plan.New(), registry, change)
 	}
 
-	// Write .envrc
-	if err := direnvlib.WriteEnvrc(pin); err != nil {
-		return fmt.Errorf("cannot write .envrc: %w", err)
+	// Save to registry and write .envrc
+	if err := commitPins("pin", registry, change); err != nil {
+		return err
 	}
 
 	// Auto-allow .envrc
-	if direnvlib.IsInstalled() {
+	if !registry.Native() && direnvlib.IsInstalled() {
 		if err := direnvlib.AllowEnvrc(absDir); err != nil {
 			fmt.Printf("Warning: could not auto-allow .envrc: %v\n", err)
 			fmt.Printf("  Run manually: direnv allow %s/.envrc\n", absDir)
@@ -128,23 +208,44 @@ func runPin(user, dir, gitEmail, gitName, sshKey string, exportToken bool) error
 
 	// Summary
 	modeLabel := "wrapper"
-	if mode == config.ModeExport {
+	if pin.Mode == config.ModeExport {
 		modeLabel = "export"
 	}
 	fmt.Printf("\nPinned '%s' -> %s\n", user, absDir)
 	fmt.Printf("  Mode:       %s\n", modeLabel)
-	if gitEmail != "" {
-		fmt.Printf("  Git email:  %s\n", gitEmail)
+	if pin.GitEmail != "" {
+		fmt.Printf("  Git email:  %s\n", pin.GitEmail)
 	}
-	if gitName != "" {
-		fmt.Printf("  Git name:   %s\n", gitName)
+	if pin.GitName != "" {
+		fmt.Printf("  Git name:   %s\n", pin.GitName)
 	}
-	if sshKey != "" {
-		fmt.Printf("  SSH key:    %s\n", sshKey)
+	if pin.SSHKey != "" {
+		fmt.Printf("  SSH key:    %s\n", pin.SSHKey)
+	}
+	if pin.Host != "" {
+		fmt.Printf("  Host:       %s\n", pin.Host)
+	}
+	if len(pin.Orgs) > 0 {
+		fmt.Printf("  Orgs:       %s\n", strings.Join(pin.Orgs, ", "))
+	}
+	if pin.Strict {
+		fmt.Println("  Strict:     yes (pushes to other owners are refused)")
+	}
+	if pin.Protected {
+		fmt.Println("  Protected:  yes (push/merge/delete require confirmation)")
+	}
+	if pin.Indirect {
+		fmt.Println("  Indirect:   yes (.envrc holds no settings; safe to commit)")
+	}
+	if registry.Native() {
+		fmt.Println("  Activation: native shell hook (no .envrc)")
+	} else if name := pin.EnvrcName(); name != config.DefaultEnvrcFile {
+		fmt.Printf("  .envrc:     %s/.envrc (loads %s)\n", absDir, name)
+	} else {
+		fmt.Printf("  .envrc:     %s/.envrc\n", absDir)
 	}
-	fmt.Printf("  .envrc:     %s/.envrc\n", absDir)
 
-	if mode == config.ModeWrapper {
+	if pin.Mode == config.ModeWrapper {
 		fmt.Println("\n  Token is injected per-command (never in shell environment).")
 	} else {
 		fmt.Println("\n  WARNING: Token is exported into shell environment.")
@@ -154,3 +255,196 @@ func runPin(user, dir, gitEmail, gitName, sshKey string, exportToken bool) error
 
 	return nil
 }
+
+// runPinBulk pins user to every directory in dirs with the same settings.
+func runPinBulk(user string, dirs []string, opts pinOptions) error {
+	template, err := newPin(user, opts)
+	if err != nil {
+		return err
+	}
+
+	if !opts.dryRun {
+		unlock, err := config.LockPins()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+
+	var report bulkReport
+	var change pinChange
+	fmt.Println()
+	for _, dir := range dirs {
+		absDir, err := resolvePinDir(dir)
+		if err != nil {
+			report.skip(dir, err)
+			continue
+		}
+		pin := template
+		pin.Dir = absDir
+		if p := policyForDir(absDir); p != nil {
+			if err := policyError(p, &pin); err != nil {
+				report.skip(absDir, err)
+				continue
+			}
+		}
+		label := "PIN"
+		if existing := registry.FindPin(absDir); existing != nil {
+			label = "REPIN"
+		}
+		pin, err = placePin(registry, pin, opts, &change)
+		if err != nil {
+			report.skip(absDir, err)
+			continue
+		}
+		registry.AddPin(pin)
+		report.ok(label, absDir, "")
+	}
+
+	if opts.dryRun {
+		return previewPins(plan.New(), registry, change)
+	}
+	if len(change.written) > 0 {
+		if err := commitPins("pin", registry, change); err != nil {
+			return err
+		}
+		allowPins(registry, change.written)
+	}
+	return report.print(fmt.Sprintf("Pinned '%s' to", user))
+}
+
+// placePin decides which file holds pin's block: the one given with
+// --envrc-file, else that of the pin being replaced, else the registry
+// default. A file git could commit goes through guardGitEnvrc. The placed
+// pin is added to change, with the previous pin to remove when its block
+// sits in a different file and any files to exclude from git.
+func placePin(registry *config.PinRegistry, pin config.Pin, opts pinOptions, change *pinChange) (config.Pin, error) {
+	existing := registry.FindPin(pin.Dir)
+	switch {
+	case opts.envrcFile != "":
+		// Set by newPin.
+	case existing != nil:
+		pin.EnvrcFile = existing.EnvrcFile
+	default:
+		name, err := config.NormalizeEnvrcFile(registry.EnvrcFile)
+		if err != nil {
+			return pin, fmt.Errorf("pins.yml: %w", err)
+		}
+		pin.EnvrcFile = name
+	}
+	var excluded []string
+	if !registry.Native() {
+		var err error
+		if pin, excluded, err = guardGitEnvrc(pin, opts.ifTracked); err != nil {
+			return pin, err
+		}
+	}
+	if existing != nil && existing.EnvrcName() != pin.EnvrcName() {
+		change.removed = append(change.removed, *existing)
+	}
+	change.written = append(change.written, pin)
+	change.excluded = append(change.excluded, excluded...)
+	return pin, nil
+}
+
+// resolvePinDir returns the absolute path of dir after checking that it is
+// an existing directory.
+func resolvePinDir(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve directory: %w", err)
+	}
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return "", fmt.Errorf("directory does not exist: %s", absDir)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("not a directory: %s", absDir)
+	}
+	return absDir, nil
+}
+
+// newPin validates the account and the settings shared by every directory
+// being pinned and returns a pin without a directory.
+func newPin(user string, opts pinOptions) (config.Pin, error) {
+	// Validate user is logged in to gh
+	fmt.Printf("Validating account '%s'... ", user)
+	if err := ghauth.ValidateUser(user); err != nil {
+		fmt.Println("FAILED")
+		return config.Pin{}, err
+	}
+	fmt.Println("OK")
+
+	// Validate SSH key exists if specified
+	sshKey := opts.sshKey
+	if sshKey != "" {
+		absKey, err := filepath.Abs(sshKey)
+		if err == nil {
+			sshKey = absKey
+		}
+		if _, err := os.Stat(sshKey); err != nil {
+			return config.Pin{}, fmt.Errorf("SSH key not found: %s", sshKey)
+		}
+	}
+
+	envrcFile, err := config.NormalizeEnvrcFile(opts.envrcFile)
+	if err != nil {
+		return config.Pin{}, err
+	}
+
+	// Check the activation backend is installed
+	if err := checkBackendInstalled(); err != nil {
+		return config.Pin{}, err
+	}
+
+	// Determine mode
+	mode := config.ModeWrapper
+	if opts.exportToken {
+		mode = config.ModeExport
+	}
+
+	// Record the account's host when it is not github.com, so owner
+	// checks compare against the right server.
+	host := opts.host
+	if host == "" {
+		host = lookupUserHost(user)
+	}
+	if host == config.DefaultHost {
+		host = ""
+	}
+
+	return config.Pin{
+		User:     user,
+		Mode:     mode,
+		GitEmail: opts.gitEmail,
+		GitName:  opts.gitName,
+		SSHKey:   sshKey,
+
+		Protected: opts.protected,
+		Host:      host,
+		Orgs:      opts.orgs,
+		Strict:    opts.strict,
+		Indirect:  opts.indirect,
+		EnvrcFile: envrcFile,
+	}, nil
+}
+
+// lookupUserHost returns the host a gh account is logged in to, or "" when
+// it cannot be determined.
+func lookupUserHost(user string) string {
+	users, err := ghauth.ListUsers()
+	if err != nil {
+		return ""
+	}
+	for _, u := range users {
+		if u.User == user {
+			return u.Host
+		}
+	}
+	return ""
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPinFromFile_EmptyList(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	list := filepath.Join(t.TempDir(), "dirs.txt")
+	if err := os.WriteFile(list, []byte("\n# nothing yet\n   \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := NewPinCmd()
+	cmd.SetArgs([]string{"alice", "--from-file", list})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "no directories listed in "+list) {
+		t.Fatalf("expected an empty-list error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".config", "gh-autoprofile", "pins.yml")); !os.IsNotExist(err) {
+		t.Fatalf("expected no pin to be written, stat: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/mdiloreto/gh-autoprofile/internal/gitrepo"
+	"github.com/mdiloreto/gh-autoprofile/internal/wizard"
+)
+
+// runPinWizard asks for the account, git identity, SSH key and mode of a
+// new pin. Values already given as flags are kept and not asked for.
+func runPinWizard(opts pinOptions) (string, pinOptions, error) {
+	p := wizard.NewPrompter(os.Stdin, os.Stdout)
+
+	absDir, err := filepath.Abs(opts.dir)
+	if err != nil {
+		return "", opts, fmt.Errorf("cannot resolve directory: %w", err)
+	}
+	fmt.Printf("Pinning %s\n\n", absDir)
+
+	// Account
+	users, err := ghauth.ListUsers()
+	if err != nil {
+		return "", opts, err
+	}
+	if len(users) == 0 {
+		return "", opts, fmt.Errorf("no gh accounts are logged in. Run: gh auth login")
+	}
+	var labels []string
+	def := 0
+	for i, u := range users {
+		label := fmt.Sprintf("%s (%s)", u.User, u.Host)
+		if u.Active {
+			label += " [active]"
+			def = i
+		}
+		labels = append(labels, label)
+	}
+	i, err := p.Select("GitHub account:", labels, def)
+	if err != nil {
+		return "", opts, err
+	}
+	account := users[i]
+	if opts.host == "" {
+		opts.host = account.Host
+	}
+	fmt.Println()
+
+	// Git identity
+	if opts.gitEmail == "" {
+		if err := askIdentity(p, account, absDir, &opts); err != nil {
+			return "", opts, err
+		}
+		fmt.Println()
+	}
+
+	// SSH key
+	if opts.sshKey == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			keys, _ := wizard.SSHKeys(filepath.Join(home, ".ssh"))
+			if len(keys) > 0 {
+				choice, err := p.Select("SSH key for git over SSH:", append([]string{"(none — use ssh defaults)"}, keys...), 0)
+				if err != nil {
+					return "", opts, err
+				}
+				if choice > 0 {
+					opts.sshKey = keys[choice-1]
+				}
+				fmt.Println()
+			}
+		}
+	}
+
+	// Mode
+	if !opts.exportToken {
+		choice, err := p.Select("Token mode:", []string{
+			"wrapper — the token is injected into each gh/git command and never sits in your shell (recommended)",
+			"export  — GH_TOKEN/GITHUB_TOKEN are exported for tools like Terraform or act; every process you start can read them",
+		}, 0)
+		if err != nil {
+			return "", opts, err
+		}
+		opts.exportToken = choice == 1
+		fmt.Println()
+	}
+
+	return account.User, opts, nil
+}
+
+// askIdentity offers the identities used in the repository's recent commits
+// and the account's public profile, or lets the user type one.
+func askIdentity(p *wizard.Prompter, account ghauth.UserInfo, dir string, opts *pinOptions) error {
+	var candidates []gitrepo.Identity
+	seen := map[string]bool{}
+	add := func(id gitrepo.Identity) {
+		if id.Email == "" || seen[id.Email] {
+			return
+		}
+		seen[id.Email] = true
+		candidates = append(candidates, id)
+	}
+
+	if ids, err := gitrepo.RecentIdentities(dir, 200); err == nil {
+		for _, id := range ids {
+			add(id)
+		}
+	}
+	var profileName string
+	if profile, err := ghauth.GetProfile(account.User, account.Host); err == nil {
+		profileName = profile.Name
+		add(gitrepo.Identity{Name: profile.Name, Email: profile.Email})
+	}
+
+	labels := []string{"(none — keep your git config identity)"}
+	for _, id := range candidates {
+		labels = append(labels, fmt.Sprintf("%s <%s>", id.Name, id.Email))
+	}
+	labels = append(labels, "(enter another)")
+
+	def := 0
+	if len(candidates) > 0 {
+		def = 1
+	}
+	choice, err := p.Select("Git identity for commits:", labels, def)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case choice == 0:
+		return nil
+	case choice <= len(candidates):
+		opts.gitEmail = candidates[choice-1].Email
+		if opts.gitName == "" {
+			opts.gitName = candidates[choice-1].Name
+		}
+	default:
+		if opts.gitEmail, err = p.Input("Git email", ""); err != nil {
+			return err
+		}
+		if opts.gitName == "" {
+			if opts.gitName, err = p.Input("Git name", profileName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/policy"
+	"github.com/spf13/cobra"
+)
+
+// NewPolicyCmd creates the `policy` subcommand and its children.
+func NewPolicyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Show or check the repository's .gh-autoprofile.yml policy",
+		Long: `A repository can commit a .gh-autoprofile.yml declaring what any pin
+inside it must satisfy. Each developer maps it to their own account:
+
+  host: github.com          # host the account must belong to
+  allowed_orgs: [acme]      # the pin must declare one of these with --org
+  email_domain: acme.com    # the pinned git email must use this domain
+
+The direnv library refuses to activate a pin that violates the policy.`,
+	}
+
+	cmd.AddCommand(newPolicyShowCmd(), newPolicyCheckCmd())
+	return cmd
+}
+
+func newPolicyShowCmd() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the policy that applies to a directory and whether its pin complies",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return fmt.Errorf("cannot resolve directory: %w", err)
+			}
+			p, err := policy.Find(absDir)
+			if err != nil {
+				return err
+			}
+			if p == nil {
+				fmt.Printf("No %s found in %s or its parents.\n", policy.FileName, absDir)
+				return nil
+			}
+
+			fmt.Printf("Policy: %s\n", p.Path)
+			if p.Host != "" {
+				fmt.Printf("  Host:          %s\n", p.Host)
+			}
+			if len(p.AllowedOrgs) > 0 {
+				fmt.Printf("  Allowed orgs:  %s\n", strings.Join(p.AllowedOrgs, ", "))
+			}
+			if p.EmailDomain != "" {
+				fmt.Printf("  Email domain:  @%s\n", p.EmailDomain)
+			}
+			fmt.Println()
+
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+			printPolicyDiagnostics(p, registry.ResolvePin(absDir), absDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory to inspect")
+	return cmd
+}
+
+func newPolicyCheckCmd() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:    "check",
+		Short:  "Exit non-zero when the pin for a directory violates its policy (run by the direnv library)",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return fmt.Errorf("cannot resolve directory: %w", err)
+			}
+			p, err := policy.Find(absDir)
+			if err != nil || p == nil {
+				return err
+			}
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+			pin := registry.ResolvePin(absDir)
+			if pin == nil {
+				return nil
+			}
+			return policyError(p, pin)
+		},
+	}
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory whose pin to check")
+	return cmd
+}
+
+// policyError returns an error listing the policy violations of pin, with
+// the pin command that would satisfy the policy, or nil when it complies.
+func policyError(p *policy.Policy, pin *config.Pin) error {
+	violations := p.Check(*pin)
+	if len(violations) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "pin for %s violates %s:\n", pin.Dir, p.Path)
+	for _, v := range violations {
+		fmt.Fprintf(&b, "  - %s\n", v.Message)
+	}
+	fmt.Fprintf(&b, "Fix it with: %s", p.Suggest(*pin, pin.Dir))
+	return fmt.Errorf("%s", b.String())
+}
+
+// printPolicyDiagnostics reports whether the pin resolved for dir satisfies
+// the policy p, suggesting a pin command when it does not.
+func printPolicyDiagnostics(p *policy.Policy, pin *config.Pin, dir string) {
+	if pin == nil {
+		fmt.Printf("  WARNING: %s requires a pin, but this directory has none.\n", p.Path)
+		fmt.Printf("           Pin one with: %s\n", p.Suggest(config.Pin{User: "<user>"}, dir))
+		fmt.Println()
+		return
+	}
+	violations := p.Check(*pin)
+	if len(violations) == 0 {
+		fmt.Printf("  Pin '%s' satisfies %s.\n", pin.User, p.Path)
+		fmt.Println()
+		return
+	}
+	fmt.Printf("  ERROR: pin '%s' violates %s (direnv will not activate it):\n", pin.User, p.Path)
+	for _, v := range violations {
+		fmt.Printf("           - %s\n", v.Message)
+	}
+	fmt.Printf("         Fix it with: %s\n", p.Suggest(*pin, pin.Dir))
+	fmt.Println()
+}
+
+// policyForDir is a convenience for commands that treat an unreadable
+// policy file as a warning rather than a failure.
+func policyForDir(dir string) *policy.Policy {
+	p, err := policy.Find(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	return p
+}
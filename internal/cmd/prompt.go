@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/prompt"
+	"github.com/spf13/cobra"
+)
+
+// NewPromptCmd creates the `prompt` subcommand.
+func NewPromptCmd() *cobra.Command {
+	var format, mismatchFormat string
+	var color bool
+
+	cmd := &cobra.Command{
+		Use:   "prompt",
+		Short: "Print a prompt segment for the active account",
+		Long: `Print a short segment such as gh:bob-work(wrapper) for shell prompts.
+Only the environment and pins.yml are read — no gh calls, no network — so
+it is cheap enough for every prompt. Nothing is printed when no account
+is active and the directory is not pinned.
+
+When the active account or token mode differs from the pin covering the
+directory (direnv did not load the .envrc, another account is active, or
+an account is active outside pinned directories), --mismatch-format is
+used instead, e.g. gh:alice!=bob-work.
+
+Placeholders: {user} active account, {mode} wrapper or export, {pinned}
+pinned account, {state} wrapper, export or mismatch. --color shows
+wrapper mode green, export mode yellow and mismatches red.
+
+The shell hook also defines gh_autoprofile_prompt, which prints the
+segment from the environment alone without starting a process.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var pin *config.Pin
+			if cwd, err := os.Getwd(); err == nil {
+				// An unreadable registry shows the environment alone.
+				if registry, err := config.LoadPins(); err == nil {
+					pin = registry.ResolvePin(cwd)
+				}
+			}
+			info := prompt.Detect(os.Getenv, pin)
+			fmt.Fprint(cmd.OutOrStdout(), info.Render(format, mismatchFormat, color))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", prompt.DefaultFormat, "Segment format")
+	cmd.Flags().StringVar(&mismatchFormat, "mismatch-format", prompt.DefaultMismatchFormat, "Segment format when the active account does not match the pin")
+	cmd.Flags().BoolVar(&color, "color", false, "Colour the segment by state with ANSI escapes")
+	return cmd
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/importer"
+	"github.com/mdiloreto/gh-autoprofile/internal/repair"
+)
+
+// findMovedPins matches pins whose directory vanished with managed .envrc
+// blocks the registry does not know, found under the configured roots,
+// extraRoots and the parents of the stale pins.
+func findMovedPins(registry *config.PinRegistry, extraRoots []string) (stale []config.Pin, res repair.Result, err error) {
+	stale = repair.StalePins(registry)
+	if len(stale) == 0 {
+		return nil, res, nil
+	}
+
+	scan := &config.PinRegistry{Roots: append(append([]string(nil), registry.Roots...), extraRoots...)}
+	envrcs, err := importer.ScanEnvrcs(repair.ScanRoots(scan, stale))
+	if err != nil {
+		return stale, res, err
+	}
+
+	seen := map[string]bool{}
+	var orphans []config.Pin
+	for _, envrc := range envrcs {
+		dir := filepath.Dir(envrc)
+		if seen[dir] || registry.FindPin(dir) != nil {
+			continue
+		}
+		seen[dir] = true
+		pin, ok, err := direnvlib.ReadEnvrcPin(dir)
+		if err != nil || !ok {
+			continue
+		}
+		orphans = append(orphans, pin)
+	}
+	return stale, repair.Match(stale, orphans), nil
+}
+
+// unmatchedIndirect returns the orphaned blocks of indirect pins that were
+// matched with no stale pin, when some stale pin is indirect. Such a block
+// names no account, so only `mv` can say where it came from.
+func unmatchedIndirect(stale []config.Pin, res repair.Result) []config.Pin {
+	staleIndirect := false
+	for _, pin := range stale {
+		staleIndirect = staleIndirect || pin.Indirect
+	}
+	if !staleIndirect {
+		return nil
+	}
+	var pins []config.Pin
+	for _, pin := range res.Unmatched {
+		if pin.User == "" {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
+
+// repairMovedPins re-points stale pins at the directories their managed
+// blocks moved to and reports what it did. The blocks are rewritten for
+// the new path, each through guardGitEnvrc with ifTracked.
+func repairMovedPins(extraRoots []string, ifTracked string) error {
+	unlock, err := config.LockPins()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+	stale, res, err := findMovedPins(registry, extraRoots)
+	if err != nil {
+		return err
+	}
+
+	for _, pin := range res.Ambiguous {
+		if pin.User == "" {
+			fmt.Printf("SKIP %s: indirect block matches several stale indirect pins; use gh autoprofile mv <old-dir> %s\n", pin.Dir, pin.Dir)
+			continue
+		}
+		fmt.Printf("SKIP %s: block for '%s' matches several stale pins; use gh autoprofile mv\n", pin.Dir, pin.User)
+	}
+	for _, pin := range unmatchedIndirect(stale, res) {
+		fmt.Printf("SKIP %s: indirect block names no account and no stale indirect pin lived beside it; use gh autoprofile mv <old-dir> %s\n", pin.Dir, pin.Dir)
+	}
+
+	var change pinChange
+	var moves []repair.Move
+	for _, m := range res.Moves {
+		target := m.From
+		target.Dir = m.To
+		guarded := target
+		var excluded []string
+		if !registry.Native() {
+			if guarded, excluded, err = guardGitEnvrc(target, ifTracked); err != nil {
+				fmt.Printf("SKIP %s: %v\n", m.To, err)
+				continue
+			}
+		}
+		pin, err := registry.MovePin(m.From.Dir, m.To)
+		if err != nil {
+			fmt.Printf("SKIP %s: %v\n", m.To, err)
+			continue
+		}
+		*pin = guarded
+		if guarded.EnvrcName() != target.EnvrcName() {
+			change.removed = append(change.removed, target)
+		}
+		change.written = append(change.written, guarded)
+		change.excluded = append(change.excluded, excluded...)
+		moves = append(moves, m)
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+	if err := commitPins("doctor --fix", registry, change); err != nil {
+		return err
+	}
+	for i, m := range moves {
+		fmt.Printf("MOVED '%s': %s -> %s\n", m.From.User, m.From.Dir, m.To)
+		allowMovedEnvrc(registry, change.written[i])
+	}
+	return nil
+}
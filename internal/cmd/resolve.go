@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/spf13/cobra"
+)
+
+// NewResolveCmd creates the hidden `resolve` subcommand the direnv library
+// runs for `use gh_autoprofile`, the block of an indirect pin. With
+// --native it serves the native backend's shell hook instead.
+func NewResolveCmd() *cobra.Command {
+	var dir string
+	var native bool
+
+	cmd := &cobra.Command{
+		Use:    "resolve",
+		Short:  "Print the direnv commands for the pin of a directory (run by the direnv library)",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			absDir, err := filepath.Abs(dir)
+			if err != nil {
+				return fmt.Errorf("cannot resolve directory: %w", err)
+			}
+			registry, err := config.LoadPins()
+			if err != nil {
+				return fmt.Errorf("cannot load pin registry: %w", err)
+			}
+			if native {
+				return resolveNative(cmd, registry, absDir)
+			}
+			// Exact match only: the .envrc belongs to the pinned directory,
+			// and a parent's pin must not take over a moved one.
+			pin := registry.FindPin(absDir)
+			if pin == nil {
+				return fmt.Errorf("no pin for %s in pins.yml. Run: gh autoprofile pin <user> --dir %s --indirect", absDir, absDir)
+			}
+			pinsPath, err := config.PinsFilePath()
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(cmd.OutOrStdout(), direnvlib.ResolveScript(*pin, pinsPath))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", ".", "Directory whose pin to resolve")
+	cmd.Flags().BoolVar(&native, "native", false, "Print the native shell hook's commands for the pin covering the directory")
+	return cmd
+}
+
+// resolveNative prints the commands that activate the pin covering dir,
+// which may be an ancestor's, as direnv would apply it to subdirectories.
+// It prints nothing when no pin applies, and fails when the pin violates
+// the repository policy, so the hook leaves the account unset.
+func resolveNative(cmd *cobra.Command, registry *config.PinRegistry, dir string) error {
+	pin, err := activePin(cmd, registry, dir)
+	if err != nil || pin == nil {
+		return err
+	}
+	fmt.Fprint(cmd.OutOrStdout(), direnvlib.NativeScript(*pin))
+	return nil
+}
+
+// activePin returns the pin covering dir as it should be activated, or nil
+// when there is none. A pin violating the repository policy is an error;
+// a missing SSH key is left out with a warning.
+func activePin(cmd *cobra.Command, registry *config.PinRegistry, dir string) (*config.Pin, error) {
+	pin := registry.ResolvePin(dir)
+	if pin == nil {
+		return nil, nil
+	}
+	if p := policyForDir(dir); p != nil {
+		if err := policyError(p, pin); err != nil {
+			return nil, err
+		}
+	}
+	active := *pin
+	if active.SSHKey != "" {
+		if _, err := os.Stat(active.SSHKey); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "gh-autoprofile: SSH key not found: %s\n", active.SSHKey)
+			active.SSHKey = ""
+		}
+	}
+	return &active, nil
+}
@@ -3,10 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
 	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/migrate"
 	"github.com/spf13/cobra"
 )
 
@@ -34,7 +34,7 @@ Quick start:
 			if len(os.Args) > 1 {
 				subcmd = os.Args[1]
 			}
-			if subcmd == "setup" || subcmd == "doctor" || subcmd == "help" || subcmd == "completion" {
+			if subcmd == "setup" || subcmd == "doctor" || subcmd == "help" || subcmd == "completion" || subcmd == "guard" || subcmd == "policy" || subcmd == "resolve" || subcmd == "env" || subcmd == "prompt" {
 				return nil
 			}
 			warnUpgradeDrift(cmd)
@@ -45,38 +45,39 @@ Quick start:
 	cmd.AddCommand(
 		NewSetupCmd(),
 		NewPinCmd(),
+		NewEditCmd(),
 		NewUnpinCmd(),
+		NewMvCmd(),
 		NewListCmd(),
 		NewStatusCmd(),
+		NewCheckCmd(),
 		NewDoctorCmd(),
+		NewGuardCmd(),
+		NewImportCmd(),
+		NewExportCmd(),
+		NewPolicyCmd(),
+		NewHistoryCmd(),
+		NewUndoCmd(),
+		NewResolveCmd(),
+		NewEnvCmd(),
+		NewPromptCmd(),
 	)
 
 	return cmd
 }
 
+// warnUpgradeDrift reminds the user to run setup --migrate while pins.yml
+// predates a migration step or shell integration is missing. It runs
+// before most commands, so it only compares the recorded schema version;
+// doctor runs each step's checks to find drift in applied steps.
 func warnUpgradeDrift(cmd *cobra.Command) {
 	registry, err := config.LoadPins()
 	if err != nil {
 		return
 	}
 
-	needsSetup := !direnvlib.IsShellLibInstalled() || !direnvlib.CheckShellHookInstalled()
-	needsModeMigration := false
-	needsEnvrcPerms := false
-
-	for _, pin := range registry.Pins {
-		if pin.Mode == "" {
-			needsModeMigration = true
-		}
-		envrcPath := filepath.Join(pin.Dir, ".envrc")
-		if fi, err := os.Stat(envrcPath); err == nil {
-			if fi.Mode().Perm() != 0600 {
-				needsEnvrcPerms = true
-			}
-		}
-	}
-
-	if !(needsSetup || needsModeMigration || needsEnvrcPerms) {
+	needsSetup := checkBackendInstalled() != nil || !direnvlib.CheckShellHookInstalled()
+	if !needsSetup && registry.Version >= migrate.Latest() {
 		return
 	}
 
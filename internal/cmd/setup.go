@@ -9,6 +9,9 @@ import (
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
 	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
 	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/mdiloreto/gh-autoprofile/internal/history"
+	"github.com/mdiloreto/gh-autoprofile/internal/migrate"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
 	"github.com/spf13/cobra"
 )
 
@@ -25,19 +28,70 @@ func NewSetupCmd() *cobra.Command {
 
 Run this once after installing gh-autoprofile.
 
+Use --backend native on hosts without direnv: the shell hook then looks
+up the pin for the current directory in pins.yml whenever it changes and
+sets or restores the variables itself, and no .envrc files are written.
+Switching backends removes or rewrites the managed .envrc blocks of
+every pin and is recorded in the history. The choice is kept in
+pins.yml; --backend direnv switches back.
+
 Use --migrate after upgrading to refresh generated files,
-repair permissions, and update existing pins to the latest defaults.`,
+repair permissions, and update existing pins to the latest defaults.
+
+Blocks that --backend direnv or --migrate write to a file git could
+commit follow --if-tracked, as with pin: in a terminal you are asked,
+elsewhere the pin is refused unless it says exclude, local, write or
+abort. A refused pin fails the backend switch; the migration skips it
+with a warning.
+
+Use --dry-run to print a diff of every file setup (and --migrate) would
+change and the commands it would run, without writing anything.`,
 		RunE: runSetup,
 	}
 	cmd.Flags().Bool("migrate", false, "Migrate existing pins and rewrite managed .envrc files")
+	cmd.Flags().Bool("dry-run", false, "Show the changes as a diff without writing anything")
+	cmd.Flags().String("backend", "", "How pins are activated: direnv or native (default: the one in pins.yml, else direnv)")
+	cmd.Flags().String("if-tracked", ifTrackedAsk, ifTrackedUsage)
 	return cmd
 }
 
 func runSetup(cmd *cobra.Command, args []string) error {
-	migrate, err := cmd.Flags().GetBool("migrate")
+	doMigrate, err := cmd.Flags().GetBool("migrate")
+	if err != nil {
+		return err
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
 	if err != nil {
 		return err
 	}
+	backendFlag, err := cmd.Flags().GetString("backend")
+	if err != nil {
+		return err
+	}
+	backend, err := config.ParseBackend(backendFlag)
+	if err != nil {
+		return err
+	}
+	ifTracked, err := cmd.Flags().GetString("if-tracked")
+	if err != nil {
+		return err
+	}
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+	if backendFlag == "" {
+		backend = registry.EffectiveBackend()
+	}
+	native := backend == config.BackendNative
+
+	var x plan.Executor = plan.Disk
+	preview := plan.New()
+	done := "OK"
+	if dryRun {
+		x = preview
+		done = "PLANNED"
+	}
 
 	fmt.Println("gh-autoprofile setup")
 	fmt.Println("====================")
@@ -61,7 +115,9 @@ func runSetup(cmd *cobra.Command, args []string) error {
 
 	// 2. Check direnv
 	fmt.Print("  Checking direnv............. ")
-	if !direnvlib.IsInstalled() {
+	if native {
+		fmt.Println("not needed (native backend)")
+	} else if !direnvlib.IsInstalled() {
 		fmt.Println("MISSING")
 		fmt.Println()
 		fmt.Println("  direnv is required. Install it:")
@@ -73,22 +129,24 @@ func runSetup(cmd *cobra.Command, args []string) error {
 		fmt.Println("    bash:  echo 'eval \"$(direnv hook bash)\"' >> ~/.bashrc")
 		fmt.Println("    zsh:   echo 'eval \"$(direnv hook zsh)\"' >> ~/.zshrc")
 		fmt.Println("    fish:  echo 'direnv hook fish | source' >> ~/.config/fish/config.fish")
+		fmt.Println("  Or run setup with --backend native to activate pins without direnv.")
 		return fmt.Errorf("direnv not found")
-	}
-	direnvVersion, _ := direnvlib.GetVersion()
-	fmt.Printf("v%s\n", direnvVersion)
-
-	// 3. Check direnv shell hook
-	fmt.Print("  Checking direnv hook........ ")
-	if direnvlib.CheckDirenvHook() {
-		fmt.Println("OK")
 	} else {
-		fmt.Println("NOT DETECTED")
-		fmt.Println("    Add the direnv hook to your shell config:")
-		fmt.Println("      bash: eval \"$(direnv hook bash)\"")
-		fmt.Println("      zsh:  eval \"$(direnv hook zsh)\"")
-		fmt.Println("      fish: direnv hook fish | source")
-		allGood = false
+		direnvVersion, _ := direnvlib.GetVersion()
+		fmt.Printf("v%s\n", direnvVersion)
+
+		// 3. Check direnv shell hook
+		fmt.Print("  Checking direnv hook........ ")
+		if direnvlib.CheckDirenvHook() {
+			fmt.Println("OK")
+		} else {
+			fmt.Println("NOT DETECTED")
+			fmt.Println("    Add the direnv hook to your shell config:")
+			fmt.Println("      bash: eval \"$(direnv hook bash)\"")
+			fmt.Println("      zsh:  eval \"$(direnv hook zsh)\"")
+			fmt.Println("      fish: direnv hook fish | source")
+			allGood = false
+		}
 	}
 
 	// 4. Check logged-in accounts
@@ -114,26 +172,43 @@ func runSetup(cmd *cobra.Command, args []string) error {
 
 	// 5. Install direnv shell library
 	fmt.Println()
-	fmt.Print("  Installing direnv lib....... ")
-	if err := direnvlib.InstallShellLib(); err != nil {
-		fmt.Println("FAILED")
-		return fmt.Errorf("cannot install shell library: %w", err)
+	if !native {
+		fmt.Print("  Installing direnv lib....... ")
+		if err := direnvlib.InstallShellLibWith(x); err != nil {
+			fmt.Println("FAILED")
+			return fmt.Errorf("cannot install shell library: %w", err)
+		}
+		libPath, _ := direnvlib.ShellLibPath()
+		fmt.Println(done)
+		fmt.Printf("    Installed: %s\n", libPath)
 	}
-	libPath, _ := direnvlib.ShellLibPath()
-	fmt.Println("OK")
-	fmt.Printf("    Installed: %s\n", libPath)
 
-	// 6. Install shell hook (wrapper mode support)
+	// 6. Install shell hook (wrapper mode support, and pin activation
+	// with the native backend)
 	fmt.Print("  Installing shell hook....... ")
-	hookPath, err := direnvlib.InstallShellHook()
+	hookPath, err := direnvlib.InstallShellHookWith(x, backend)
 	if err != nil {
 		fmt.Println("FAILED")
 		return fmt.Errorf("cannot install shell hook: %w", err)
 	}
-	fmt.Println("OK")
+	fmt.Println(done)
 	fmt.Printf("    Installed: %s\n", hookPath)
 
-	// 7. Inject hook source into shell RC file
+	// mise.toml files source this script to activate pins through mise
+	fmt.Print("  Installing mise script...... ")
+	misePath, err := direnvlib.InstallMiseScriptWith(x)
+	if err != nil {
+		fmt.Println("FAILED")
+		return fmt.Errorf("cannot install mise script: %w", err)
+	}
+	fmt.Println(done)
+	fmt.Printf("    Installed: %s\n", misePath)
+
+	// 7. Inject hook source into shell RC file, repairing duplicated or
+	// half-removed hook blocks first
+	if !repairHookBlocks(x, hookPath, done) {
+		allGood = false
+	}
 	fmt.Print("  Configuring shell RC........ ")
 	rcPath, err := detectShellRC()
 	if err != nil {
@@ -146,34 +221,71 @@ func runSetup(cmd *cobra.Command, args []string) error {
 		if direnvlib.CheckShellHookInstalled() {
 			fmt.Println("OK (already configured)")
 		} else {
-			if err := direnvlib.InjectHookSource(rcPath, hookPath); err != nil {
+			if err := direnvlib.InjectHookSourceWith(x, rcPath, hookPath); err != nil {
 				fmt.Println("FAILED")
 				fmt.Printf("    %v\n", err)
 				fmt.Printf("    Add manually to %s:\n", rcPath)
 				fmt.Printf("      source \"%s\"\n", hookPath)
 				allGood = false
 			} else {
-				fmt.Println("OK")
+				fmt.Println(done)
 				fmt.Printf("    Added to: %s\n", rcPath)
 			}
 		}
 	}
 
-	if migrate {
+	// 8. Record the backend and convert the pins' .envrc files. A dry run
+	// converts registry in memory, so the migration preview below sees
+	// the new backend.
+	if current := registry.EffectiveBackend(); backend != current {
+		fmt.Print("  Switching backend.......... ")
+		var converted int
+		if dryRun {
+			converted, err = previewBackend(preview, registry, backend, ifTracked)
+		} else {
+			converted, err = switchBackend(backend, ifTracked)
+		}
+		if err != nil {
+			fmt.Println("FAILED")
+			return fmt.Errorf("cannot switch to the %s backend: %w", backend, err)
+		}
+		fmt.Printf("%s (%s -> %s, %d pin(s) converted)\n", done, current, backend, converted)
+	}
+
+	if doMigrate {
 		fmt.Print("  Running migration.......... ")
-		report, err := runMigration()
+		var outcomes []migrate.Outcome
+		if dryRun {
+			outcomes, err = previewMigration(preview, registry, ifTracked)
+		} else {
+			outcomes, err = runMigration(ifTracked)
+		}
 		if err != nil {
 			fmt.Println("FAILED")
-			fmt.Printf("    %v\n", err)
 			allGood = false
+		} else if len(outcomes) == 0 {
+			fmt.Printf("%s (schema v%d, nothing to do)\n", done, migrate.Latest())
 		} else {
-			fmt.Println("OK")
-			fmt.Printf("    Pins updated: %d, .envrc rewritten: %d, direnv allow: %d\n", report.PinsUpdated, report.EnvrcRewritten, report.Allowed)
-			if report.Warnings > 0 {
-				fmt.Printf("    Warnings: %d (directories missing or not writable)\n", report.Warnings)
+			fmt.Printf("%s (schema v%d)\n", done, migrate.Latest())
+		}
+		for _, o := range outcomes {
+			fmt.Printf("    v%d %s: %s (%d changed)\n", o.Step.Version, o.Step.Name, o.Step.Describe, o.Result.Changed)
+			for _, w := range o.Result.Warnings {
+				fmt.Printf("      warning: %s\n", w)
 				allGood = false
 			}
 		}
+		if err != nil {
+			fmt.Printf("    %v\n", err)
+		}
+	}
+
+	if dryRun {
+		fmt.Println()
+		fmt.Println("Dry run: nothing was written. Planned changes:")
+		fmt.Println()
+		preview.Print(os.Stdout)
+		return nil
 	}
 
 	// Summary
@@ -186,7 +298,7 @@ func runSetup(cmd *cobra.Command, args []string) error {
 		fmt.Println("    wrapper (default)  — token injected per-command, never in env")
 		fmt.Println("    export             — GH_TOKEN exported (use --export-token flag)")
 		fmt.Println()
-		if migrate {
+		if doMigrate {
 			fmt.Println("  Migration complete.")
 		}
 		fmt.Println("  Restart your shell or run: source " + rcPath)
@@ -199,65 +311,74 @@ func runSetup(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-type migrationReport struct {
-	PinsUpdated    int
-	EnvrcRewritten int
-	Allowed        int
-	Warnings       int
-}
-
-func runMigration() (migrationReport, error) {
-	var report migrationReport
+// runMigration applies the pending migration steps to the pin registry
+// and records the reached schema version in pins.yml. Blocks it rewrites
+// go through guardGitEnvrc with ifTracked.
+func runMigration(ifTracked string) ([]migrate.Outcome, error) {
+	unlock, err := config.LockPins()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	registry, err := config.LoadPins()
 	if err != nil {
-		return report, fmt.Errorf("cannot load pin registry: %w", err)
+		return nil, fmt.Errorf("cannot load pin registry: %w", err)
 	}
 
-	configDir, err := config.ConfigDir()
-	if err == nil {
-		_ = os.Chmod(configDir, 0700)
+	rec, err := history.Begin("setup --migrate")
+	if err != nil {
+		return nil, err
 	}
-	if pinsPath, err := config.PinsFilePath(); err == nil {
-		if _, statErr := os.Stat(pinsPath); statErr == nil {
-			_ = os.Chmod(pinsPath, 0600)
+	defer commitHistory(rec)
+	for _, pin := range registry.Pins {
+		if err := rec.CapturePin(pin); err != nil {
+			return nil, err
 		}
 	}
 
-	updatedMode := 0
-	for i := range registry.Pins {
-		if registry.Pins[i].Mode == "" {
-			registry.Pins[i].Mode = config.ModeWrapper
-			updatedMode++
-		}
+	outcomes, runErr := migrate.Run(registry, plan.Disk, migrationGuard(ifTracked, rec))
+	if err := config.SavePins(registry); err != nil {
+		return outcomes, fmt.Errorf("cannot save migrated pins: %w", err)
 	}
-	if updatedMode > 0 {
-		if err := config.SavePins(registry); err != nil {
-			return report, fmt.Errorf("cannot save migrated pins: %w", err)
-		}
+	return outcomes, runErr
+}
+
+// previewMigration records in p what runMigration would change, starting
+// from registry and the changes already in p.
+func previewMigration(p *plan.Plan, registry *config.PinRegistry, ifTracked string) ([]migrate.Outcome, error) {
+	outcomes, err := migrate.Run(registry, p, migrationGuard(ifTracked, nil))
+	if err != nil {
+		return outcomes, err
 	}
-	report.PinsUpdated = updatedMode
+	if err := planPinsFile(p, registry); err != nil {
+		return outcomes, err
+	}
+	return outcomes, nil
+}
 
-	for _, pin := range registry.Pins {
-		if _, err := os.Stat(pin.Dir); err != nil {
-			report.Warnings++
+// repairHookBlocks rewrites shell RC files whose hook block is malformed
+// and reports false if one could not be repaired.
+func repairHookBlocks(x plan.Executor, hookPath, done string) bool {
+	ok := true
+	for _, rc := range direnvlib.ShellRCFiles() {
+		problems, err := direnvlib.CheckHookSource(rc)
+		if err != nil || len(problems) == 0 {
 			continue
 		}
-
-		if err := direnvlib.WriteEnvrc(pin); err != nil {
-			report.Warnings++
+		fmt.Print("  Repairing hook block........ ")
+		if err := direnvlib.RepairHookSourceWith(x, rc, hookPath); err != nil {
+			fmt.Println("FAILED")
+			fmt.Printf("    %v\n", err)
+			ok = false
 			continue
 		}
-		report.EnvrcRewritten++
-
-		if err := direnvlib.AllowEnvrc(pin.Dir); err != nil {
-			report.Warnings++
-			continue
+		fmt.Println(done)
+		for _, p := range problems {
+			fmt.Printf("    %s %v\n", rc, p)
 		}
-		report.Allowed++
 	}
-
-	return report, nil
+	return ok
 }
 
 // detectShellRC finds the user's active shell RC file.
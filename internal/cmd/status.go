@@ -3,10 +3,12 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
 	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
 	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/mdiloreto/gh-autoprofile/internal/gitrepo"
 	"github.com/spf13/cobra"
 )
 
@@ -17,7 +19,12 @@ func NewStatusCmd() *cobra.Command {
 		Short: "Show the active profile context for the current directory",
 		Long: `Display the current directory's pinned account, token mode,
 active environment variables, and any mismatches between expected
-and actual state.`,
+and actual state.
+
+The active gh account is read from gh's hosts.yml, so status runs no
+network requests. Whether the gh()/git() wrappers are defined in the
+calling shell is taken from the GH_AUTOPROFILE_WRAPPED marker the shell
+hook exports alongside them.`,
 		RunE: runStatus,
 	}
 }
@@ -52,6 +59,21 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		if pin.SSHKey != "" {
 			fmt.Printf("  Pinned SSH key:   %s\n", pin.SSHKey)
 		}
+		if pin.Protected {
+			fmt.Println("  Protected:        yes (push/merge/delete require confirmation)")
+		}
+		if pin.Host != "" {
+			fmt.Printf("  Pinned host:      %s\n", pin.Host)
+		}
+		if len(pin.Orgs) > 0 {
+			fmt.Printf("  Pinned orgs:      %s\n", strings.Join(pin.Orgs, ", "))
+		}
+		if pin.Indirect {
+			fmt.Println("  Indirect:         yes (resolved from pins.yml)")
+		}
+		if remote, err := gitrepo.OriginRemote(cwd); err == nil {
+			fmt.Printf("  Origin remote:    %s\n", remote)
+		}
 	} else {
 		fmt.Println("  Pinned account:   (none)")
 	}
@@ -64,6 +86,7 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	gitEmail := os.Getenv("GIT_AUTHOR_EMAIL")
 	gitName := os.Getenv("GIT_AUTHOR_NAME")
 	gitSSH := os.Getenv("GIT_SSH_COMMAND")
+	wrapped := wrappedCommands()
 
 	fmt.Println("  Environment:")
 	if autoprofileUser != "" {
@@ -96,11 +119,19 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	if gitSSH != "" {
 		fmt.Printf("    GIT_SSH_COMMAND:      %s\n", gitSSH)
 	}
+	if os.Getenv("GH_AUTOPROFILE_PROTECTED") != "" {
+		fmt.Println("    GH_AUTOPROFILE_PROTECTED: 1")
+	}
+	if len(wrapped) > 0 {
+		fmt.Printf("    Wrappers:             active (%s)\n", strings.Join(wrapped, ", "))
+	} else {
+		fmt.Println("    Wrappers:             not active in this shell")
+	}
 	fmt.Println()
 
-	// Active gh user (from gh auth status, not env)
+	// Active gh user (from gh's hosts.yml, not env)
 	fmt.Print("  Active gh user:   ")
-	users, err := ghauth.ListUsers()
+	users, err := localUsers()
 	if err != nil {
 		fmt.Printf("(error: %v)\n", err)
 	} else {
@@ -119,14 +150,21 @@ func runStatus(cmd *cobra.Command, args []string) error {
 
 	// Diagnostics
 	fmt.Println()
+	if p := policyForDir(cwd); p != nil {
+		printPolicyDiagnostics(p, registry.ResolvePin(cwd), cwd)
+	}
 	if pin != nil {
+		printOwnerDiagnostics(pin, cwd)
 		mode := pin.EffectiveMode()
 		if mode == config.ModeWrapper {
 			// Wrapper mode: expect GH_AUTOPROFILE_USER set, GH_TOKEN NOT set
 			if autoprofileUser == "" {
 				fmt.Println("  WARNING: Directory is pinned (wrapper mode) but GH_AUTOPROFILE_USER is not set.")
-				fmt.Println("           Is direnv loaded? Try: cd . (to re-trigger direnv)")
-				printDirenvDiagnostics()
+				printActivationDiagnostics(registry)
+			} else if len(wrapped) == 0 {
+				fmt.Println("  WARNING: GH_AUTOPROFILE_USER is set but the gh()/git() wrappers are not defined")
+				fmt.Println("           in this shell, so gh and git use the default account.")
+				fmt.Println("           Is the shell hook sourced? Run: gh autoprofile setup, then restart the shell.")
 			} else if ghToken != "" {
 				fmt.Println("  NOTE: Wrapper mode is active but GH_TOKEN is also set in the environment.")
 				fmt.Println("        The wrapper functions will override it per-command.")
@@ -137,8 +175,14 @@ func runStatus(cmd *cobra.Command, args []string) error {
 			// Export mode: expect GH_TOKEN set
 			if ghToken == "" {
 				fmt.Println("  WARNING: Directory is pinned (export mode) but GH_TOKEN is not set.")
-				fmt.Println("           Is direnv loaded? Try: cd . (to re-trigger direnv)")
-				printDirenvDiagnostics()
+				printActivationDiagnostics(registry)
+			} else if pin.Protected || len(pin.Orgs) > 0 || pin.Strict {
+				if len(wrapped) == 0 {
+					fmt.Println("  WARNING: Profile is active (export mode) but the guard wrappers are not defined")
+					fmt.Println("           in this shell, so pushes are not checked. Is the shell hook sourced?")
+				} else {
+					fmt.Println("  Profile is active (export mode). GH_TOKEN is in the environment; pushes are guarded.")
+				}
 			} else {
 				fmt.Println("  Profile is active (export mode). GH_TOKEN is in the environment.")
 			}
@@ -153,7 +197,61 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func printDirenvDiagnostics() {
+// wrappedCommands returns the commands the shell hook reports wrapping in
+// the calling shell (GH_AUTOPROFILE_WRAPPED).
+func wrappedCommands() []string {
+	var cmds []string
+	for _, c := range strings.Split(os.Getenv("GH_AUTOPROFILE_WRAPPED"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+// localUsers lists gh accounts from hosts.yml, falling back to
+// `gh auth status` when the file cannot be read.
+func localUsers() ([]ghauth.UserInfo, error) {
+	if users, err := ghauth.ReadHosts(); err == nil {
+		return users, nil
+	}
+	return ghauth.ListUsers()
+}
+
+// printOwnerDiagnostics warns when the origin remote of the repository in
+// dir is owned by neither the pinned account nor one of its orgs.
+func printOwnerDiagnostics(pin *config.Pin, dir string) {
+	remote, err := gitrepo.OriginRemote(dir)
+	if err != nil || pin.OwnerMatches(remote.Host, remote.Owner) {
+		return
+	}
+
+	allowed := append([]string{pin.User}, pin.Orgs...)
+	label := "WARNING"
+	if pin.Strict {
+		label = "ERROR"
+	}
+	fmt.Printf("  %s: origin is %s/%s but the pin allows %s on %s.\n",
+		label, remote.Host, remote.Owner, strings.Join(allowed, ", "), pin.EffectiveHost())
+	if pin.Strict {
+		fmt.Println("         Pushes from this directory will be refused (strict pin).")
+	} else {
+		fmt.Println("         Check the pin, or add the owner with: gh autoprofile pin <user> --org <owner>")
+	}
+	fmt.Println()
+}
+
+// printActivationDiagnostics suggests why the pin of the directory is not
+// active, for the backend of registry.
+func printActivationDiagnostics(registry *config.PinRegistry) {
+	if registry.Native() {
+		fmt.Println("           Is the native hook loaded? Try: gh_autoprofile_reload")
+		if !direnvlib.NativeHookInstalled() || !direnvlib.CheckShellHookInstalled() {
+			fmt.Println("           Native shell hook not installed. Run: gh autoprofile setup --backend native")
+		}
+		return
+	}
+	fmt.Println("           Is direnv loaded? Try: cd . (to re-trigger direnv)")
 	if !direnvlib.IsInstalled() {
 		fmt.Println("           direnv is not installed!")
 	} else if !direnvlib.IsShellLibInstalled() {
@@ -2,31 +2,55 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
-	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
 	"github.com/spf13/cobra"
 )
 
 // NewUnpinCmd creates the `unpin` subcommand.
 func NewUnpinCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "unpin [directory]",
-		Short: "Remove a pinned account from a directory",
+	var user string
+	var missing, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "unpin [directory...]",
+		Short: "Remove pinned accounts from directories",
 		Long: `Remove the gh-autoprofile block from the directory's .envrc and
 delete the pin from the registry. If the .envrc has no other content,
 it will be deleted entirely.
 
+Several pins can be removed at once: list directories, remove every pin
+of an account with --user, or prune pins whose directory no longer exists
+with --missing. If writing the .envrc files or the registry fails, all
+changes are rolled back.
+
+Use --dry-run to print a diff of pins.yml and every .envrc that would
+change without writing anything.
+
 Examples:
   gh autoprofile unpin              # unpin current directory
-  gh autoprofile unpin ~/carto      # unpin specific directory`,
-		Args: cobra.MaximumNArgs(1),
-		RunE: runUnpin,
+  gh autoprofile unpin ~/carto      # unpin specific directory
+  gh autoprofile unpin ~/a ~/b      # unpin several directories
+  gh autoprofile unpin --user bob-work
+  gh autoprofile unpin --missing`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if user == "" && !missing && len(args) <= 1 {
+				return runUnpin(args, dryRun)
+			}
+			return runUnpinBulk(args, user, missing, dryRun)
+		},
 	}
+
+	cmd.Flags().StringVar(&user, "user", "", "Remove every pin of this account")
+	cmd.Flags().BoolVar(&missing, "missing", false, "Remove pins whose directory no longer exists")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes as a diff without writing anything")
+	return cmd
 }
 
-func runUnpin(cmd *cobra.Command, args []string) error {
+func runUnpin(args []string, dryRun bool) error {
 	dir := "."
 	if len(args) > 0 {
 		dir = args[0]
@@ -38,6 +62,14 @@ func runUnpin(cmd *cobra.Command, args []string) error {
 	}
 
 	// Load registry
+	if !dryRun {
+		unlock, err := config.LockPins()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	registry, err := config.LoadPins()
 	if err != nil {
 		return fmt.Errorf("cannot load pin registry: %w", err)
@@ -49,19 +81,97 @@ func runUnpin(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no pin found for directory: %s", absDir)
 	}
 
+	removed := *pin
 	user := pin.User
-
-	// Remove from registry
-	registry.RemovePin(absDir)
-	if err := config.SavePins(registry); err != nil {
-		return fmt.Errorf("cannot save pin registry: %w", err)
+	if dryRun {
+		registry.RemovePin(absDir)
+		return previewPins(plan.New(), registry, pinChange{removed: []config.Pin{removed}})
 	}
 
-	// Remove .envrc block
-	if err := direnvlib.RemoveEnvrc(absDir); err != nil {
-		return fmt.Errorf("cannot clean .envrc: %w", err)
+	// Remove the .envrc block, then the pin; a malformed block leaves
+	// both in place.
+	registry.RemovePin(absDir)
+	if err := commitPins("unpin", registry, pinChange{removed: []config.Pin{removed}}); err != nil {
+		return err
 	}
 
 	fmt.Printf("Unpinned '%s' from %s\n", user, absDir)
 	return nil
 }
+
+// runUnpinBulk removes the pins for the listed directories, every pin of
+// user and, with missing, every pin whose directory is gone.
+func runUnpinBulk(dirs []string, user string, missing, dryRun bool) error {
+	if !dryRun {
+		unlock, err := config.LockPins()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	registry, err := config.LoadPins()
+	if err != nil {
+		return fmt.Errorf("cannot load pin registry: %w", err)
+	}
+
+	var report bulkReport
+	targets := map[string]bool{}
+	var order []config.Pin
+	add := func(pin config.Pin) {
+		if !targets[pin.Dir] {
+			targets[pin.Dir] = true
+			order = append(order, pin)
+		}
+	}
+
+	for _, dir := range dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			report.skip(dir, err)
+			continue
+		}
+		pin := registry.FindPin(absDir)
+		if pin == nil {
+			report.skip(absDir, fmt.Errorf("not pinned"))
+			continue
+		}
+		add(*pin)
+	}
+	for _, pin := range registry.Pins {
+		if user != "" && pin.User == user {
+			add(pin)
+		}
+		if missing {
+			if _, err := os.Stat(pin.Dir); os.IsNotExist(err) {
+				add(pin)
+			}
+		}
+	}
+
+	if len(order) == 0 {
+		return report.print("Unpinned")
+	}
+
+	for _, pin := range order {
+		registry.RemovePin(pin.Dir)
+	}
+	if dryRun {
+		for _, pin := range order {
+			report.ok("UNPIN", pin.Dir, fmt.Sprintf(" ('%s')", pin.User))
+		}
+		return previewPins(plan.New(), registry, pinChange{removed: order})
+	}
+	if err := commitPins("unpin", registry, pinChange{removed: order}); err != nil {
+		return err
+	}
+
+	for _, pin := range order {
+		detail := ""
+		if _, err := os.Stat(pin.Dir); os.IsNotExist(err) {
+			detail = " (directory missing)"
+		}
+		report.ok("UNPIN", pin.Dir, fmt.Sprintf(" ('%s')%s", pin.User, detail))
+	}
+	return report.print("Unpinned")
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+// TestUnpin_Concurrent runs unpin in parallel: each run loads pins.yml,
+// drops one pin and saves it, so without the registry lock some runs
+// would write back pins that another had already removed.
+func TestUnpin_Concurrent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("advisory locks are not implemented on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	const workers = 20
+	registry := &config.PinRegistry{}
+	var dirs []string
+	for i := 0; i < workers; i++ {
+		dir := filepath.Join(home, fmt.Sprintf("repo-%02d", i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		registry.AddPin(config.Pin{User: "bot", Dir: dir, Mode: config.ModeWrapper})
+		dirs = append(dirs, dir)
+	}
+	if err := config.SavePins(registry); err != nil {
+		t.Fatalf("SavePins failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for _, dir := range dirs {
+		wg.Add(1)
+		go func(dir string) {
+			defer wg.Done()
+			cmd := NewUnpinCmd()
+			cmd.SetArgs([]string{dir})
+			errs <- cmd.Execute()
+		}(dir)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unpin failed: %v", err)
+		}
+	}
+
+	loaded, err := config.LoadPins()
+	if err != nil {
+		t.Fatalf("LoadPins failed: %v", err)
+	}
+	if len(loaded.Pins) != 0 {
+		t.Errorf("expected every pin removed, %d left: %+v", len(loaded.Pins), loaded.Pins)
+	}
+}
+
+func TestUnpinBulk_FailsWhenSkipping(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("PATH", t.TempDir()) // no direnv
+
+	pinned := filepath.Join(home, "pinned")
+	if err := os.MkdirAll(pinned, 0755); err != nil {
+		t.Fatal(err)
+	}
+	registry := &config.PinRegistry{}
+	registry.AddPin(config.Pin{User: "bot", Dir: pinned, Mode: config.ModeWrapper})
+	if err := config.SavePins(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runUnpinBulk(nil, "nobody", false, false); err == nil {
+		t.Error("expected an error when --user matches no pin")
+	}
+	if err := runUnpinBulk([]string{pinned, filepath.Join(home, "unpinned")}, "", false, false); err == nil {
+		t.Error("expected an error when a directory is skipped")
+	}
+	loaded, err := config.LoadPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Pins) != 0 {
+		t.Errorf("expected the pinned directory unpinned despite the skip, got %+v", loaded.Pins)
+	}
+}
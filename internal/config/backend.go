@@ -0,0 +1,45 @@
+package config
+
+import "fmt"
+
+// Backend selects how a pin is activated when the shell enters its
+// directory.
+type Backend string
+
+const (
+	// BackendDirenv (default) writes a managed block to each pinned
+	// directory's .envrc and lets direnv load and unload it.
+	BackendDirenv Backend = "direnv"
+
+	// BackendNative needs no direnv and writes no .envrc: the shell hook
+	// asks `gh autoprofile resolve --native` for the pin of $PWD whenever
+	// the directory changes and sets or restores the variables itself.
+	BackendNative Backend = "native"
+)
+
+// ParseBackend validates a backend name; "" means BackendDirenv.
+func ParseBackend(s string) (Backend, error) {
+	switch b := Backend(s); b {
+	case "":
+		return BackendDirenv, nil
+	case BackendDirenv, BackendNative:
+		return b, nil
+	}
+	return "", fmt.Errorf("invalid backend %q (use direnv or native)", s)
+}
+
+// EffectiveBackend returns the registry's activation backend. An invalid
+// value falls back to BackendDirenv, which keeps existing .envrc files.
+func (r *PinRegistry) EffectiveBackend() Backend {
+	b, err := ParseBackend(string(r.Backend))
+	if err != nil {
+		return BackendDirenv
+	}
+	return b
+}
+
+// Native reports whether the registry uses the native backend, so no
+// .envrc files are written for its pins.
+func (r *PinRegistry) Native() bool {
+	return r.EffectiveBackend() == BackendNative
+}
@@ -0,0 +1,20 @@
+package config
+
+import "testing"
+
+func TestPinRegistry_EffectiveBackend(t *testing.T) {
+	for value, want := range map[Backend]Backend{
+		"":       BackendDirenv,
+		"direnv": BackendDirenv,
+		"native": BackendNative,
+		"fish":   BackendDirenv,
+	} {
+		r := &PinRegistry{Backend: value}
+		if got := r.EffectiveBackend(); got != want {
+			t.Errorf("EffectiveBackend(%q) = %q, want %q", value, got, want)
+		}
+	}
+	if _, err := ParseBackend("fish"); err == nil {
+		t.Error("ParseBackend accepted an unknown backend")
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FieldChange is one differing field between two versions of a pin.
+// Field uses the pins.yml key; empty values mean "unset".
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// DiffPins lists the fields that differ between before and after, in
+// pins.yml order.
+func DiffPins(before, after Pin) []FieldChange {
+	a, b := pinFields(before), pinFields(after)
+	var changes []FieldChange
+	for i := range a {
+		if a[i][1] != b[i][1] {
+			changes = append(changes, FieldChange{Field: a[i][0], Old: a[i][1], New: b[i][1]})
+		}
+	}
+	return changes
+}
+
+// pinFields returns the pin's fields as (key, value) pairs for display.
+func pinFields(p Pin) [][2]string {
+	boolValue := func(v bool) string {
+		if !v {
+			return ""
+		}
+		return strconv.FormatBool(v)
+	}
+	return [][2]string{
+		{"user", p.User},
+		{"dir", p.Dir},
+		{"mode", string(p.EffectiveMode())},
+		{"git_email", p.GitEmail},
+		{"git_name", p.GitName},
+		{"ssh_key", p.SSHKey},
+		{"protected", boolValue(p.Protected)},
+		{"host", p.Host},
+		{"orgs", strings.Join(p.Orgs, ",")},
+		{"strict", boolValue(p.Strict)},
+		{"indirect", boolValue(p.Indirect)},
+		{"envrc_file", p.EnvrcFile},
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+// PermissionPolicy controls the file mode of managed .envrc files.
+type PermissionPolicy string
+
+const (
+	// PermAuto (default) keeps the mode of an existing .envrc for
+	// wrapper-mode pins, whose block holds no secrets, and removes group
+	// and other access for export-mode pins, whose .envrc puts the token
+	// into the environment. New files are created 0600.
+	PermAuto PermissionPolicy = "auto"
+
+	// PermStrict writes every managed .envrc 0600.
+	PermStrict PermissionPolicy = "strict"
+
+	// PermPreserve never changes the mode of an existing .envrc and
+	// creates new ones 0644, e.g. for .envrc files committed to git.
+	PermPreserve PermissionPolicy = "preserve"
+)
+
+// ParsePermissionPolicy validates a policy name; "" means PermAuto.
+func ParsePermissionPolicy(s string) (PermissionPolicy, error) {
+	switch p := PermissionPolicy(s); p {
+	case "":
+		return PermAuto, nil
+	case PermAuto, PermStrict, PermPreserve:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid envrc_permissions %q (use auto, strict or preserve)", s)
+}
+
+// PermissionPolicy returns the registry's .envrc permission policy. An
+// invalid value falls back to PermStrict, the safest choice.
+func (r *PinRegistry) PermissionPolicy() PermissionPolicy {
+	p, err := ParsePermissionPolicy(string(r.EnvrcPermissions))
+	if err != nil {
+		return PermStrict
+	}
+	return p
+}
+
+// EnvrcPerm returns the mode to write an .envrc with for a pin in mode.
+// current is the mode of the existing file; exists is false for a new
+// file.
+func (p PermissionPolicy) EnvrcPerm(mode PinMode, current os.FileMode, exists bool) os.FileMode {
+	switch {
+	case p == PermStrict:
+		return 0600
+	case !exists && p == PermPreserve:
+		return 0644
+	case !exists:
+		return 0600
+	case p == PermAuto && mode == ModeExport:
+		return current &^ 0077
+	}
+	return current
+}
+
+// UnmanagedPerm returns the mode to write an .envrc with once its managed
+// block was removed.
+func (p PermissionPolicy) UnmanagedPerm(current os.FileMode) os.FileMode {
+	if p == PermStrict {
+		return 0600
+	}
+	return current
+}
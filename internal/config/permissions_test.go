@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPermissionPolicy_EnvrcPerm(t *testing.T) {
+	tests := []struct {
+		policy  PermissionPolicy
+		mode    PinMode
+		current os.FileMode
+		exists  bool
+		want    os.FileMode
+	}{
+		{PermAuto, ModeWrapper, 0644, true, 0644},
+		{PermAuto, ModeWrapper, 0664, true, 0664},
+		{PermAuto, ModeExport, 0664, true, 0600},
+		{PermAuto, ModeExport, 0700, true, 0700},
+		{PermAuto, ModeWrapper, 0, false, 0600},
+		{PermStrict, ModeWrapper, 0644, true, 0600},
+		{PermStrict, ModeWrapper, 0, false, 0600},
+		{PermPreserve, ModeExport, 0644, true, 0644},
+		{PermPreserve, ModeWrapper, 0, false, 0644},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.EnvrcPerm(tt.mode, tt.current, tt.exists); got != tt.want {
+			t.Errorf("%s.EnvrcPerm(%s, %04o, %v) = %04o, want %04o", tt.policy, tt.mode, tt.current, tt.exists, got, tt.want)
+		}
+	}
+}
+
+func TestPinRegistry_PermissionPolicy(t *testing.T) {
+	for value, want := range map[PermissionPolicy]PermissionPolicy{
+		"":         PermAuto,
+		"preserve": PermPreserve,
+		"strict":   PermStrict,
+		"0644":     PermStrict,
+	} {
+		r := &PinRegistry{EnvrcPermissions: value}
+		if got := r.PermissionPolicy(); got != want {
+			t.Errorf("PermissionPolicy(%q) = %q, want %q", value, got, want)
+		}
+	}
+	if _, err := ParsePermissionPolicy("loose"); err == nil {
+		t.Error("ParsePermissionPolicy accepted an unknown policy")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,6 +34,96 @@ type Pin struct {
 	GitEmail string  `yaml:"git_email,omitempty"`
 	GitName  string  `yaml:"git_name,omitempty"`
 	SSHKey   string  `yaml:"ssh_key,omitempty"`
+
+	// Protected marks a sensitive account (e.g. an org admin). The shell
+	// hook asks for confirmation before pushes and destructive gh
+	// operations made with it.
+	Protected bool `yaml:"protected,omitempty"`
+
+	// Host is the GitHub host the account belongs to (empty = github.com).
+	Host string `yaml:"host,omitempty"`
+
+	// Orgs lists organisations the account may push to in addition to
+	// its own namespace. Strict turns owner mismatches into refusals.
+	Orgs   []string `yaml:"orgs,omitempty"`
+	Strict bool     `yaml:"strict,omitempty"`
+
+	// Indirect keeps the pin's settings out of .envrc: the managed block
+	// is a single `use gh_autoprofile` line and direnv resolves the pin
+	// from this registry by directory when it loads the file.
+	Indirect bool `yaml:"indirect,omitempty"`
+
+	// EnvrcFile names the file, relative to Dir, that holds the managed
+	// block; empty means .envrc. Any other file (e.g. an .envrc.local
+	// kept out of git) is loaded from .envrc with source_env_if_exists.
+	EnvrcFile string `yaml:"envrc_file,omitempty"`
+}
+
+// DefaultEnvrcFile is the file direnv loads in a directory.
+const DefaultEnvrcFile = ".envrc"
+
+// EnvrcName returns the file, relative to Dir, holding the managed block.
+func (p *Pin) EnvrcName() string {
+	if p.EnvrcFile == "" {
+		return DefaultEnvrcFile
+	}
+	return p.EnvrcFile
+}
+
+// NormalizeEnvrcFile validates a file name given for EnvrcFile and returns
+// it cleaned, or "" for .envrc itself. The file must lie inside the pinned
+// directory and be a direnv script: dotenv files (.env, .env.*) are loaded
+// with dotenv and cannot run the gh-autoprofile functions.
+func NormalizeEnvrcFile(name string) (string, error) {
+	clean := filepath.Clean(name)
+	switch {
+	case name == "" || clean == DefaultEnvrcFile:
+		return "", nil
+	case filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)):
+		return "", fmt.Errorf("envrc file %q must be a path inside the pinned directory", name)
+	}
+	if base := filepath.Base(clean); base == ".env" || strings.HasPrefix(base, ".env.") {
+		return "", fmt.Errorf("envrc file %q is a dotenv file; direnv loads those with dotenv, which cannot run gh-autoprofile", name)
+	}
+	return clean, nil
+}
+
+// ManagedFiles returns the paths of the files gh-autoprofile writes for
+// the pin: the .envrc and, when the block lives elsewhere, that file.
+func (p *Pin) ManagedFiles() []string {
+	files := []string{filepath.Join(p.Dir, DefaultEnvrcFile)}
+	if name := p.EnvrcName(); name != DefaultEnvrcFile {
+		files = append(files, filepath.Join(p.Dir, name))
+	}
+	return files
+}
+
+// DefaultHost is the GitHub host assumed when a pin has none recorded.
+const DefaultHost = "github.com"
+
+// EffectiveHost returns the pin's host, defaulting to github.com.
+func (p *Pin) EffectiveHost() string {
+	if p.Host == "" {
+		return DefaultHost
+	}
+	return p.Host
+}
+
+// OwnerMatches reports whether a repository owned by owner on host belongs
+// to the pinned account or one of its configured orgs.
+func (p *Pin) OwnerMatches(host, owner string) bool {
+	if !strings.EqualFold(host, p.EffectiveHost()) {
+		return false
+	}
+	if strings.EqualFold(owner, p.User) {
+		return true
+	}
+	for _, org := range p.Orgs {
+		if strings.EqualFold(owner, org) {
+			return true
+		}
+	}
+	return false
 }
 
 // EffectiveMode returns the pin's mode, defaulting to ModeWrapper.
@@ -42,8 +134,32 @@ func (p *Pin) EffectiveMode() PinMode {
 	return p.Mode
 }
 
+// SchemaVersion is the pins.yml schema written by this release. Registries
+// with a lower version have migrations pending (see package migrate).
+const SchemaVersion = 6
+
 // PinRegistry holds all directory pins.
 type PinRegistry struct {
+	// Version is the schema version of the registry; 0 for files written
+	// before versioning was introduced.
+	Version int `yaml:"version,omitempty"`
+
+	// Roots lists directories that `doctor --fix` scans for managed .envrc
+	// files whose pins went stale after a move or rename.
+	Roots []string `yaml:"roots,omitempty"`
+
+	// Backend is how pins are activated (see Backend); empty means
+	// direnv.
+	Backend Backend `yaml:"backend,omitempty"`
+
+	// EnvrcFile is the file new pins write their block to, relative to
+	// the pinned directory (see Pin.EnvrcFile); empty means .envrc.
+	EnvrcFile string `yaml:"envrc_file,omitempty"`
+
+	// EnvrcPermissions is the permission policy of managed .envrc files
+	// (see PermissionPolicy); empty means auto.
+	EnvrcPermissions PermissionPolicy `yaml:"envrc_permissions,omitempty"`
+
 	Pins []Pin `yaml:"pins"`
 }
 
@@ -71,7 +187,7 @@ func PinsFilePath() (string, error) {
 }
 
 // LoadPins reads the pin registry from disk.
-// Returns an empty registry if the file doesn't exist.
+// Returns an empty, current-version registry if the file doesn't exist.
 func LoadPins() (*PinRegistry, error) {
 	path, err := PinsFilePath()
 	if err != nil {
@@ -81,7 +197,8 @@ func LoadPins() (*PinRegistry, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return &PinRegistry{}, nil
+			// A new registry has nothing to migrate.
+			return &PinRegistry{Version: SchemaVersion}, nil
 		}
 		return nil, fmt.Errorf("cannot read pins file: %w", err)
 	}
@@ -105,12 +222,39 @@ func SavePins(registry *PinRegistry) error {
 		return fmt.Errorf("cannot create config directory %s: %w", dir, err)
 	}
 
+	data, err := MarshalPins(registry)
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(path, data, 0600)
+}
+
+// MarshalPins returns the pins.yml content SavePins writes for registry.
+func MarshalPins(registry *PinRegistry) ([]byte, error) {
 	data, err := yaml.Marshal(registry)
 	if err != nil {
-		return fmt.Errorf("cannot marshal pins: %w", err)
+		return nil, fmt.Errorf("cannot marshal pins: %w", err)
 	}
+	return data, nil
+}
 
-	return os.WriteFile(path, data, 0600)
+// LockPins takes the registry's advisory lock, blocking until concurrent
+// gh-autoprofile processes release it. Hold it across LoadPins and
+// SavePins so read-modify-write cycles do not lose each other's pins.
+func LockPins() (unlock func(), err error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create config directory %s: %w", dir, err)
+	}
+	lock, err := fsutil.LockFile(filepath.Join(dir, "pins.yml.lock"))
+	if err != nil {
+		return nil, err
+	}
+	return func() { lock.Unlock() }, nil
 }
 
 // FindPin returns the pin for a given directory, or nil if not found.
@@ -127,6 +271,26 @@ func (r *PinRegistry) FindPin(dir string) *Pin {
 	return nil
 }
 
+// ResolvePin returns the pin that applies to dir: the pin for dir itself
+// or, failing that, for its closest pinned ancestor. Returns nil if no pin
+// covers dir.
+func (r *PinRegistry) ResolvePin(dir string) *Pin {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	for {
+		if pin := r.FindPin(absDir); pin != nil {
+			return pin
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return nil
+		}
+		absDir = parent
+	}
+}
+
 // AddPin adds or updates a pin in the registry.
 func (r *PinRegistry) AddPin(pin Pin) {
 	absDir, err := filepath.Abs(pin.Dir)
@@ -158,3 +322,21 @@ func (r *PinRegistry) RemovePin(dir string) bool {
 	}
 	return false
 }
+
+// MovePin re-points the pin for oldDir at newDir. It fails when oldDir is
+// not pinned or newDir already is.
+func (r *PinRegistry) MovePin(oldDir, newDir string) (*Pin, error) {
+	pin := r.FindPin(oldDir)
+	if pin == nil {
+		return nil, fmt.Errorf("no pin found for directory: %s", oldDir)
+	}
+	absNew, err := filepath.Abs(newDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve directory: %w", err)
+	}
+	if existing := r.FindPin(absNew); existing != nil {
+		return nil, fmt.Errorf("%s is already pinned to '%s'", absNew, existing.User)
+	}
+	pin.Dir = absNew
+	return pin, nil
+}
@@ -249,3 +249,147 @@ func TestAddPin_PreservesMode(t *testing.T) {
 		t.Errorf("expected mode %q after update, got %q", ModeWrapper, reg.Pins[0].Mode)
 	}
 }
+
+func TestPin_OwnerMatches(t *testing.T) {
+	pin := &Pin{User: "bob-work", Orgs: []string{"acme", "acme-labs"}}
+	ghes := &Pin{User: "bob", Host: "ghe.acme.com"}
+
+	tests := []struct {
+		name  string
+		pin   *Pin
+		host  string
+		owner string
+		want  bool
+	}{
+		{"own namespace", pin, "github.com", "bob-work", true},
+		{"case insensitive", pin, "GitHub.com", "ACME", true},
+		{"configured org", pin, "github.com", "acme-labs", true},
+		{"foreign owner", pin, "github.com", "alice", false},
+		{"wrong host", pin, "ghe.acme.com", "acme", false},
+		{"enterprise host", ghes, "ghe.acme.com", "bob", true},
+		{"enterprise pin on github.com", ghes, "github.com", "bob", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pin.OwnerMatches(tt.host, tt.owner); got != tt.want {
+				t.Errorf("OwnerMatches(%q, %q) = %v, want %v", tt.host, tt.owner, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPinRegistry_ResolvePin(t *testing.T) {
+	reg := &PinRegistry{
+		Pins: []Pin{
+			{User: "alice", Dir: "/tmp/test-a"},
+			{User: "bob", Dir: "/tmp/test-a/work"},
+		},
+	}
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"/tmp/test-a", "alice"},
+		{"/tmp/test-a/notes/2024", "alice"},
+		{"/tmp/test-a/work", "bob"},
+		{"/tmp/test-a/work/repo/src", "bob"},
+		{"/tmp/test-ab", ""},
+		{"/", ""},
+	}
+
+	for _, tt := range tests {
+		pin := reg.ResolvePin(tt.dir)
+		got := ""
+		if pin != nil {
+			got = pin.User
+		}
+		if got != tt.want {
+			t.Errorf("ResolvePin(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestDiffPins(t *testing.T) {
+	before := Pin{User: "bob-work", Dir: "/work", GitEmail: "bob@acme.com", SSHKey: "/k/id_old", Orgs: []string{"acme"}}
+	after := before
+	after.SSHKey = "/k/id_new"
+	after.GitEmail = ""
+	after.Mode = ModeWrapper // same as the default, not a change
+	after.Protected = true
+	after.Orgs = []string{"acme", "acme-labs"}
+
+	changes := DiffPins(before, after)
+	want := []FieldChange{
+		{"git_email", "bob@acme.com", ""},
+		{"ssh_key", "/k/id_old", "/k/id_new"},
+		{"protected", "", "true"},
+		{"orgs", "acme", "acme,acme-labs"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("DiffPins = %+v, want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+
+	if changes := DiffPins(before, before); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestPinRegistry_MovePin(t *testing.T) {
+	r := &PinRegistry{Pins: []Pin{
+		{User: "alice", Dir: "/work/foo", GitEmail: "a@x.com"},
+		{User: "bob", Dir: "/work/baz"},
+	}}
+
+	pin, err := r.MovePin("/work/foo", "/work/bar")
+	if err != nil {
+		t.Fatalf("MovePin failed: %v", err)
+	}
+	if pin.Dir != "/work/bar" || pin.GitEmail != "a@x.com" {
+		t.Errorf("unexpected moved pin: %+v", pin)
+	}
+	if r.FindPin("/work/foo") != nil || r.FindPin("/work/bar") == nil {
+		t.Error("registry not updated")
+	}
+
+	if _, err := r.MovePin("/work/missing", "/work/x"); err == nil {
+		t.Error("expected error for unpinned source")
+	}
+	if _, err := r.MovePin("/work/bar", "/work/baz"); err == nil {
+		t.Error("expected error for pinned destination")
+	}
+}
+
+func TestNormalizeEnvrcFile(t *testing.T) {
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"", "", true},
+		{".envrc", "", true},
+		{"./.envrc", "", true},
+		{".envrc.local", ".envrc.local", true},
+		{"config/./envrc.d/gh", "config/envrc.d/gh", true},
+		{"../.envrc.local", "", false},
+		{"/etc/envrc", "", false},
+		{".env", "", false},
+		{"sub/.env.local", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEnvrcFile(tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("NormalizeEnvrcFile(%q) = %q, %v; want %q, ok=%v", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+
+	pin := Pin{Dir: "/w", EnvrcFile: ".envrc.local"}
+	if files := pin.ManagedFiles(); len(files) != 2 || files[1] != "/w/.envrc.local" {
+		t.Errorf("ManagedFiles = %v", files)
+	}
+}
@@ -0,0 +1,178 @@
+package direnv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// ReadEnvrcPin reconstructs the pin described by the managed block direnv
+// reaches from the .envrc in dir: the .envrc's own, else the first in the
+// files it loads through source_env or source_env_if_exists lines, as
+// Loads follows them. ok is false when there is no managed block. The
+// block of an indirect pin names no account: it is reported as a pin with
+// only Dir, EnvrcFile and Indirect set.
+func ReadEnvrcPin(dir string) (pin config.Pin, ok bool, err error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return config.Pin{}, false, err
+	}
+	data, err := os.ReadFile(filepath.Join(absDir, config.DefaultEnvrcFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config.Pin{}, false, nil
+		}
+		return config.Pin{}, false, fmt.Errorf("cannot read .envrc: %w", err)
+	}
+	if pin, ok = parseEnvrcBlock(string(data)); ok {
+		pin.Dir = absDir
+		return pin, true, nil
+	}
+
+	err = walkSources(plan.Disk, absDir, true, func(path string, data []byte) bool {
+		// A pin's block must live inside its directory.
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil {
+			return false
+		}
+		name, err := config.NormalizeEnvrcFile(rel)
+		if err != nil {
+			return false
+		}
+		found, isBlock := parseEnvrcBlock(string(data))
+		if isBlock {
+			pin, ok = found, true
+			pin.EnvrcFile = name
+		}
+		return isBlock
+	})
+	if err != nil || !ok {
+		return config.Pin{}, false, err
+	}
+	pin.Dir = absDir
+	return pin, true, nil
+}
+
+// ParseBlock reconstructs a pin (without Dir) from the managed block in
+// envrc content, as written by WriteEnvrc. With several blocks the first
+// well-formed one is used; an unterminated block runs to the end of the
+// content. The block of an indirect pin carries no settings and is
+// reported as not found.
+func ParseBlock(content string) (config.Pin, bool) {
+	body := blockBody(content)
+	if body == "" {
+		return config.Pin{}, false
+	}
+
+	var pin config.Pin
+	found := false
+	for _, line := range strings.Split(body, "\n") {
+		words := shellSplit(strings.TrimSpace(line))
+		if len(words) == 0 {
+			continue
+		}
+		switch words[0] {
+		case "use_gh_autoprofile", "use_gh_autoprofile_export":
+			if len(words) < 2 {
+				continue
+			}
+			found = true
+			pin.Mode = config.ModeWrapper
+			if words[0] == "use_gh_autoprofile_export" {
+				pin.Mode = config.ModeExport
+			}
+			fields := []*string{&pin.User, &pin.GitEmail, &pin.GitName, &pin.SSHKey}
+			for i, w := range words[1:] {
+				if i < len(fields) {
+					*fields[i] = w
+				}
+			}
+		case "gh_autoprofile_protect":
+			pin.Protected = true
+		case "gh_autoprofile_owners":
+			for i := 1; i < len(words); i++ {
+				switch words[i] {
+				case "--strict":
+					pin.Strict = true
+				case "--host":
+					if i+1 < len(words) {
+						pin.Host = words[i+1]
+						i++
+					}
+				default:
+					pin.Orgs = append(pin.Orgs, words[i])
+				}
+			}
+		}
+	}
+	return pin, found
+}
+
+// parseEnvrcBlock is ParseBlock that reports the block of an indirect pin
+// as a pin with only Indirect set.
+func parseEnvrcBlock(content string) (config.Pin, bool) {
+	if pin, ok := ParseBlock(content); ok {
+		return pin, true
+	}
+	for _, line := range strings.Split(blockBody(content), "\n") {
+		if strings.TrimSpace(line) == indirectLine {
+			return config.Pin{Indirect: true}, true
+		}
+	}
+	return config.Pin{}, false
+}
+
+// blockBody returns the first managed block in envrc content; an
+// unterminated block runs to the end of the content.
+func blockBody(content string) string {
+	p := parseBlocks(content, envrcBlock)
+	body := p.first()
+	for _, i := range p.stray {
+		if body == "" && strings.TrimSpace(p.lines[i].text) == markerStart {
+			body = content[p.lines[i].start:]
+		}
+	}
+	return body
+}
+
+// shellSplit splits a line into words, honouring the single quoting
+// produced by shellQuote.
+func shellSplit(line string) []string {
+	var words []string
+	var cur strings.Builder
+	inWord, inQuote := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuote:
+			if c == '\'' {
+				inQuote = false
+			} else {
+				cur.WriteByte(c)
+			}
+		case c == '\'':
+			inQuote, inWord = true, true
+		case c == '\\' && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words
+}
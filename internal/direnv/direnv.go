@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/gitrepo"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
 )
 
 //go:embed shell/gh-autoprofile.sh
@@ -75,33 +77,46 @@ func ShellHookPath() (string, error) {
 
 // InstallShellLib writes the embedded shell library to direnv's lib directory.
 func InstallShellLib() error {
+	return InstallShellLibWith(plan.Disk)
+}
+
+// InstallShellLibWith is InstallShellLib performed through x.
+func InstallShellLibWith(x plan.Executor) error {
 	libDir, err := ShellLibDir()
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(libDir, 0755); err != nil {
-		return fmt.Errorf("cannot create direnv lib directory %s: %w", libDir, err)
+	if err := x.MkdirAll(libDir, 0755); err != nil {
+		return err
 	}
 
 	dest := filepath.Join(libDir, "gh-autoprofile.sh")
-	return os.WriteFile(dest, shellLibContent, 0644)
+	return x.WriteFile(dest, shellLibContent, 0644)
 }
 
 // InstallShellHook writes the shell hook script to the config directory
 // and injects a source line into the user's shell RC file (~/.zshrc or
 // ~/.bashrc). The hook creates gh()/git() wrapper functions when
-// GH_AUTOPROFILE_USER is set by direnv.
-func InstallShellHook() (hookPath string, err error) {
+// GH_AUTOPROFILE_USER is set by direnv; with the native backend it also
+// sets the pin's variables itself on directory changes.
+func InstallShellHook(backend config.Backend) (hookPath string, err error) {
+	return InstallShellHookWith(plan.Disk, backend)
+}
+
+// InstallShellHookWith is InstallShellHook performed through x.
+func InstallShellHookWith(x plan.Executor, backend config.Backend) (hookPath string, err error) {
 	// Write hook script to config dir.
 	hookPath, err = ShellHookPath()
 	if err != nil {
 		return "", err
 	}
-	dir := filepath.Dir(hookPath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return "", fmt.Errorf("cannot create config directory %s: %w", dir, err)
+	if err := x.MkdirAll(filepath.Dir(hookPath), 0700); err != nil {
+		return "", err
 	}
-	if err := os.WriteFile(hookPath, shellHookContent, 0644); err != nil {
+	// The native hook runs this binary directly; gh's extension dispatch
+	// is the fallback.
+	bin, _ := os.Executable()
+	if err := x.WriteFile(hookPath, shellHook(backend, bin), 0644); err != nil {
 		return "", fmt.Errorf("cannot write hook script: %w", err)
 	}
 	return hookPath, nil
@@ -110,53 +125,64 @@ func InstallShellHook() (hookPath string, err error) {
 // InjectHookSource adds a `source <hookPath>` line into the given shell RC
 // file, wrapped in markers so it can be updated/removed later.
 func InjectHookSource(rcPath, hookPath string) error {
+	return InjectHookSourceWith(plan.Disk, rcPath, hookPath)
+}
+
+// InjectHookSourceWith is InjectHookSource performed through x.
+func InjectHookSourceWith(x plan.Executor, rcPath, hookPath string) error {
+	return spliceHookSource(x, rcPath, hookPath, false)
+}
+
+// RepairHookSourceWith is InjectHookSourceWith for an RC file with
+// malformed hook blocks: duplicates and stray markers are dropped and a
+// single block is written in place of the first.
+func RepairHookSourceWith(x plan.Executor, rcPath, hookPath string) error {
+	return spliceHookSource(x, rcPath, hookPath, true)
+}
+
+// CheckHookSource returns the malformed hook-block problems of rcPath.
+func CheckHookSource(rcPath string) ([]*BlockError, error) {
+	return checkFile(rcPath, hookBlock)
+}
+
+func spliceHookSource(x plan.Executor, rcPath, hookPath string, repair bool) error {
 	block := hookMarkerStart + "\n" +
 		`source "` + hookPath + `"` + "\n" +
 		hookMarkerEnd + "\n"
 
-	existing, err := os.ReadFile(rcPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("cannot read %s: %w", rcPath, err)
-	}
-
-	content := string(existing)
-
-	// Already present — replace the existing block.
-	if strings.Contains(content, hookMarkerStart) {
-		startIdx := strings.Index(content, hookMarkerStart)
-		endIdx := strings.Index(content, hookMarkerEnd)
-		if endIdx != -1 {
-			endIdx += len(hookMarkerEnd)
-			if endIdx < len(content) && content[endIdx] == '\n' {
-				endIdx++
-			}
-			content = content[:startIdx] + block + content[endIdx:]
-			return os.WriteFile(rcPath, []byte(content), 0644)
-		}
+	content, _, _, err := spliceFile(x, rcPath, hookBlock, block, repair)
+	if err != nil {
+		return err
 	}
+	return x.WriteFile(rcPath, []byte(content), rcPerm(x, rcPath))
+}
 
-	// Append.
-	if len(content) > 0 && !strings.HasSuffix(content, "\n") {
-		content += "\n"
+// rcPerm keeps the permissions of an existing shell RC file.
+func rcPerm(x plan.Executor, rcPath string) os.FileMode {
+	if fi, err := x.Stat(rcPath); err == nil {
+		return fi.Mode().Perm()
 	}
-	content += "\n" + block
-	return os.WriteFile(rcPath, []byte(content), 0644)
+	return 0644
 }
 
-// CheckShellHookInstalled checks if the gh-autoprofile hook source line
-// is present in common shell config files.
-func CheckShellHookInstalled() bool {
+// ShellRCFiles returns the shell RC files setup may inject the hook into.
+func ShellRCFiles() []string {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return false
+		return nil
 	}
-	files := []string{
+	return []string{
 		filepath.Join(home, ".zshrc"),
 		filepath.Join(home, ".bashrc"),
 		filepath.Join(home, ".bash_profile"),
 		filepath.Join(home, ".profile"),
 	}
-	for _, f := range files {
+}
+
+// CheckShellHookInstalled checks if the gh-autoprofile hook source line
+// is present in common shell config files.
+func CheckShellHookInstalled() bool {
+	for _, f := range ShellRCFiles() {
 		data, err := os.ReadFile(f)
 		if err != nil {
 			continue
@@ -209,9 +235,229 @@ func CheckDirenvHook() bool {
 //
 // In wrapper mode (default) it writes: use_gh_autoprofile <user> ...
 // In export mode it writes: use_gh_autoprofile_export <user> ...
-func WriteEnvrc(pin config.Pin) error {
-	envrcPath := filepath.Join(pin.Dir, ".envrc")
+// Protected pins additionally get a gh_autoprofile_protect line, and pins
+// with orgs or strict owner checks get a gh_autoprofile_owners line.
+//
+// The file mode follows policy, the registry's envrc_permissions, and the
+// owner and group of an existing file are kept.
+func WriteEnvrc(pin config.Pin, policy config.PermissionPolicy) error {
+	return WriteEnvrcWith(plan.Disk, pin, policy)
+}
+
+// WriteEnvrcWith is WriteEnvrc performed through x.
+func WriteEnvrcWith(x plan.Executor, pin config.Pin, policy config.PermissionPolicy) error {
+	return spliceEnvrc(x, pin, policy, false)
+}
+
+// RepairEnvrcWith is WriteEnvrcWith for an .envrc with malformed blocks:
+// duplicate blocks, stray markers and the managed lines next to them are
+// dropped and a single block for pin is written in place of the first.
+func RepairEnvrcWith(x plan.Executor, pin config.Pin, policy config.PermissionPolicy) error {
+	return spliceEnvrc(x, pin, policy, true)
+}
+
+// CheckEnvrc returns the malformed-block problems of the file holding
+// pin's block and, when that is another file, of the .envrc loading it;
+// problems in the .envrc then name it.
+func CheckEnvrc(pin config.Pin) ([]*BlockError, error) {
+	name := pin.EnvrcName()
+	problems, err := checkFile(filepath.Join(pin.Dir, name), envrcBlock)
+	if err != nil || name == config.DefaultEnvrcFile {
+		return problems, err
+	}
+	pointer, err := checkFile(filepath.Join(pin.Dir, config.DefaultEnvrcFile), envrcBlock)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pointer {
+		p.File = config.DefaultEnvrcFile
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+func spliceEnvrc(x plan.Executor, pin config.Pin, policy config.PermissionPolicy, repair bool) error {
+	name := pin.EnvrcName()
+	if sub := filepath.Dir(name); sub != "." {
+		if err := x.MkdirAll(filepath.Join(pin.Dir, sub), 0755); err != nil {
+			return err
+		}
+	}
+	if err := writeBlock(x, filepath.Join(pin.Dir, name), RenderBlock(pin), policy, pin.EffectiveMode(), repair); err != nil {
+		return err
+	}
+	if name == config.DefaultEnvrcFile {
+		return nil
+	}
+
+	// The block lives in another file: .envrc must load it. Lines of the
+	// user's own doing so, directly or through other files, make a block
+	// of ours redundant.
+	envrcPath := filepath.Join(pin.Dir, config.DefaultEnvrcFile)
+	sourced, err := loads(x, pin.Dir, name, false)
+	if err != nil {
+		return err
+	}
+	if sourced {
+		return removeBlock(x, envrcPath, policy, repair)
+	}
+	// The pointer block holds no settings, so it is treated like a
+	// wrapper-mode block by the permission policy.
+	return writeBlock(x, envrcPath, RenderSourceBlock(name), policy, config.ModeWrapper, repair)
+}
+
+// writeBlock puts block in place of the managed block of path, applying
+// policy for a pin of the given mode.
+func writeBlock(x plan.Executor, path, block string, policy config.PermissionPolicy, mode config.PinMode, repair bool) error {
+	content, _, exists, err := spliceFile(x, path, envrcBlock, block, repair)
+	if err != nil {
+		return err
+	}
+	perm := policy.EnvrcPerm(mode, fileMode(x, path), exists)
+	return x.WriteFile(path, []byte(content), perm)
+}
+
+// GitExposure returns the file holding pin's settings and how git treats
+// it. An indirect pin keeps no settings in its files and reports Outside,
+// as does a failed check.
+func GitExposure(pin config.Pin) (string, gitrepo.FileState) {
+	path := filepath.Join(pin.Dir, pin.EnvrcName())
+	if pin.Indirect {
+		return path, gitrepo.Outside
+	}
+	state, err := gitrepo.StatFile(path)
+	if err != nil {
+		return path, gitrepo.Outside
+	}
+	return path, state
+}
 
+// RenderSourceBlock returns the managed block written to .envrc for a pin
+// whose block lives in the file name: it only loads that file.
+func RenderSourceBlock(name string) string {
+	return markerStart + "\n" + sourceCommand + " " + shellQuote(name) + "\n" + markerEnd + "\n"
+}
+
+// sourceCommand is the direnv stdlib function pointer blocks use.
+const sourceCommand = "source_env_if_exists"
+
+// Loads reports whether direnv, loading the .envrc in dir, reaches the
+// file name (relative to dir) through source_env or source_env_if_exists
+// lines, directly or through the files those lines load.
+func Loads(dir, name string) (bool, error) {
+	return loads(plan.Disk, dir, name, true)
+}
+
+// loads is Loads reading through x that, unless withBlock is set, ignores
+// the managed block of the .envrc in dir.
+func loads(x plan.Executor, dir, name string, withBlock bool) (bool, error) {
+	target := filepath.Join(dir, name)
+	found := false
+	err := walkSources(x, dir, withBlock, func(path string, data []byte) bool {
+		found = path == target
+		return found
+	})
+	return found, err
+}
+
+// walkSources calls visit with each file direnv, loading the .envrc in
+// dir, reaches through source_env or source_env_if_exists lines, directly
+// or through the files those lines load, until visit returns true. data
+// is nil for files that do not exist. Unless withBlock is set, the managed
+// block of the .envrc is ignored.
+func walkSources(x plan.Executor, dir string, withBlock bool, visit func(path string, data []byte) bool) error {
+	root := filepath.Join(dir, config.DefaultEnvrcFile)
+	seen := map[string]bool{root: true}
+	queue := []string{root}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		data, err := x.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("cannot read %s: %w", file, err)
+		}
+		if file != root && visit(file, data) {
+			return nil
+		}
+		if data == nil {
+			continue
+		}
+		p := parseBlocks(string(data), envrcBlock)
+		skip := map[int]bool{}
+		if file == root && !withBlock {
+			for _, b := range p.blocks {
+				for i := b[0]; i <= b[1]; i++ {
+					skip[i] = true
+				}
+			}
+		}
+		for i, l := range p.lines {
+			sourced, ok := sourcedFile(l.text)
+			if skip[i] || !ok {
+				continue
+			}
+			if !filepath.IsAbs(sourced) {
+				sourced = filepath.Join(filepath.Dir(file), sourced)
+			}
+			// source_env also accepts a directory, meaning its .envrc.
+			if fi, err := x.Stat(sourced); err == nil && fi.IsDir() {
+				sourced = filepath.Join(sourced, config.DefaultEnvrcFile)
+			}
+			sourced = filepath.Clean(sourced)
+			if !seen[sourced] {
+				seen[sourced] = true
+				queue = append(queue, sourced)
+			}
+		}
+	}
+	return nil
+}
+
+// sourcedFile returns the file a source_env or source_env_if_exists line
+// loads.
+func sourcedFile(line string) (string, bool) {
+	words := shellSplit(strings.TrimSpace(line))
+	if len(words) != 2 || (words[0] != sourceCommand && words[0] != "source_env") {
+		return "", false
+	}
+	return words[1], true
+}
+
+// fileMode returns the permission bits of path as x sees it, or 0 if it
+// cannot be read.
+func fileMode(x plan.Executor, path string) os.FileMode {
+	fi, err := x.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Mode().Perm()
+}
+
+// RenderBlock returns the managed block WriteEnvrc writes for pin,
+// including the start and end markers. An indirect pin gets a single
+// `use gh_autoprofile` line that resolves its settings from pins.yml when
+// direnv loads the .envrc.
+func RenderBlock(pin config.Pin) string {
+	body := inlineBody(pin)
+	if pin.Indirect {
+		body = indirectLine + "\n"
+	}
+	return markerStart + "\n" + body + markerEnd + "\n"
+}
+
+// indirectLine is the whole managed block body of an indirect pin.
+const indirectLine = "use gh_autoprofile"
+
+// ResolveScript returns what `use gh_autoprofile` evaluates for an
+// indirect pin: a watch on pinsPath, so direnv reloads when the pin is
+// edited, followed by the commands an inline block would contain.
+func ResolveScript(pin config.Pin, pinsPath string) string {
+	return "watch_file " + shellQuote(pinsPath) + "\n" + inlineBody(pin)
+}
+
+// inlineBody returns the direnv commands that apply pin, without the
+// block markers.
+func inlineBody(pin config.Pin) string {
 	// Choose the direnv function based on mode.
 	fnName := "use_gh_autoprofile"
 	if pin.EffectiveMode() == config.ModeExport {
@@ -231,100 +477,123 @@ func WriteEnvrc(pin config.Pin) error {
 		}
 	}
 
-	// Build the managed block.
+	// Build the block body.
 	var block strings.Builder
-	block.WriteString(markerStart + "\n")
 	block.WriteString(fnName + " " + strings.Join(args, " ") + "\n")
-	block.WriteString(markerEnd + "\n")
-
-	// Read existing .envrc (if any).
-	existing, err := os.ReadFile(envrcPath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("cannot read .envrc: %w", err)
-	}
-
-	var newContent string
-	if len(existing) > 0 {
-		content := string(existing)
-		if strings.Contains(content, markerStart) {
-			// Replace existing block.
-			startIdx := strings.Index(content, markerStart)
-			endIdx := strings.Index(content, markerEnd)
-			if endIdx != -1 {
-				endIdx += len(markerEnd)
-				if endIdx < len(content) && content[endIdx] == '\n' {
-					endIdx++
-				}
-				newContent = content[:startIdx] + block.String() + content[endIdx:]
-			} else {
-				// Malformed markers — append fresh block.
-				newContent = content
-				if !strings.HasSuffix(content, "\n") {
-					newContent += "\n"
-				}
-				newContent += block.String()
-			}
-		} else {
-			// Append block to existing content.
-			newContent = content
-			if !strings.HasSuffix(content, "\n") {
-				newContent += "\n"
-			}
-			newContent += block.String()
+	if pin.Protected {
+		block.WriteString("gh_autoprofile_protect\n")
+	}
+	if len(pin.Orgs) > 0 || pin.Strict {
+		var owners []string
+		if pin.Strict {
+			owners = append(owners, "--strict")
+		}
+		if pin.Host != "" {
+			owners = append(owners, "--host", shellQuote(pin.Host))
 		}
-	} else {
-		newContent = block.String()
+		for _, org := range pin.Orgs {
+			owners = append(owners, shellQuote(org))
+		}
+		block.WriteString("gh_autoprofile_owners " + strings.Join(owners, " ") + "\n")
 	}
+	return block.String()
+}
 
-	return os.WriteFile(envrcPath, []byte(newContent), 0600)
+// BlockCurrent reports whether the pin's files contain exactly the blocks
+// WriteEnvrc writes for pin: RenderBlock in the file named by the pin and,
+// when that is not .envrc, an .envrc that loads it.
+func BlockCurrent(pin config.Pin) (bool, error) {
+	name := pin.EnvrcName()
+	current, err := fileHasBlock(filepath.Join(pin.Dir, name), RenderBlock(pin))
+	if err != nil || !current || name == config.DefaultEnvrcFile {
+		return current, err
+	}
+	if sourced, err := loads(plan.Disk, pin.Dir, name, false); err != nil || sourced {
+		return sourced, err
+	}
+	return fileHasBlock(filepath.Join(pin.Dir, config.DefaultEnvrcFile), RenderSourceBlock(name))
 }
 
-// RemoveEnvrc removes the gh-autoprofile block from .envrc.
-// If the file is empty after removal, it deletes the file entirely.
-func RemoveEnvrc(dir string) error {
-	envrcPath := filepath.Join(dir, ".envrc")
+// ShadowedBlock returns the first file of pin whose managed block runs
+// before a devshell line (`use flake`, `use nix`, ...) and that line, or
+// "" when none does. The devshell could override what the block sets;
+// WriteEnvrc moves the block below it.
+func ShadowedBlock(pin config.Pin) (path, line string, err error) {
+	for _, path := range pin.ManagedFiles() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", "", fmt.Errorf("cannot read %s: %w", path, err)
+		}
+		if line := parseBlocks(string(data), envrcBlock).shadowing(envrcBlock); line != "" {
+			return path, line, nil
+		}
+	}
+	return "", "", nil
+}
 
-	existing, err := os.ReadFile(envrcPath)
+// fileHasBlock reports whether path has a single well-formed managed
+// block equal to block, placed after any devshell line.
+func fileHasBlock(path, block string) (bool, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return false, nil
 		}
-		return fmt.Errorf("cannot read .envrc: %w", err)
+		return false, fmt.Errorf("cannot read %s: %w", filepath.Base(path), err)
 	}
-
-	content := string(existing)
-	if !strings.Contains(content, markerStart) {
-		return nil // No gh-autoprofile block
+	p := parseBlocks(string(data), envrcBlock)
+	if len(p.problems) > 0 || p.shadowing(envrcBlock) != "" {
+		return false, nil
 	}
+	return p.first() == block, nil
+}
 
-	startIdx := strings.Index(content, markerStart)
-	endIdx := strings.Index(content, markerEnd)
-	if endIdx == -1 {
-		return nil
+// RemoveEnvrc removes the gh-autoprofile blocks of pin from its .envrc
+// and the file holding its block. A file left empty is deleted; the mode
+// of one left with other content follows policy.
+func RemoveEnvrc(pin config.Pin, policy config.PermissionPolicy) error {
+	return RemoveEnvrcWith(plan.Disk, pin, policy)
+}
+
+// RemoveEnvrcWith is RemoveEnvrc performed through x.
+func RemoveEnvrcWith(x plan.Executor, pin config.Pin, policy config.PermissionPolicy) error {
+	files := pin.ManagedFiles()
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := removeBlock(x, files[i], policy, false); err != nil {
+			return err
+		}
 	}
-	endIdx += len(markerEnd)
-	if endIdx < len(content) && content[endIdx] == '\n' {
-		endIdx++
+	return nil
+}
+
+// removeBlock removes the managed block from path, deleting the file when
+// nothing else is left in it.
+func removeBlock(x plan.Executor, path string, policy config.PermissionPolicy, repair bool) error {
+	content, found, _, err := spliceFile(x, path, envrcBlock, "", repair)
+	if err != nil || !found {
+		return err // No file or no gh-autoprofile block
 	}
 
-	newContent := strings.TrimSpace(content[:startIdx] + content[endIdx:])
+	newContent := strings.TrimSpace(content)
 	if newContent == "" {
-		return os.Remove(envrcPath)
+		return x.Remove(path)
 	}
 
-	return os.WriteFile(envrcPath, []byte(newContent+"\n"), 0600)
+	perm := policy.UnmanagedPerm(fileMode(x, path))
+	return x.WriteFile(path, []byte(newContent+"\n"), perm)
 }
 
 // AllowEnvrc runs `direnv allow` on the .envrc file.
 func AllowEnvrc(dir string) error {
-	envrcPath := filepath.Join(dir, ".envrc")
-	cmd := exec.Command("direnv", "allow", envrcPath)
-	cmd.Dir = dir
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("direnv allow failed: %s: %w", strings.TrimSpace(string(out)), err)
-	}
-	return nil
+	return AllowEnvrcWith(plan.Disk, dir)
+}
+
+// AllowEnvrcWith is AllowEnvrc performed through x.
+func AllowEnvrcWith(x plan.Executor, dir string) error {
+	return x.Run(dir, "direnv", "allow", filepath.Join(dir, ".envrc"))
 }
 
 // shellQuote wraps a string in single quotes for safe shell interpolation.
@@ -1,6 +1,7 @@
 package direnv
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,13 +10,14 @@ import (
 	"testing"
 
 	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
 )
 
 func TestWriteEnvrc_WrapperMode(t *testing.T) {
 	tmpDir := t.TempDir()
 	pin := config.Pin{User: "alice", Dir: tmpDir}
 
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
@@ -42,7 +44,7 @@ func TestWriteEnvrc_ExportMode(t *testing.T) {
 	tmpDir := t.TempDir()
 	pin := config.Pin{User: "alice", Dir: tmpDir, Mode: config.ModeExport}
 
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
@@ -66,7 +68,7 @@ func TestWriteEnvrc_WithGitIdentity(t *testing.T) {
 		GitName:  "Bob Test",
 	}
 
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
@@ -104,7 +106,7 @@ func TestWriteEnvrc_ExportWithGitIdentity(t *testing.T) {
 		GitName:  "Bob Test",
 	}
 
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
@@ -133,7 +135,7 @@ func TestWriteEnvrc_PreservesExistingContent(t *testing.T) {
 	}
 
 	pin := config.Pin{User: "alice", Dir: tmpDir}
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
@@ -160,13 +162,13 @@ func TestWriteEnvrc_UpdatesExistingBlock(t *testing.T) {
 
 	// First pin (wrapper mode)
 	pin1 := config.Pin{User: "alice", Dir: tmpDir}
-	if err := WriteEnvrc(pin1); err != nil {
+	if err := WriteEnvrc(pin1, config.PermAuto); err != nil {
 		t.Fatalf("first WriteEnvrc failed: %v", err)
 	}
 
 	// Update to export mode with different user
 	pin2 := config.Pin{User: "bob", Dir: tmpDir, Mode: config.ModeExport, GitEmail: "bob@test.com"}
-	if err := WriteEnvrc(pin2); err != nil {
+	if err := WriteEnvrc(pin2, config.PermAuto); err != nil {
 		t.Fatalf("second WriteEnvrc failed: %v", err)
 	}
 
@@ -194,12 +196,12 @@ func TestRemoveEnvrc_DeletesEmptyFile(t *testing.T) {
 
 	// Write a block
 	pin := config.Pin{User: "alice", Dir: tmpDir}
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
 	// Remove it
-	if err := RemoveEnvrc(tmpDir); err != nil {
+	if err := RemoveEnvrc(config.Pin{Dir: tmpDir}, config.PermAuto); err != nil {
 		t.Fatalf("RemoveEnvrc failed: %v", err)
 	}
 
@@ -219,12 +221,12 @@ func TestRemoveEnvrc_PreservesOtherContent(t *testing.T) {
 		t.Fatalf("cannot write .envrc: %v", err)
 	}
 	pin := config.Pin{User: "alice", Dir: tmpDir}
-	if err := WriteEnvrc(pin); err != nil {
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
 		t.Fatalf("WriteEnvrc failed: %v", err)
 	}
 
 	// Remove block
-	if err := RemoveEnvrc(tmpDir); err != nil {
+	if err := RemoveEnvrc(config.Pin{Dir: tmpDir}, config.PermAuto); err != nil {
 		t.Fatalf("RemoveEnvrc failed: %v", err)
 	}
 
@@ -246,7 +248,7 @@ func TestRemoveEnvrc_PreservesOtherContent(t *testing.T) {
 func TestRemoveEnvrc_NoopWhenNoFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	// Should not error when no .envrc exists
-	if err := RemoveEnvrc(tmpDir); err != nil {
+	if err := RemoveEnvrc(config.Pin{Dir: tmpDir}, config.PermAuto); err != nil {
 		t.Fatalf("RemoveEnvrc should not error on missing file: %v", err)
 	}
 }
@@ -440,18 +442,22 @@ func TestShellHook_WrapperAndExportBehavior(t *testing.T) {
 			shell: "bash",
 			script: fmt.Sprintf(`set -e
 export PATH=%q:$PATH
+export GH_AUTOPROFILE_WRAPPED=gh,git
 source %q
+echo LOADED_WRAPPED=${GH_AUTOPROFILE_WRAPPED:-}
 export GH_AUTOPROFILE_USER=alice
 unset GH_TOKEN
 _gh_autoprofile_hook
 echo WRAP_GH=$(type -t gh)
 echo WRAP_GIT=$(type -t git)
+echo WRAPPED=$(printenv GH_AUTOPROFILE_WRAPPED)
 gh api /user
 git status
 export GH_TOKEN=preexisting
 _gh_autoprofile_hook
 echo EXP_GH=$(type -t gh)
 echo EXP_GIT=$(type -t git)
+echo EXP_WRAPPED=${GH_AUTOPROFILE_WRAPPED:-}
 `, fakeBin, hookPath),
 		},
 		{
@@ -459,18 +465,22 @@ echo EXP_GIT=$(type -t git)
 			shell: "zsh",
 			script: fmt.Sprintf(`set -e
 export PATH=%q:$PATH
+export GH_AUTOPROFILE_WRAPPED=gh,git
 source %q
+echo LOADED_WRAPPED=${GH_AUTOPROFILE_WRAPPED:-}
 export GH_AUTOPROFILE_USER=alice
 unset GH_TOKEN
 _gh_autoprofile_hook
 echo WRAP_GH=$(whence -w gh)
 echo WRAP_GIT=$(whence -w git)
+echo WRAPPED=$(printenv GH_AUTOPROFILE_WRAPPED)
 gh api /user
 git status
 export GH_TOKEN=preexisting
 _gh_autoprofile_hook
 echo EXP_GH=$(whence -w gh)
 echo EXP_GIT=$(whence -w git)
+echo EXP_WRAPPED=${GH_AUTOPROFILE_WRAPPED:-}
 `, fakeBin, hookPath),
 		},
 	}
@@ -494,6 +504,12 @@ echo EXP_GIT=$(whence -w git)
 			if strings.Contains(s, "EXP_GH=function") || strings.Contains(s, "EXP_GIT=function") {
 				t.Fatalf("expected export mode to remove wrappers, got:\n%s", s)
 			}
+			if !strings.Contains(s, "LOADED_WRAPPED=\n") {
+				t.Fatalf("expected loading the hook to clear an inherited marker, got:\n%s", s)
+			}
+			if !strings.Contains(s, "WRAPPED=gh,git\n") || !strings.Contains(s, "EXP_WRAPPED=\n") {
+				t.Fatalf("expected GH_AUTOPROFILE_WRAPPED to be exported only with the wrappers, got:\n%s", s)
+			}
 		})
 	}
 }
@@ -535,3 +551,939 @@ func TestShellHook_RegistersWithPromptCycle(t *testing.T) {
 		}
 	})
 }
+
+func TestWriteEnvrc_Protected(t *testing.T) {
+	tmpDir := t.TempDir()
+	pin := config.Pin{User: "acme-admin", Dir: tmpDir, Protected: true}
+
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, ".envrc"))
+	if err != nil {
+		t.Fatalf("cannot read .envrc: %v", err)
+	}
+
+	expected := "# gh-autoprofile:start\nuse_gh_autoprofile acme-admin\ngh_autoprofile_protect\n# gh-autoprofile:end\n"
+	if string(content) != expected {
+		t.Errorf("unexpected .envrc content:\ngot:  %q\nwant: %q", string(content), expected)
+	}
+}
+
+func TestShellHook_ProtectedAccount(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skipf("bash not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	hookPath := filepath.Join(tmpDir, "hook.sh")
+	if err := os.WriteFile(hookPath, shellHookContent, 0700); err != nil {
+		t.Fatalf("cannot write hook file: %v", err)
+	}
+
+	fakeBin := filepath.Join(tmpDir, "bin")
+	if err := os.MkdirAll(fakeBin, 0755); err != nil {
+		t.Fatalf("cannot create fake bin dir: %v", err)
+	}
+	fakeGh := "#!/usr/bin/env bash\n" +
+		"if [[ \"$1\" == \"auth\" && \"$2\" == \"token\" ]]; then echo token-$4; exit 0; fi\n" +
+		"echo gh-ran $*\n"
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte(fakeGh), 0755); err != nil {
+		t.Fatalf("cannot write fake gh: %v", err)
+	}
+	fakeGit := "#!/usr/bin/env bash\necho git-ran $*\n"
+	if err := os.WriteFile(filepath.Join(fakeBin, "git"), []byte(fakeGit), 0755); err != nil {
+		t.Fatalf("cannot write fake git: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		setup  string
+		cmd    string
+		want   string
+		reject bool
+	}{
+		{"wrapper push refused", "unset GH_TOKEN", "git push origin main", "refused 'git push'", true},
+		{"wrapper force push refused", "unset GH_TOKEN", "git -C . push --force", "refused 'git push --force'", true},
+		{"wrapper status allowed", "unset GH_TOKEN", "git status", "git-ran status", false},
+		{"wrapper pr merge refused", "unset GH_TOKEN", "gh pr merge 1", "refused 'gh pr merge'", true},
+		{"wrapper pr view allowed", "unset GH_TOKEN", "gh pr view 1", "gh-ran pr view 1", false},
+		{"confirm override", "unset GH_TOKEN; export GH_AUTOPROFILE_CONFIRM=1", "git push", "git-ran push", false},
+		{"export mode push refused", "export GH_TOKEN=tok", "git push", "refused 'git push'", true},
+		{"export mode repo delete refused", "export GH_TOKEN=tok", "gh repo delete acme/x", "refused 'gh repo delete'", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := fmt.Sprintf(`export PATH=%q:$PATH
+source %q
+export GH_AUTOPROFILE_USER=acme-admin
+export GH_AUTOPROFILE_PROTECTED=1
+%s
+_gh_autoprofile_hook
+if %s; then echo RESULT=ok; else echo RESULT=refused; fi
+`, fakeBin, hookPath, tc.setup, tc.cmd)
+
+			cmd := exec.Command("bash", "-c", script)
+			cmd.Stdin = strings.NewReader("")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash script failed: %v\noutput:\n%s", err, string(out))
+			}
+
+			s := string(out)
+			if !strings.Contains(s, tc.want) {
+				t.Errorf("expected output to contain %q, got:\n%s", tc.want, s)
+			}
+			if tc.reject && !strings.Contains(s, "RESULT=refused") {
+				t.Errorf("expected operation to be refused, got:\n%s", s)
+			}
+			if !tc.reject && !strings.Contains(s, "RESULT=ok") {
+				t.Errorf("expected operation to succeed, got:\n%s", s)
+			}
+			if tc.reject && !strings.Contains(s, "acme-admin") {
+				t.Errorf("expected decision to name the account, got:\n%s", s)
+			}
+		})
+	}
+}
+
+// TestShellHook_OwnerCheckUsesPushedRemote checks the remote a push
+// actually goes to: the one named on the command line, in the repository
+// given with -C, and the branch's push remote by default.
+func TestShellHook_OwnerCheckUsesPushedRemote(t *testing.T) {
+	for _, tool := range []string{"bash", "git"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available: %v", tool, err)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	hookPath := filepath.Join(tmpDir, "hook.sh")
+	if err := os.WriteFile(hookPath, shellHookContent, 0700); err != nil {
+		t.Fatalf("cannot write hook file: %v", err)
+	}
+	repo := filepath.Join(tmpDir, "repo")
+	other := filepath.Join(tmpDir, "other")
+	for _, args := range [][]string{
+		{"init", "-q", repo},
+		{"-C", repo, "remote", "add", "origin", "git@github.com:bob-work/dotfiles.git"},
+		{"-C", repo, "remote", "add", "upstream", "https://github.com/alice/dotfiles.git"},
+		{"init", "-q", other},
+		{"-C", other, "remote", "add", "origin", "git@github.com:bob-work/other.git"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		dir    string
+		args   string
+		reject bool
+	}{
+		{"origin", repo, "push", false},
+		{"named remote", repo, "push upstream main", true},
+		{"named remote after options", repo, "push -u --force upstream main", true},
+		{"--repo", repo, "push --repo=upstream", true},
+		{"URL", repo, "push https://github.com/alice/x.git main", true},
+		{"-C foreign repo", other, "-C " + repo + " push upstream", true},
+		{"-C own remote", repo, "-C " + other + " push", false},
+		{"push remote of branch", repo, "-c remote.pushDefault=upstream push", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := fmt.Sprintf(`cd %q
+source %q
+export GH_AUTOPROFILE_USER=bob-work GH_AUTOPROFILE_STRICT=1
+if _gh_autoprofile_check_owner %s; then echo RESULT=ok; else echo RESULT=refused; fi
+`, tc.dir, hookPath, tc.args)
+			cmd := exec.Command("bash", "-c", script)
+			cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash script failed: %v\noutput:\n%s", err, out)
+			}
+			if tc.reject != strings.Contains(string(out), "RESULT=refused") {
+				t.Errorf("reject = %v, got:\n%s", tc.reject, out)
+			}
+		})
+	}
+}
+
+func TestWriteEnvrc_OwnerChecks(t *testing.T) {
+	tmpDir := t.TempDir()
+	pin := config.Pin{User: "bob", Dir: tmpDir, Host: "ghe.acme.com", Orgs: []string{"acme", "acme labs"}, Strict: true}
+
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, ".envrc"))
+	if err != nil {
+		t.Fatalf("cannot read .envrc: %v", err)
+	}
+
+	want := "gh_autoprofile_owners --strict --host ghe.acme.com acme 'acme labs'\n"
+	if !strings.Contains(string(content), want) {
+		t.Errorf("expected .envrc to contain %q, got:\n%s", want, content)
+	}
+}
+
+func TestShellHook_OwnerCheckBeforePush(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skipf("bash not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	hookPath := filepath.Join(tmpDir, "hook.sh")
+	if err := os.WriteFile(hookPath, shellHookContent, 0700); err != nil {
+		t.Fatalf("cannot write hook file: %v", err)
+	}
+	libPath := filepath.Join(tmpDir, "lib.sh")
+	if err := os.WriteFile(libPath, shellLibContent, 0700); err != nil {
+		t.Fatalf("cannot write lib file: %v", err)
+	}
+
+	fakeBin := filepath.Join(tmpDir, "bin")
+	if err := os.MkdirAll(fakeBin, 0755); err != nil {
+		t.Fatalf("cannot create fake bin dir: %v", err)
+	}
+	fakeGh := "#!/usr/bin/env bash\necho token-$4\n"
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte(fakeGh), 0755); err != nil {
+		t.Fatalf("cannot write fake gh: %v", err)
+	}
+	fakeGit := "#!/usr/bin/env bash\n" +
+		"if [[ \"$1\" == \"remote\" ]]; then echo \"$FAKE_ORIGIN\"; exit 0; fi\n" +
+		"if [[ \"$1\" == \"config\" || \"$1\" == \"symbolic-ref\" ]]; then exit 1; fi\n" +
+		"echo git-ran $*\n"
+	if err := os.WriteFile(filepath.Join(fakeBin, "git"), []byte(fakeGit), 0755); err != nil {
+		t.Fatalf("cannot write fake git: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		owners string
+		origin string
+		want   string
+		reject bool
+	}{
+		{"own repo", "acme", "git@github.com:bob-work/dotfiles.git", "git-ran push", false},
+		{"org repo", "acme", "https://github.com/ACME/widgets.git", "git-ran push", false},
+		{"foreign repo warns", "acme", "git@github.com:alice/notes.git", "warning: origin is github.com/alice", false},
+		{"foreign repo strict", "--strict acme", "git@github.com:alice/notes.git", "refused 'git push': origin is github.com/alice", true},
+		{"wrong host strict", "--strict --host ghe.acme.com acme", "ssh://git@github.com/acme/widgets.git", "refused 'git push'", true},
+		{"enterprise host", "--strict --host ghe.acme.com acme", "ssh://git@ghe.acme.com:2222/acme/widgets.git", "git-ran push", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := fmt.Sprintf(`export PATH=%q:$PATH
+log_status() { :; }
+log_error() { echo "$@" >&2; }
+source %q
+source %q
+export GH_AUTOPROFILE_USER=bob-work
+export FAKE_ORIGIN=%q
+gh_autoprofile_owners %s
+_gh_autoprofile_hook
+if git push; then echo RESULT=ok; else echo RESULT=refused; fi
+`, fakeBin, libPath, hookPath, tc.origin, tc.owners)
+
+			out, err := exec.Command("bash", "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash script failed: %v\noutput:\n%s", err, string(out))
+			}
+
+			s := string(out)
+			if !strings.Contains(s, tc.want) {
+				t.Errorf("expected output to contain %q, got:\n%s", tc.want, s)
+			}
+			if tc.reject != strings.Contains(s, "RESULT=refused") {
+				t.Errorf("reject = %v, got:\n%s", tc.reject, s)
+			}
+		})
+	}
+}
+
+func TestShellLib_PolicyRefusesActivation(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skipf("bash not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	libPath := filepath.Join(tmpDir, "lib.sh")
+	if err := os.WriteFile(libPath, shellLibContent, 0700); err != nil {
+		t.Fatalf("cannot write lib file: %v", err)
+	}
+
+	fakeBin := filepath.Join(tmpDir, "bin")
+	if err := os.MkdirAll(fakeBin, 0755); err != nil {
+		t.Fatalf("cannot create fake bin dir: %v", err)
+	}
+	fakeGh := "#!/usr/bin/env bash\n" +
+		"if [[ \"$1 $2 $3\" == \"autoprofile policy check\" ]]; then\n" +
+		"  [[ -n \"$FAKE_VIOLATION\" ]] && { echo \"$FAKE_VIOLATION\"; exit 1; }\n" +
+		"  exit 0\n" +
+		"fi\n" +
+		"echo token-$4\n"
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte(fakeGh), 0755); err != nil {
+		t.Fatalf("cannot write fake gh: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		findUp    string
+		violation string
+		want      string
+	}{
+		{"no policy", "", "", "USER=bob-work"},
+		{"compliant", "/src/mono/.gh-autoprofile.yml", "", "USER=bob-work"},
+		{"violation", "/src/mono/.gh-autoprofile.yml", "git email bob@gmail.com is not an @acme.com address", "not an @acme.com address"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := fmt.Sprintf(`export PATH=%q:$PATH
+log_status() { :; }
+log_error() { echo "$@" >&2; }
+watch_file() { :; }
+find_up() { [[ -n %q ]] && echo %q; }
+export FAKE_VIOLATION=%q
+source %q
+if use_gh_autoprofile bob-work bob@gmail.com; then echo RESULT=activated; else echo RESULT=refused; fi
+echo USER=${GH_AUTOPROFILE_USER:-}
+`, fakeBin, tc.findUp, tc.findUp, tc.violation, libPath)
+
+			out, err := exec.Command("bash", "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash script failed: %v\noutput:\n%s", err, string(out))
+			}
+
+			s := string(out)
+			if !strings.Contains(s, tc.want) {
+				t.Errorf("expected output to contain %q, got:\n%s", tc.want, s)
+			}
+			refused := tc.violation != ""
+			if refused != strings.Contains(s, "RESULT=refused") {
+				t.Errorf("refused = %v, got:\n%s", refused, s)
+			}
+			if refused && strings.Contains(s, "USER=bob-work") {
+				t.Errorf("marker exported despite policy violation:\n%s", s)
+			}
+		})
+	}
+}
+
+func TestWriteEnvrc_Indirect(t *testing.T) {
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, GitEmail: "alice@example.com", SSHKey: "/home/alice/.ssh/id", Indirect: true}
+
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, ".envrc"))
+	if err != nil {
+		t.Fatalf("cannot read .envrc: %v", err)
+	}
+	expected := "# gh-autoprofile:start\nuse gh_autoprofile\n# gh-autoprofile:end\n"
+	if string(content) != expected {
+		t.Errorf("unexpected .envrc content:\ngot:  %q\nwant: %q", string(content), expected)
+	}
+
+	// Editing the pin's settings leaves the block current.
+	pin.GitEmail = "alice@acme.com"
+	pin.Protected = true
+	if ok, err := BlockCurrent(pin); !ok || err != nil {
+		t.Errorf("BlockCurrent after edit = %v, %v; want true", ok, err)
+	}
+	if _, ok := ParseBlock(string(content)); ok {
+		t.Error("ParseBlock found settings in an indirect block")
+	}
+
+	script := ResolveScript(pin, "/cfg/pins.yml")
+	want := "watch_file /cfg/pins.yml\nuse_gh_autoprofile alice alice@acme.com\ngh_autoprofile_protect\n"
+	if script != want {
+		t.Errorf("ResolveScript:\ngot:  %q\nwant: %q", script, want)
+	}
+}
+
+func TestShellLib_IndirectResolves(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skipf("bash not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	libPath := filepath.Join(tmpDir, "lib.sh")
+	if err := os.WriteFile(libPath, shellLibContent, 0700); err != nil {
+		t.Fatalf("cannot write lib file: %v", err)
+	}
+
+	fakeBin := filepath.Join(tmpDir, "bin")
+	if err := os.MkdirAll(fakeBin, 0755); err != nil {
+		t.Fatalf("cannot create fake bin dir: %v", err)
+	}
+	fakeGh := "#!/usr/bin/env bash\n" +
+		"if [[ \"$1 $2\" == \"autoprofile resolve\" ]]; then\n" +
+		"  [[ -z \"$FAKE_PIN\" ]] && { echo \"no pin for $4\" >&2; exit 1; }\n" +
+		"  printf \"watch_file '/cfg/pins.yml'\\nuse_gh_autoprofile %s 'bob@acme.com'\\n\" \"$FAKE_PIN\"\n" +
+		"  exit 0\n" +
+		"fi\n" +
+		"echo token-$4\n"
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte(fakeGh), 0755); err != nil {
+		t.Fatalf("cannot write fake gh: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		pin  string
+		want []string
+	}{
+		{"pinned", "bob-work", []string{"RESULT=activated", "WATCH=/cfg/pins.yml", "USER=bob-work", "EMAIL=bob@acme.com"}},
+		{"unpinned", "", []string{"RESULT=refused", "no pin for", "USER=\n"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			script := fmt.Sprintf(`export PATH=%q:$PATH
+log_status() { :; }
+log_error() { echo "$@" >&2; }
+watch_file() { echo "WATCH=$1"; }
+find_up() { return 1; }
+export FAKE_PIN=%q
+source %q
+if use_gh_autoprofile; then echo RESULT=activated; else echo RESULT=refused; fi
+echo USER=${GH_AUTOPROFILE_USER:-}
+echo EMAIL=${GIT_AUTHOR_EMAIL:-}
+`, fakeBin, tc.pin, libPath)
+
+			out, err := exec.Command("bash", "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash script failed: %v\noutput:\n%s", err, string(out))
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteEnvrc_LocalFile(t *testing.T) {
+	dir := t.TempDir()
+	envrc := filepath.Join(dir, ".envrc")
+	local := filepath.Join(dir, ".envrc.local")
+	if err := os.WriteFile(envrc, []byte("use flake\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pin := config.Pin{User: "alice", Dir: dir, GitEmail: "alice@example.com", EnvrcFile: ".envrc.local"}
+
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+	data, _ := os.ReadFile(envrc)
+	want := "use flake\n# gh-autoprofile:start\nsource_env_if_exists .envrc.local\n# gh-autoprofile:end\n"
+	if string(data) != want {
+		t.Errorf(".envrc:\ngot:  %q\nwant: %q", data, want)
+	}
+	data, _ = os.ReadFile(local)
+	if string(data) != RenderBlock(pin) {
+		t.Errorf(".envrc.local = %q, want %q", data, RenderBlock(pin))
+	}
+	if ok, err := BlockCurrent(pin); !ok || err != nil {
+		t.Errorf("BlockCurrent = %v, %v; want true", ok, err)
+	}
+	got, ok, err := ReadEnvrcPin(dir)
+	if err != nil || !ok {
+		t.Fatalf("ReadEnvrcPin = %v, %v", ok, err)
+	}
+	if changes := config.DiffPins(pin, got); len(changes) != 0 {
+		t.Errorf("ReadEnvrcPin changed fields: %+v", changes)
+	}
+
+	// A line of the user's own loading the file replaces our block.
+	if err := os.WriteFile(envrc, []byte("source_env_if_exists ./.envrc.local\n"+want[len("use flake\n"):]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+	if data, _ := os.ReadFile(envrc); string(data) != "source_env_if_exists ./.envrc.local\n" {
+		t.Errorf(".envrc with a user source line = %q", data)
+	}
+	if ok, err := BlockCurrent(pin); !ok || err != nil {
+		t.Errorf("BlockCurrent with a user source line = %v, %v; want true", ok, err)
+	}
+
+	if err := RemoveEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("RemoveEnvrc failed: %v", err)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf(".envrc.local still exists after RemoveEnvrc: %v", err)
+	}
+	if data, _ := os.ReadFile(envrc); string(data) != "source_env_if_exists ./.envrc.local\n" {
+		t.Errorf(".envrc after RemoveEnvrc = %q", data)
+	}
+}
+
+func TestLoads_FollowsSourceChain(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".envrc":        "dotenv_if_exists\nsource_env config\n",
+		"config/.envrc": "source_env_if_exists '../.envrc.local'\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]bool{".envrc.local": true, "config/.envrc": true, ".envrc.other": false} {
+		if got, err := Loads(dir, name); got != want || err != nil {
+			t.Errorf("Loads(%s) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+
+	// The chain already loads the file, so no block is added to .envrc.
+	pin := config.Pin{User: "alice", Dir: dir, EnvrcFile: ".envrc.local"}
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".envrc")); string(data) != files[".envrc"] {
+		t.Errorf(".envrc changed: %q", data)
+	}
+	if ok, err := BlockCurrent(pin); !ok || err != nil {
+		t.Errorf("BlockCurrent = %v, %v; want true", ok, err)
+	}
+}
+
+func TestReadEnvrcPin_RoundTrip(t *testing.T) {
+	tests := []config.Pin{
+		{User: "alice", Mode: config.ModeWrapper},
+		{User: "bob-work", Mode: config.ModeExport, GitEmail: "bob@acme.com", GitName: "Bob O'Brien", SSHKey: "/home/bob/.ssh/id work"},
+		{User: "acme-admin", Mode: config.ModeWrapper, Protected: true, Host: "ghe.acme.com", Orgs: []string{"acme", "acme-labs"}, Strict: true},
+	}
+
+	for _, want := range tests {
+		t.Run(want.User, func(t *testing.T) {
+			dir := t.TempDir()
+			want.Dir = dir
+			if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("export FOO=1\n"), 0600); err != nil {
+				t.Fatalf("cannot write .envrc: %v", err)
+			}
+			if err := WriteEnvrc(want, config.PermAuto); err != nil {
+				t.Fatalf("WriteEnvrc failed: %v", err)
+			}
+
+			got, ok, err := ReadEnvrcPin(dir)
+			if err != nil || !ok {
+				t.Fatalf("ReadEnvrcPin = %v, %v", ok, err)
+			}
+			if changes := config.DiffPins(want, got); len(changes) != 0 {
+				t.Errorf("round trip changed fields: %+v", changes)
+			}
+		})
+	}
+}
+
+func TestReadEnvrcPin_NoBlock(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok, err := ReadEnvrcPin(dir); ok || err != nil {
+		t.Errorf("missing .envrc: ok=%v err=%v", ok, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("use nix\n"), 0600); err != nil {
+		t.Fatalf("cannot write .envrc: %v", err)
+	}
+	if _, ok, err := ReadEnvrcPin(dir); ok || err != nil {
+		t.Errorf("unmanaged .envrc: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestReadEnvrcPin_FollowsUserSourceLines(t *testing.T) {
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeWrapper, EnvrcFile: ".envrc.local"}
+	if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("use nix\nsource_env_if_exists .envrc.local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".envrc.local"), []byte(RenderBlock(pin)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := ReadEnvrcPin(dir)
+	if err != nil || !ok {
+		t.Fatalf("ReadEnvrcPin = %v, %v", ok, err)
+	}
+	if changes := config.DiffPins(pin, got); len(changes) != 0 {
+		t.Errorf("ReadEnvrcPin changed fields: %+v", changes)
+	}
+}
+
+func TestReadEnvrcPin_Indirect(t *testing.T) {
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, Indirect: true}
+	if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte(RenderBlock(pin)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := ReadEnvrcPin(dir)
+	if err != nil || !ok {
+		t.Fatalf("ReadEnvrcPin = %v, %v", ok, err)
+	}
+	want := config.Pin{Dir: dir, Indirect: true}
+	if changes := config.DiffPins(want, got); len(changes) != 0 {
+		t.Errorf("expected an indirect pin naming no account, got %+v", got)
+	}
+}
+
+func TestCheckEnvrc_PinFile(t *testing.T) {
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, EnvrcFile: ".envrc.local"}
+	if err := os.WriteFile(filepath.Join(dir, ".envrc.local"), []byte("# gh-autoprofile:start\nuse_gh_autoprofile alice\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("# gh-autoprofile:end\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := CheckEnvrc(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v, want one per file", problems)
+	}
+	if !errors.Is(problems[0], ErrUnterminatedBlock) || problems[0].File != "" {
+		t.Errorf("problems[0] = %v, want the unterminated block of .envrc.local", problems[0])
+	}
+	if !errors.Is(problems[1], ErrStrayEndMarker) || problems[1].Error() != ".envrc line 1: "+ErrStrayEndMarker.Error() {
+		t.Errorf("problems[1] = %v, want the stray end marker of .envrc", problems[1])
+	}
+}
+
+func TestSnapshot_Restore(t *testing.T) {
+	existing := t.TempDir()
+	fresh := t.TempDir()
+	original := "export FOO=1\n"
+	if err := os.WriteFile(filepath.Join(existing, ".envrc"), []byte(original), 0644); err != nil {
+		t.Fatalf("cannot write .envrc: %v", err)
+	}
+
+	var snap Snapshot
+	for _, dir := range []string{existing, fresh, existing} {
+		if err := snap.Capture(dir); err != nil {
+			t.Fatalf("Capture failed: %v", err)
+		}
+	}
+	for _, dir := range []string{existing, fresh} {
+		if err := WriteEnvrc(config.Pin{User: "alice", Dir: dir}, config.PermAuto); err != nil {
+			t.Fatalf("WriteEnvrc failed: %v", err)
+		}
+	}
+
+	if err := snap.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(existing, ".envrc"))
+	if err != nil || string(content) != original {
+		t.Errorf("existing .envrc not restored: %q, %v", content, err)
+	}
+	if fi, err := os.Stat(filepath.Join(existing, ".envrc")); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("existing .envrc mode not restored: %v", fi.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(fresh, ".envrc")); !os.IsNotExist(err) {
+		t.Errorf("new .envrc should have been removed, stat err = %v", err)
+	}
+}
+
+func TestBlockCurrent(t *testing.T) {
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, GitEmail: "a@x.com"}
+
+	if ok, err := BlockCurrent(pin); ok || err != nil {
+		t.Errorf("missing .envrc: ok=%v err=%v", ok, err)
+	}
+	if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatalf("WriteEnvrc failed: %v", err)
+	}
+	if ok, err := BlockCurrent(pin); !ok || err != nil {
+		t.Errorf("fresh block: ok=%v err=%v", ok, err)
+	}
+
+	pin.Protected = true
+	if ok, _ := BlockCurrent(pin); ok {
+		t.Error("block without gh_autoprofile_protect reported current")
+	}
+}
+
+func TestEnvrcBlocks_Malformed(t *testing.T) {
+	pin := config.Pin{User: "alice"}
+	block := RenderBlock(pin)
+	old := markerStart + "\nuse_gh_autoprofile bob\n" + markerEnd + "\n"
+
+	tests := []struct {
+		name     string
+		content  string
+		problems []error
+		repaired string
+	}{
+		{
+			name:     "well-formed",
+			content:  "export A=1\n" + old,
+			repaired: "export A=1\n" + block,
+		},
+		{
+			name:     "no block",
+			content:  "export A=1\n",
+			repaired: "export A=1\n" + block,
+		},
+		{
+			name:     "duplicate blocks",
+			content:  old + "export A=1\n" + old,
+			problems: []error{ErrDuplicateBlock},
+			repaired: block + "export A=1\n",
+		},
+		{
+			name:     "end before start",
+			content:  markerEnd + "\nexport A=1\n" + markerStart + "\nuse_gh_autoprofile bob\n",
+			problems: []error{ErrStrayEndMarker, ErrUnterminatedBlock},
+			repaired: block + "export A=1\n",
+		},
+		{
+			name:     "missing end marker",
+			content:  "export A=1\n" + markerStart + "\nuse_gh_autoprofile bob\ngh_autoprofile_protect\nexport B=2\n",
+			problems: []error{ErrUnterminatedBlock},
+			repaired: "export A=1\n" + block + "export B=2\n",
+		},
+		{
+			name:     "missing start marker",
+			content:  "export A=1\nuse_gh_autoprofile bob\n" + markerEnd + "\n",
+			problems: []error{ErrStrayEndMarker},
+			repaired: "export A=1\n" + block,
+		},
+		{
+			name:     "nested start",
+			content:  markerStart + "\n" + old + "export A=1\n",
+			problems: []error{ErrUnterminatedBlock},
+			repaired: block + "export A=1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			envrcPath := filepath.Join(dir, ".envrc")
+			if err := os.WriteFile(envrcPath, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			pin := pin
+			pin.Dir = dir
+
+			problems, err := CheckEnvrc(config.Pin{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("CheckEnvrc = %v, want %v", problems, tt.problems)
+			}
+			for i, want := range tt.problems {
+				if !errors.Is(problems[i], want) {
+					t.Errorf("problem %d = %v, want %v", i, problems[i], want)
+				}
+			}
+
+			var malformed *MalformedError
+			if err := WriteEnvrc(pin, config.PermAuto); len(tt.problems) > 0 {
+				if !errors.As(err, &malformed) {
+					t.Errorf("WriteEnvrc = %v, want *MalformedError", err)
+				}
+				if err := RemoveEnvrc(config.Pin{Dir: dir}, config.PermAuto); !errors.As(err, &malformed) {
+					t.Errorf("RemoveEnvrc = %v, want *MalformedError", err)
+				}
+				if data, _ := os.ReadFile(envrcPath); string(data) != tt.content {
+					t.Errorf("malformed .envrc was modified:\n%s", data)
+				}
+			} else if err != nil {
+				t.Fatalf("WriteEnvrc: %v", err)
+			}
+
+			if err := RepairEnvrcWith(plan.Disk, pin, config.PermAuto); err != nil {
+				t.Fatalf("RepairEnvrcWith: %v", err)
+			}
+			data, _ := os.ReadFile(envrcPath)
+			if string(data) != tt.repaired {
+				t.Errorf("repaired .envrc =\n%s\nwant:\n%s", data, tt.repaired)
+			}
+			if problems, _ := CheckEnvrc(config.Pin{Dir: dir}); len(problems) != 0 {
+				t.Errorf("problems after repair: %v", problems)
+			}
+			if current, _ := BlockCurrent(pin); !current {
+				t.Error("BlockCurrent = false after repair")
+			}
+		})
+	}
+}
+
+func TestInjectHookSource_Malformed(t *testing.T) {
+	rcPath := filepath.Join(t.TempDir(), ".zshrc")
+	hookPath := "/home/u/.config/gh-autoprofile/hook.sh"
+	block := hookMarkerStart + "\nsource \"" + hookPath + "\"\n" + hookMarkerEnd + "\n"
+	content := "export EDITOR=vim\n" + block + "alias ll='ls -l'\n" + hookMarkerStart + "\nsource \"/old/hook.sh\"\n"
+	if err := os.WriteFile(rcPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := CheckHookSource(rcPath)
+	if err != nil || len(problems) != 1 || !errors.Is(problems[0], ErrUnterminatedBlock) || problems[0].Line != 6 {
+		t.Fatalf("CheckHookSource = %v, %v; want unterminated block at line 6", problems, err)
+	}
+	var malformed *MalformedError
+	if err := InjectHookSource(rcPath, hookPath); !errors.As(err, &malformed) {
+		t.Fatalf("InjectHookSource = %v, want *MalformedError", err)
+	}
+
+	if err := RepairHookSourceWith(plan.Disk, rcPath, hookPath); err != nil {
+		t.Fatalf("RepairHookSourceWith: %v", err)
+	}
+	data, _ := os.ReadFile(rcPath)
+	if want := "export EDITOR=vim\n" + block + "alias ll='ls -l'\n"; string(data) != want {
+		t.Errorf("repaired RC =\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestParseBlock_Malformed(t *testing.T) {
+	content := "export A=1\n" + markerStart + "\nuse_gh_autoprofile alice a@x.io\n"
+	pin, ok := ParseBlock(content)
+	if !ok || pin.User != "alice" || pin.GitEmail != "a@x.io" {
+		t.Errorf("ParseBlock(unterminated) = %+v, %v", pin, ok)
+	}
+	if _, ok := ParseBlock("use_gh_autoprofile alice\n" + markerEnd + "\n"); ok {
+		t.Error("ParseBlock found a pin outside any block")
+	}
+}
+
+func TestWriteEnvrc_PermissionPolicy(t *testing.T) {
+	write := func(t *testing.T, policy config.PermissionPolicy, mode config.PinMode, existing os.FileMode) os.FileMode {
+		t.Helper()
+		dir := t.TempDir()
+		envrcPath := filepath.Join(dir, ".envrc")
+		if err := os.WriteFile(envrcPath, []byte("export A=1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(envrcPath, existing); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteEnvrc(config.Pin{User: "alice", Dir: dir, Mode: mode}, policy); err != nil {
+			t.Fatal(err)
+		}
+		fi, _ := os.Stat(envrcPath)
+		return fi.Mode().Perm()
+	}
+
+	if got := write(t, config.PermAuto, config.ModeWrapper, 0664); got != 0664 {
+		t.Errorf("auto/wrapper: mode %04o, want 0664 preserved", got)
+	}
+	if got := write(t, config.PermAuto, config.ModeExport, 0664); got != 0600 {
+		t.Errorf("auto/export: mode %04o, want 0600", got)
+	}
+	if got := write(t, config.PermStrict, config.ModeWrapper, 0644); got != 0600 {
+		t.Errorf("strict: mode %04o, want 0600", got)
+	}
+	if got := write(t, config.PermPreserve, config.ModeExport, 0644); got != 0644 {
+		t.Errorf("preserve: mode %04o, want 0644", got)
+	}
+}
+
+func TestShellHook_PromptSegment(t *testing.T) {
+	tmpDir := t.TempDir()
+	hookPath := filepath.Join(tmpDir, "hook.sh")
+	if err := os.WriteFile(hookPath, shellHookContent, 0700); err != nil {
+		t.Fatalf("cannot write hook file: %v", err)
+	}
+
+	script := fmt.Sprintf(`source %q
+unset GH_AUTOPROFILE_USER GH_TOKEN
+gh_autoprofile_prompt || echo "inactive"
+GH_AUTOPROFILE_USER=bob-work gh_autoprofile_prompt; echo
+GH_AUTOPROFILE_USER=bob-work GH_TOKEN=t gh_autoprofile_prompt '[{user}|{mode}]'; echo
+`, hookPath)
+	want := "inactive\ngh:bob-work(wrapper)\n[bob-work|export]\n"
+
+	for _, shell := range []string{"bash", "zsh"} {
+		t.Run(shell, func(t *testing.T) {
+			if _, err := exec.LookPath(shell); err != nil {
+				t.Skipf("%s not available: %v", shell, err)
+			}
+			out, err := exec.Command(shell, "-c", script).CombinedOutput()
+			if err != nil {
+				t.Fatalf("%s script failed: %v\noutput:\n%s", shell, err, out)
+			}
+			if string(out) != want {
+				t.Errorf("got:\n%s\nwant:\n%s", out, want)
+			}
+		})
+	}
+}
+
+func TestPlan_ChainedEnvrcChangesMatchDisk(t *testing.T) {
+	// Moving a pin's block from .envrc.local back to .envrc removes the
+	// pointer-only .envrc, then writes it again: a plan must end where the
+	// disk does.
+	setup := func(t *testing.T) (old, moved config.Pin) {
+		dir := t.TempDir()
+		old = config.Pin{User: "alice", Dir: dir, EnvrcFile: ".envrc.local"}
+		if err := WriteEnvrc(old, config.PermAuto); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(dir, ".envrc"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		moved = old
+		moved.EnvrcFile = ""
+		return old, moved
+	}
+	apply := func(x plan.Executor, old, moved config.Pin) {
+		t.Helper()
+		if err := RemoveEnvrcWith(x, old, config.PermAuto); err != nil {
+			t.Fatalf("RemoveEnvrcWith: %v", err)
+		}
+		if err := WriteEnvrcWith(x, moved, config.PermAuto); err != nil {
+			t.Fatalf("WriteEnvrcWith: %v", err)
+		}
+	}
+
+	old, moved := setup(t)
+	p := plan.New()
+	apply(p, old, moved)
+	envrc := filepath.Join(old.Dir, ".envrc")
+	planned, err := p.ReadFile(envrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plannedInfo, err := p.Stat(envrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, moved = setup(t)
+	apply(plan.Disk, old, moved)
+	envrc = filepath.Join(old.Dir, ".envrc")
+	written, err := os.ReadFile(envrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(envrc)
+
+	if string(planned) != string(written) {
+		t.Errorf("planned .envrc:\n%s\nwritten:\n%s", planned, written)
+	}
+	if plannedInfo.Mode().Perm() != fi.Mode().Perm() {
+		t.Errorf("planned mode %04o, written %04o", plannedInfo.Mode().Perm(), fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,92 @@
+package direnv
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+//go:embed shell/gh-autoprofile-mise.sh
+var miseScriptContent []byte
+
+// MiseScriptPath returns the path of the script mise.toml files source
+// with _.source.
+func MiseScriptPath() (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mise.sh"), nil
+}
+
+// InstallMiseScriptWith writes the mise script through x.
+func InstallMiseScriptWith(x plan.Executor) (string, error) {
+	path, err := MiseScriptPath()
+	if err != nil {
+		return "", err
+	}
+	if err := x.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := x.WriteFile(path, miseScriptContent, 0644); err != nil {
+		return "", fmt.Errorf("cannot write mise script: %w", err)
+	}
+	return path, nil
+}
+
+// ShellExports returns POSIX shell commands that export the variables of
+// pin: the PinEnv variables and, for an export-mode pin, GH_TOKEN and
+// GITHUB_TOKEN read from gh when the commands run. Tools that source a
+// script for their environment (mise's _.source, a Nix shellHook) use
+// this instead of the direnv library.
+func ShellExports(pin config.Pin) string {
+	var b strings.Builder
+	if pin.EffectiveMode() == config.ModeExport {
+		b.WriteString("export GH_TOKEN=\"$(gh auth token --user " + shellQuote(pin.User) + ")\"\n")
+		b.WriteString("export GITHUB_TOKEN=\"$GH_TOKEN\"\n")
+	}
+	for _, v := range PinEnv(pin) {
+		b.WriteString("export " + v.Name + "=" + shellQuote(v.Value) + "\n")
+	}
+	return b.String()
+}
+
+// MiseEnv returns an [env] table for mise.toml that sets the variables of
+// pin. The token of an export-mode pin is read from gh by a template when
+// mise loads the file.
+func MiseEnv(pin config.Pin) string {
+	var b strings.Builder
+	b.WriteString("[env]\n")
+	if pin.EffectiveMode() == config.ModeExport {
+		token := fmt.Sprintf("{{ exec(command='gh auth token --user %s') }}", pin.User)
+		b.WriteString("GH_TOKEN = " + tomlQuote(token) + "\n")
+		b.WriteString("GITHUB_TOKEN = " + tomlQuote(token) + "\n")
+	}
+	for _, v := range PinEnv(pin) {
+		b.WriteString(v.Name + " = " + tomlQuote(v.Value) + "\n")
+	}
+	return b.String()
+}
+
+// tomlQuote returns s as a TOML basic string.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
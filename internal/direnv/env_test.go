@@ -0,0 +1,106 @@
+package direnv
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func TestWriteEnvrc_AfterDevshell(t *testing.T) {
+	pin := config.Pin{User: "alice", GitEmail: "alice@example.com"}
+	block := RenderBlock(pin)
+
+	tests := []struct {
+		name, before, want string
+	}{
+		{"appended after use flake", "use flake\n", "use flake\n" + block},
+		{"moved below a later use nix", block + "use nix\nexport A=1\n", "use nix\n" + block + "export A=1\n"},
+		{"moved below the last devshell line", block + "use flake .#ci\nuse_nix\n", "use flake .#ci\nuse_nix\n" + block},
+		{"kept when already after", "use flake\n" + block + "export A=1\n", "use flake\n" + block + "export A=1\n"},
+		{"unterminated last line", block + "use devenv", "use devenv\n" + block},
+		{"other use lines ignored", block + "use node 20\n", block + "use node 20\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pin.Dir = t.TempDir()
+			envrc := filepath.Join(pin.Dir, ".envrc")
+			if err := os.WriteFile(envrc, []byte(tc.before), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := BlockCurrent(pin); ok != (tc.before == tc.want) {
+				t.Errorf("BlockCurrent before WriteEnvrc = %v", ok)
+			}
+
+			if err := WriteEnvrc(pin, config.PermAuto); err != nil {
+				t.Fatalf("WriteEnvrc failed: %v", err)
+			}
+			data, _ := os.ReadFile(envrc)
+			if string(data) != tc.want {
+				t.Errorf(".envrc:\ngot:  %q\nwant: %q", data, tc.want)
+			}
+			if _, line, _ := ShadowedBlock(pin); line != "" {
+				t.Errorf("ShadowedBlock after WriteEnvrc = %q", line)
+			}
+			if ok, _ := BlockCurrent(pin); !ok {
+				t.Error("BlockCurrent after WriteEnvrc = false")
+			}
+		})
+	}
+}
+
+func TestShellExports(t *testing.T) {
+	pin := config.Pin{User: "bob-work", Mode: config.ModeExport, GitEmail: "bob@acme.com", GitName: "Bob O'Neil"}
+	want := `export GH_TOKEN="$(gh auth token --user bob-work)"
+export GITHUB_TOKEN="$GH_TOKEN"
+export GH_AUTOPROFILE_USER=bob-work
+export GIT_AUTHOR_EMAIL=bob@acme.com
+export GIT_COMMITTER_EMAIL=bob@acme.com
+export GIT_AUTHOR_NAME='Bob O'\''Neil'
+export GIT_COMMITTER_NAME='Bob O'\''Neil'
+`
+	if got := ShellExports(pin); got != want {
+		t.Errorf("ShellExports() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skipf("sh not available: %v", err)
+	}
+	fakeBin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte("#!/bin/sh\necho token-$4\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := "PATH=" + fakeBin + ":$PATH\n" + want + `echo "$GH_TOKEN|$GITHUB_TOKEN|$GH_AUTOPROFILE_USER|$GIT_AUTHOR_NAME"`
+	out, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sh failed: %v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "token-bob-work|token-bob-work|bob-work|Bob O'Neil" {
+		t.Errorf("evaluated exports = %q", got)
+	}
+}
+
+func TestMiseEnv(t *testing.T) {
+	pin := config.Pin{
+		User:      "bob-work",
+		Mode:      config.ModeExport,
+		GitName:   `Bob "B" O'Neil`,
+		SSHKey:    "/keys/id_work",
+		Protected: true,
+	}
+	want := `[env]
+GH_TOKEN = "{{ exec(command='gh auth token --user bob-work') }}"
+GITHUB_TOKEN = "{{ exec(command='gh auth token --user bob-work') }}"
+GH_AUTOPROFILE_USER = "bob-work"
+GIT_AUTHOR_NAME = "Bob \"B\" O'Neil"
+GIT_COMMITTER_NAME = "Bob \"B\" O'Neil"
+GIT_SSH_COMMAND = "ssh -i '/keys/id_work' -o IdentitiesOnly=yes"
+GH_AUTOPROFILE_PROTECTED = "1"
+`
+	if got := MiseEnv(pin); got != want {
+		t.Errorf("MiseEnv() =\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,309 @@
+package direnv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// Malformed managed-block conditions, reported through BlockError.
+var (
+	ErrDuplicateBlock    = errors.New("duplicate managed block")
+	ErrUnterminatedBlock = errors.New("start marker without end marker")
+	ErrStrayEndMarker    = errors.New("end marker without start marker")
+)
+
+// BlockError is one malformed-block problem at a 1-based line. File is
+// set when the problem is not in the file the caller asked about.
+type BlockError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *BlockError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s line %d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// MalformedError is returned when a file's managed blocks are not exactly
+// zero or one well-formed block, so editing it could lose or duplicate
+// content.
+type MalformedError struct {
+	Path     string
+	Problems []*BlockError
+	hint     string
+}
+
+func (e *MalformedError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Error()
+	}
+	return fmt.Sprintf("%s: malformed gh-autoprofile block (%s); %s", e.Path, strings.Join(msgs, "; "), e.hint)
+}
+
+func (e *MalformedError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
+
+// blockKind describes a managed block: its marker lines and the lines
+// gh-autoprofile writes between them.
+type blockKind struct {
+	start, end string
+	managed    func(line string) bool
+	// appendSep separates an appended block from existing content.
+	appendSep string
+	// after matches lines the block must follow, or is nil.
+	after func(line string) bool
+	// hint tells the user how to repair a malformed block.
+	hint string
+}
+
+var envrcBlock = blockKind{
+	start: markerStart,
+	end:   markerEnd,
+	managed: func(line string) bool {
+		return strings.HasPrefix(line, "use_gh_autoprofile") || strings.HasPrefix(line, "gh_autoprofile_") ||
+			line == indirectLine || strings.HasPrefix(line, sourceCommand+" ")
+	},
+	after: isDevshellLine,
+	hint:  "fix the markers by hand, or run `gh autoprofile doctor --fix` if the directory is pinned",
+}
+
+var hookBlock = blockKind{
+	start: hookMarkerStart,
+	end:   hookMarkerEnd,
+	managed: func(line string) bool {
+		return strings.HasPrefix(line, "source ") && strings.Contains(line, "hook.sh")
+	},
+	appendSep: "\n",
+	hint:      "run `gh autoprofile setup` to repair it",
+}
+
+// devshellLayouts are the direnv `use` layouts that load a whole
+// development environment. One running after the managed block could
+// replace the variables the block sets.
+var devshellLayouts = map[string]bool{"flake": true, "nix": true, "devenv": true, "mise": true}
+
+// isDevshellLine reports whether an .envrc line loads a devshell, e.g.
+// `use flake` or `use_nix`.
+func isDevshellLine(line string) bool {
+	words := strings.Fields(line)
+	switch {
+	case len(words) >= 2 && words[0] == "use":
+		return devshellLayouts[words[1]]
+	case len(words) >= 1 && strings.HasPrefix(words[0], "use_"):
+		return devshellLayouts[strings.TrimPrefix(words[0], "use_")]
+	}
+	return false
+}
+
+// blockLine is one line of a file, including its newline.
+type blockLine struct {
+	text       string
+	start, end int
+}
+
+// parsedBlocks is the result of scanning a file for managed blocks.
+// Markers only count when they are a whole line.
+type parsedBlocks struct {
+	content  string
+	lines    []blockLine
+	blocks   [][2]int // line indices of well-formed start and end markers
+	stray    []int    // line indices of unmatched markers
+	problems []*BlockError
+}
+
+func parseBlocks(content string, k blockKind) parsedBlocks {
+	p := parsedBlocks{content: content}
+	for off := 0; off < len(content); {
+		end := strings.IndexByte(content[off:], '\n')
+		if end == -1 {
+			end = len(content)
+		} else {
+			end += off + 1
+		}
+		p.lines = append(p.lines, blockLine{text: content[off:end], start: off, end: end})
+		off = end
+	}
+
+	open := -1
+	for i, l := range p.lines {
+		switch strings.TrimSpace(l.text) {
+		case k.start:
+			if open != -1 {
+				p.unmatched(open, ErrUnterminatedBlock)
+			}
+			open = i
+		case k.end:
+			if open == -1 {
+				p.unmatched(i, ErrStrayEndMarker)
+				continue
+			}
+			p.blocks = append(p.blocks, [2]int{open, i})
+			open = -1
+		}
+	}
+	if open != -1 {
+		p.unmatched(open, ErrUnterminatedBlock)
+	}
+	for _, b := range p.blocks[min(1, len(p.blocks)):] {
+		p.problems = append(p.problems, &BlockError{Line: b[0] + 1, Err: ErrDuplicateBlock})
+	}
+	sort.Slice(p.problems, func(i, j int) bool { return p.problems[i].Line < p.problems[j].Line })
+	return p
+}
+
+func (p *parsedBlocks) unmatched(line int, err error) {
+	p.stray = append(p.stray, line)
+	p.problems = append(p.problems, &BlockError{Line: line + 1, Err: err})
+}
+
+// found reports whether the file has any managed block or marker.
+func (p parsedBlocks) found() bool {
+	return len(p.blocks) > 0 || len(p.stray) > 0
+}
+
+// first returns the text of the first well-formed block, markers
+// included, or "".
+func (p parsedBlocks) first() string {
+	if len(p.blocks) == 0 {
+		return ""
+	}
+	b := p.blocks[0]
+	return p.content[p.lines[b[0]].start:p.lines[b[1]].end]
+}
+
+// splice returns the content with every managed block and stray marker
+// removed and block inserted where the first of them was, or appended
+// when there was none. Managed lines directly after an unterminated start
+// or before a stray end marker are removed with it. If lines the block
+// must follow (k.after) come later, the block moves directly after the
+// last of them.
+func (p parsedBlocks) splice(k blockKind, block string) string {
+	remove := map[int]bool{}
+	for _, b := range p.blocks {
+		for i := b[0]; i <= b[1]; i++ {
+			remove[i] = true
+		}
+	}
+	for _, s := range p.stray {
+		remove[s] = true
+		step := 1
+		if strings.TrimSpace(p.lines[s].text) == k.end {
+			step = -1
+		}
+		for i := s + step; i >= 0 && i < len(p.lines) && !remove[i] && k.managed(strings.TrimSpace(p.lines[i].text)); i += step {
+			remove[i] = true
+		}
+	}
+
+	if len(remove) == 0 {
+		content := p.content
+		if block == "" {
+			return content
+		}
+		if len(content) > 0 && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if len(content) > 0 || k.appendSep != "" {
+			content += k.appendSep
+		}
+		return content + block
+	}
+
+	last := p.lastAfter(k, remove)
+	var out strings.Builder
+	inserted := false
+	for i, l := range p.lines {
+		if remove[i] {
+			if !inserted && i > last {
+				out.WriteString(block)
+				inserted = true
+			}
+			continue
+		}
+		out.WriteString(l.text)
+		if i == last && !inserted {
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n")
+			}
+			out.WriteString(block)
+			inserted = true
+		}
+	}
+	return out.String()
+}
+
+// lastAfter returns the index of the last line, outside skip, that a
+// block of kind k must follow, or -1.
+func (p parsedBlocks) lastAfter(k blockKind, skip map[int]bool) int {
+	last := -1
+	if k.after == nil {
+		return last
+	}
+	for i, l := range p.lines {
+		if !skip[i] && k.after(strings.TrimSpace(l.text)) {
+			last = i
+		}
+	}
+	return last
+}
+
+// shadowing returns the first line after the first well-formed block
+// that the block must follow, or "" when the block is placed correctly.
+func (p parsedBlocks) shadowing(k blockKind) string {
+	if len(p.blocks) == 0 || k.after == nil {
+		return ""
+	}
+	for _, l := range p.lines[p.blocks[0][1]+1:] {
+		if line := strings.TrimSpace(l.text); k.after(line) {
+			return line
+		}
+	}
+	return ""
+}
+
+// spliceFile reads path through x and returns its content with block in
+// place of its managed blocks. Unless repair is set, malformed blocks are
+// refused with a *MalformedError. exists is false when path does not
+// exist.
+func spliceFile(x plan.Executor, path string, k blockKind, block string, repair bool) (content string, found, exists bool, err error) {
+	data, err := x.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", false, false, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	p := parseBlocks(string(data), k)
+	if len(p.problems) > 0 && !repair {
+		return "", true, true, &MalformedError{Path: path, Problems: p.problems, hint: k.hint}
+	}
+	return p.splice(k, block), p.found(), err == nil, nil
+}
+
+// checkFile returns the malformed-block problems of path; none when the
+// file is missing or well-formed.
+func checkFile(path string, k blockKind) ([]*BlockError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	return parseBlocks(string(data), k).problems, nil
+}
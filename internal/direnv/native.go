@@ -0,0 +1,85 @@
+package direnv
+
+import (
+	_ "embed"
+	"os"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+//go:embed shell/gh-autoprofile-native.sh
+var nativeHookContent []byte
+
+// nativeBinPlaceholder is replaced with the path of the running binary
+// when the native backend is installed, so the hook does not pay for gh's
+// extension dispatch on every directory change.
+const nativeBinPlaceholder = "@GH_AUTOPROFILE_BIN@"
+
+// EnvVar is an environment variable set when a pin is activated.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// PinEnv returns the variables the direnv library exports for pin, in
+// order, except the token itself: GH_TOKEN and GITHUB_TOKEN are read from
+// gh when an export-mode pin is activated.
+func PinEnv(pin config.Pin) []EnvVar {
+	env := []EnvVar{{"GH_AUTOPROFILE_USER", pin.User}}
+	if pin.GitEmail != "" {
+		env = append(env, EnvVar{"GIT_AUTHOR_EMAIL", pin.GitEmail}, EnvVar{"GIT_COMMITTER_EMAIL", pin.GitEmail})
+	}
+	if pin.GitName != "" {
+		env = append(env, EnvVar{"GIT_AUTHOR_NAME", pin.GitName}, EnvVar{"GIT_COMMITTER_NAME", pin.GitName})
+	}
+	if pin.SSHKey != "" {
+		env = append(env, EnvVar{"GIT_SSH_COMMAND", "ssh -i '" + pin.SSHKey + "' -o IdentitiesOnly=yes"})
+	}
+	if pin.Protected {
+		env = append(env, EnvVar{"GH_AUTOPROFILE_PROTECTED", "1"})
+	}
+	if len(pin.Orgs) > 0 || pin.Strict {
+		env = append(env, EnvVar{"GH_AUTOPROFILE_ORGS", strings.Join(pin.Orgs, ",")})
+		if pin.Host != "" {
+			env = append(env, EnvVar{"GH_AUTOPROFILE_HOST", pin.Host})
+		}
+		if pin.Strict {
+			env = append(env, EnvVar{"GH_AUTOPROFILE_STRICT", "1"})
+		}
+	}
+	return env
+}
+
+// NativeScript returns the commands the native hook evaluates to activate
+// pin: an account check (which also exports the token in export mode)
+// followed by one recorded assignment per PinEnv variable.
+func NativeScript(pin config.Pin) string {
+	var b strings.Builder
+	b.WriteString("_gh_autoprofile_native_account " + shellQuote(pin.User) + " " + string(pin.EffectiveMode()) + " || return 1\n")
+	for _, v := range PinEnv(pin) {
+		b.WriteString("_gh_autoprofile_native_set " + v.Name + " " + shellQuote(v.Value) + "\n")
+	}
+	return b.String()
+}
+
+// shellHook returns the hook script installed for backend. The native
+// backend appends the directory-change resolver, which runs bin.
+func shellHook(backend config.Backend, bin string) []byte {
+	if backend != config.BackendNative {
+		return shellHookContent
+	}
+	native := strings.Replace(string(nativeHookContent), nativeBinPlaceholder, shellQuote(bin), 1)
+	return append(append([]byte{}, shellHookContent...), native...)
+}
+
+// NativeHookInstalled reports whether the installed hook script includes
+// the native backend.
+func NativeHookInstalled() bool {
+	path, err := ShellHookPath()
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(data), "_gh_autoprofile_native()")
+}
@@ -0,0 +1,173 @@
+package direnv
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func TestNativeScript(t *testing.T) {
+	pin := config.Pin{
+		User:      "bob-work",
+		Mode:      config.ModeExport,
+		GitEmail:  "bob@acme.com",
+		GitName:   "Bob O'Neil",
+		SSHKey:    "/keys/id_work",
+		Protected: true,
+		Host:      "ghe.acme.com",
+		Orgs:      []string{"acme", "acme-labs"},
+		Strict:    true,
+	}
+	want := `_gh_autoprofile_native_account bob-work export || return 1
+_gh_autoprofile_native_set GH_AUTOPROFILE_USER bob-work
+_gh_autoprofile_native_set GIT_AUTHOR_EMAIL bob@acme.com
+_gh_autoprofile_native_set GIT_COMMITTER_EMAIL bob@acme.com
+_gh_autoprofile_native_set GIT_AUTHOR_NAME 'Bob O'\''Neil'
+_gh_autoprofile_native_set GIT_COMMITTER_NAME 'Bob O'\''Neil'
+_gh_autoprofile_native_set GIT_SSH_COMMAND 'ssh -i '\''/keys/id_work'\'' -o IdentitiesOnly=yes'
+_gh_autoprofile_native_set GH_AUTOPROFILE_PROTECTED 1
+_gh_autoprofile_native_set GH_AUTOPROFILE_ORGS 'acme,acme-labs'
+_gh_autoprofile_native_set GH_AUTOPROFILE_HOST ghe.acme.com
+_gh_autoprofile_native_set GH_AUTOPROFILE_STRICT 1
+`
+	if got := NativeScript(pin); got != want {
+		t.Errorf("NativeScript() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// The native backend must export what the direnv library exports for the
+// same pin.
+func TestPinEnv_MatchesShellLib(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skipf("bash not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	libPath := filepath.Join(tmpDir, "lib.sh")
+	if err := os.WriteFile(libPath, shellLibContent, 0700); err != nil {
+		t.Fatalf("cannot write lib file: %v", err)
+	}
+	keyPath := filepath.Join(tmpDir, "id_work")
+	if err := os.WriteFile(keyPath, []byte("key"), 0600); err != nil {
+		t.Fatalf("cannot write key: %v", err)
+	}
+	fakeBin := filepath.Join(tmpDir, "bin")
+	if err := os.MkdirAll(fakeBin, 0755); err != nil {
+		t.Fatalf("cannot create fake bin dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte("#!/usr/bin/env bash\necho token-$4\n"), 0755); err != nil {
+		t.Fatalf("cannot write fake gh: %v", err)
+	}
+
+	pin := config.Pin{
+		User:      "bob-work",
+		GitEmail:  "bob@acme.com",
+		GitName:   "Bob O'Neil",
+		SSHKey:    keyPath,
+		Protected: true,
+		Host:      "ghe.acme.com",
+		Orgs:      []string{"acme", "acme-labs"},
+		Strict:    true,
+	}
+	env := PinEnv(pin)
+	var script strings.Builder
+	fmt.Fprintf(&script, "export PATH=%q:$PATH\nlog_status() { :; }\nlog_error() { echo \"$@\" >&2; }\nfind_up() { return 1; }\nsource %q\n", fakeBin, libPath)
+	script.WriteString(inlineBody(pin))
+	for _, v := range env {
+		fmt.Fprintf(&script, "printf '%%s=%%s\\n' %s \"${%s-(unset)}\"\n", v.Name, v.Name)
+	}
+
+	out, err := exec.Command("bash", "-c", script.String()).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash script failed: %v\noutput:\n%s", err, out)
+	}
+	for _, v := range env {
+		if want := v.Name + "=" + v.Value + "\n"; !strings.Contains(string(out), want) {
+			t.Errorf("direnv library does not set %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestShellHook_NativeLoadsAndRestores(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skipf("bash not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	pinned := filepath.Join(tmpDir, "work")
+	other := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{filepath.Join(pinned, "api"), other} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The resolver prints the pin's commands for the pinned directory and
+	// its subdirectories, and nothing elsewhere.
+	scriptPath := filepath.Join(tmpDir, "pin.out")
+	pin := config.Pin{User: "bob-work", GitEmail: "bob@acme.com", Protected: true}
+	if err := os.WriteFile(scriptPath, []byte(NativeScript(pin)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	resolver := filepath.Join(tmpDir, "gh-autoprofile")
+	fake := fmt.Sprintf("#!/usr/bin/env bash\necho \"$*\" >> %q\ncase \"$4\" in %q|%q/*) cat %q ;; esac\n",
+		filepath.Join(tmpDir, "calls"), pinned, pinned, scriptPath)
+	if err := os.WriteFile(resolver, []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fakeBin := filepath.Join(tmpDir, "bin")
+	if err := os.MkdirAll(fakeBin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fakeBin, "gh"), []byte("#!/usr/bin/env bash\necho token-$4\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	hookPath := filepath.Join(tmpDir, "hook.sh")
+	if err := os.WriteFile(hookPath, shellHook(config.BackendNative, resolver), 0700); err != nil {
+		t.Fatalf("cannot write hook file: %v", err)
+	}
+
+	script := fmt.Sprintf(`export PATH=%q:$PATH
+export GIT_AUTHOR_EMAIL=me@home.org
+unset GH_AUTOPROFILE_USER GIT_COMMITTER_EMAIL
+source %q
+prompt() { eval "$PROMPT_COMMAND"; }
+cd %q; prompt
+echo IN user=${GH_AUTOPROFILE_USER:-} email=$GIT_AUTHOR_EMAIL protected=${GH_AUTOPROFILE_PROTECTED:-} gh=$(type -t gh)
+bash -c 'source %q; cd %q; _gh_autoprofile_native; echo CHILD user=${GH_AUTOPROFILE_USER:-} email=$GIT_AUTHOR_EMAIL'
+cd api; prompt; prompt
+echo SUB user=${GH_AUTOPROFILE_USER:-}
+cd %q; prompt
+echo OUT user=${GH_AUTOPROFILE_USER:-} email=$GIT_AUTHOR_EMAIL committer=${GIT_COMMITTER_EMAIL-unset} gh=$(type -t gh)
+`, fakeBin, hookPath, pinned, hookPath, other, other)
+
+	out, err := exec.Command("bash", "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash script failed: %v\noutput:\n%s", err, out)
+	}
+	for _, want := range []string{
+		"IN user=bob-work email=bob@acme.com protected=1 gh=function\n",
+		"CHILD user= email=me@home.org\n",
+		"SUB user=bob-work\n",
+		"OUT user= email=me@home.org committer=unset gh=file\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	// Repeated prompts in the same directory do not run the resolver.
+	calls, err := os.ReadFile(filepath.Join(tmpDir, "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(calls), "\n"); n != 4 {
+		t.Errorf("resolver ran %d times, want 4:\n%s", n, calls)
+	}
+}
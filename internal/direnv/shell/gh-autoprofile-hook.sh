@@ -9,6 +9,18 @@
 #
 # When GH_AUTOPROFILE_USER is unset (leaving the directory), the wrapper
 # functions are removed and the original commands are restored.
+#
+# When GH_AUTOPROFILE_PROTECTED is set (pins created with --protected), the
+# wrappers ask for confirmation before `git push` and destructive gh
+# operations. Set GH_AUTOPROFILE_CONFIRM=1 to allow them non-interactively.
+#
+# When GH_AUTOPROFILE_ORGS or GH_AUTOPROFILE_STRICT is set (pins created with
+# --org/--strict), `git push` first compares the owner of the remote it
+# pushes to with the pinned account and orgs. Mismatches warn, or refuse in strict mode.
+#
+# While the wrappers are defined, GH_AUTOPROFILE_WRAPPED=gh,git is exported
+# so that child processes such as `gh autoprofile status` can tell whether
+# they are active in this shell. It names functions only, never a token.
 
 # Guard: only load once per shell session.
 [[ -n "$_GH_AUTOPROFILE_HOOK_LOADED" ]] && return 0
@@ -18,13 +30,188 @@ _GH_AUTOPROFILE_HOOK_LOADED=1
 # on every prompt.
 _gh_autoprofile_last_user=""
 _gh_autoprofile_last_has_token=""
+_gh_autoprofile_last_guard=""
+
+# Functions are not inherited by child shells, so a marker inherited from
+# the parent does not describe this shell.
+unset GH_AUTOPROFILE_WRAPPED
+
+# _gh_autoprofile_check_owner [git args...]
+# Compares the host/owner of the remote a `git push` goes to with the
+# pinned account and GH_AUTOPROFILE_ORGS. The remote is the one named in
+# the push (or --repo), else the branch's push remote, else origin; global
+# options such as -C are honoured when looking it up. Returns non-zero only
+# on a mismatch in strict mode.
+_gh_autoprofile_check_owner() {
+  [[ -n "${GH_AUTOPROFILE_ORGS:-}${GH_AUTOPROFILE_STRICT:-}" ]] || return 0
+
+  local -a gitopts
+  gitopts=()
+  local arg="" next="" in_push="" remote=""
+  for arg in "$@"; do
+    case "$next" in
+      global) gitopts+=("$arg"); next=""; continue ;;
+      repo) remote="$arg"; next=""; continue ;;
+      value) next=""; continue ;;
+    esac
+    if [[ -z "$in_push" ]]; then
+      case "$arg" in
+        -C|-c|--git-dir|--work-tree|--namespace) gitopts+=("$arg"); next=global ;;
+        push) in_push=1 ;;
+        *) gitopts+=("$arg") ;;
+      esac
+      continue
+    fi
+    case "$arg" in
+      --repo) next=repo ;;
+      --repo=*) remote="${arg#--repo=}" ;;
+      -o|--push-option|--receive-pack|--exec) next=value ;;
+      -*) ;;
+      *)
+        remote="$arg"
+        break
+        ;;
+    esac
+  done
+
+  if [[ -z "$remote" ]]; then
+    local branch
+    branch=$(command git ${gitopts[@]+"${gitopts[@]}"} symbolic-ref --quiet --short HEAD 2>/dev/null)
+    if [[ -n "$branch" ]]; then
+      remote=$(command git ${gitopts[@]+"${gitopts[@]}"} config "branch.$branch.pushRemote" 2>/dev/null)
+    fi
+    [[ -z "$remote" ]] && remote=$(command git ${gitopts[@]+"${gitopts[@]}"} config remote.pushDefault 2>/dev/null)
+    if [[ -z "$remote" && -n "$branch" ]]; then
+      remote=$(command git ${gitopts[@]+"${gitopts[@]}"} config "branch.$branch.remote" 2>/dev/null)
+    fi
+    [[ -z "$remote" ]] && remote=origin
+  fi
+
+  local url
+  if ! url=$(command git ${gitopts[@]+"${gitopts[@]}"} remote get-url "$remote" 2>/dev/null); then
+    # A URL given in place of a remote name.
+    case "$remote" in
+      *:*|*/*) url="$remote" ;;
+      *) return 0 ;;
+    esac
+  fi
+  [[ -z "$url" ]] && return 0
+
+  # Normalise https://host/owner/repo, ssh://git@host:22/owner/repo and
+  # git@host:owner/repo to host/owner/repo.
+  local rest="$url"
+  if [[ "$rest" == *://* ]]; then
+    rest="${rest#*://}"
+    rest="${rest#*@}"
+  else
+    rest="${rest#*@}"
+    rest="${rest/://}"
+  fi
+  local host="${rest%%/*}"
+  host="${host%%:*}"
+  local path="${rest#*/}"
+  local owner="${path%%/*}"
+  [[ -z "$owner" || "$owner" == "$rest" ]] && return 0
+
+  local user="$GH_AUTOPROFILE_USER"
+  local want_host owner_lc host_lc allowed
+  want_host=$(printf '%s' "${GH_AUTOPROFILE_HOST:-github.com}" | tr '[:upper:]' '[:lower:]')
+  owner_lc=$(printf '%s' "$owner" | tr '[:upper:]' '[:lower:]')
+  host_lc=$(printf '%s' "$host" | tr '[:upper:]' '[:lower:]')
+  allowed=$(printf '%s,%s' "$user" "${GH_AUTOPROFILE_ORGS:-}" | tr '[:upper:]' '[:lower:]')
+
+  if [[ "$host_lc" == "$want_host" && ",$allowed," == *",$owner_lc,"* ]]; then
+    return 0
+  fi
+
+  local msg="$remote is $host/$owner but the pinned account is '$user' on $want_host"
+  if [[ -n "${GH_AUTOPROFILE_ORGS:-}" ]]; then
+    msg="$msg (orgs: $GH_AUTOPROFILE_ORGS)"
+  fi
+  if [[ -n "${GH_AUTOPROFILE_STRICT:-}" ]]; then
+    echo "gh-autoprofile: refused 'git push': $msg" >&2
+    return 1
+  fi
+  echo "gh-autoprofile: warning: $msg" >&2
+  return 0
+}
+
+# _gh_autoprofile_guard <gh|git> [args...]
+# Returns non-zero when a push fails the owner check, or when the operation
+# targets a protected account and was not confirmed. Decisions are logged
+# to stderr.
+_gh_autoprofile_guard() {
+  local tool="$1"
+  shift
+  local op="" arg="" skip=""
+
+  if [[ "$tool" == "git" ]]; then
+    # Find the git subcommand, skipping global options that take a value.
+    for arg in "$@"; do
+      if [[ -n "$skip" ]]; then
+        skip=""
+        continue
+      fi
+      case "$arg" in
+        -C|-c|--git-dir|--work-tree|--namespace) skip=1 ;;
+        -*) ;;
+        *)
+          [[ "$arg" == "push" ]] && op="git push"
+          break
+          ;;
+      esac
+    done
+    if [[ -n "$op" ]]; then
+      for arg in "$@"; do
+        case "$arg" in
+          -f|--force|--force-with-lease|--force-with-lease=*|+*) op="git push --force" ;;
+        esac
+      done
+    fi
+  else
+    case "${1:-} ${2:-}" in
+      "repo delete"|"repo archive"|"pr merge"|"release delete") op="gh $1 $2" ;;
+    esac
+  fi
+
+  [[ -z "$op" ]] && return 0
+
+  if [[ "$tool" == "git" ]]; then
+    _gh_autoprofile_check_owner "$@" || return 1
+  fi
+
+  [[ -n "${GH_AUTOPROFILE_PROTECTED:-}" ]] || return 0
+
+  local user="$GH_AUTOPROFILE_USER"
+  if [[ "${GH_AUTOPROFILE_CONFIRM:-}" == "1" ]]; then
+    echo "gh-autoprofile: allowed '$op' as protected account '$user' (GH_AUTOPROFILE_CONFIRM=1)" >&2
+    return 0
+  fi
+
+  if [[ -t 0 && -t 2 ]]; then
+    local reply=""
+    printf "gh-autoprofile: '%s' is a protected account. Run '%s'? [y/N] " "$user" "$op" >&2
+    read -r reply
+    case "$reply" in
+      y|Y|yes|YES)
+        echo "gh-autoprofile: allowed '$op' as protected account '$user' (confirmed)" >&2
+        return 0
+        ;;
+    esac
+  fi
+
+  echo "gh-autoprofile: refused '$op' as protected account '$user' (set GH_AUTOPROFILE_CONFIRM=1 to override)" >&2
+  return 1
+}
 
 _gh_autoprofile_hook() {
   local current_user="${GH_AUTOPROFILE_USER:-}"
   local has_token="${GH_TOKEN:+1}"
+  local guard="${GH_AUTOPROFILE_PROTECTED:+1}${GH_AUTOPROFILE_ORGS:+1}${GH_AUTOPROFILE_STRICT:+1}"
 
   # Nothing changed — skip.
-  if [[ "$current_user" == "$_gh_autoprofile_last_user" && "$has_token" == "$_gh_autoprofile_last_has_token" ]]; then
+  if [[ "$current_user" == "$_gh_autoprofile_last_user" && "$has_token" == "$_gh_autoprofile_last_has_token" &&
+    "$guard" == "$_gh_autoprofile_last_guard" ]]; then
     return 0
   fi
 
@@ -34,6 +221,7 @@ _gh_autoprofile_hook() {
     # `command` bypasses the function and calls the real binary.
 
     gh() {
+      _gh_autoprofile_guard gh "$@" || return 1
       local _token
       _token=$(command gh auth token --user "$GH_AUTOPROFILE_USER" 2>/dev/null)
       if [[ -n "$_token" ]]; then
@@ -48,6 +236,7 @@ _gh_autoprofile_hook() {
     git() {
       # Only inject token for HTTPS credential operations; SSH uses
       # GIT_SSH_COMMAND which direnv already sets.
+      _gh_autoprofile_guard git "$@" || return 1
       local _token
       _token=$(command gh auth token --user "$GH_AUTOPROFILE_USER" 2>/dev/null)
       if [[ -n "$_token" ]]; then
@@ -58,15 +247,31 @@ _gh_autoprofile_hook() {
       fi
     }
 
+    export GH_AUTOPROFILE_WRAPPED=gh,git
     _gh_autoprofile_last_user="$current_user"
     _gh_autoprofile_last_has_token=""
 
   elif [[ -n "$current_user" && -n "${GH_TOKEN:-}" ]]; then
     # Export mode: GH_AUTOPROFILE_USER is set AND GH_TOKEN is present.
-    # Tokens are already in the environment — no wrapper functions needed.
-    # Remove any stale wrappers from a previous wrapper-mode directory.
-    unset -f gh 2>/dev/null
-    unset -f git 2>/dev/null
+    # Tokens are already in the environment — no token injection needed.
+    # Protected or owner-checked pins still get guard-only wrappers;
+    # otherwise remove any stale wrappers from a previous wrapper-mode
+    # directory.
+    if [[ -n "$guard" ]]; then
+      gh() {
+        _gh_autoprofile_guard gh "$@" || return 1
+        command gh "$@"
+      }
+      git() {
+        _gh_autoprofile_guard git "$@" || return 1
+        command git "$@"
+      }
+      export GH_AUTOPROFILE_WRAPPED=gh,git
+    else
+      unset -f gh 2>/dev/null
+      unset -f git 2>/dev/null
+      unset GH_AUTOPROFILE_WRAPPED
+    fi
     _gh_autoprofile_last_user="$current_user"
     _gh_autoprofile_last_has_token="1"
 
@@ -74,9 +279,28 @@ _gh_autoprofile_hook() {
     # User left a pinned directory — remove wrapper functions.
     unset -f gh 2>/dev/null
     unset -f git 2>/dev/null
+    unset GH_AUTOPROFILE_WRAPPED
     _gh_autoprofile_last_user=""
     _gh_autoprofile_last_has_token=""
   fi
+  _gh_autoprofile_last_guard="$guard"
+}
+
+# gh_autoprofile_prompt [format]
+# Prints a prompt segment for the active account, e.g. gh:bob-work(wrapper),
+# from the environment alone: no process is started. {user} and {mode}
+# in format are replaced. Returns 1 and prints nothing when no account is
+# active. `gh autoprofile prompt` also detects accounts that do not match
+# the directory's pin.
+gh_autoprofile_prompt() {
+  local user="${GH_AUTOPROFILE_USER:-}" mode="wrapper" out="$1"
+  [[ -n "$user" ]] || return 1
+  [[ -n "${GH_TOKEN:-}" ]] && mode="export"
+  [[ -n "$out" ]] || out='gh:{user}({mode})'
+  local user_ph='{user}' mode_ph='{mode}'
+  out="${out//"$user_ph"/$user}"
+  out="${out//"$mode_ph"/$mode}"
+  printf '%s' "$out"
 }
 
 # Install the hook into the shell's prompt cycle.
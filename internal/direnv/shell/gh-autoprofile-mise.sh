@@ -0,0 +1,16 @@
+#!/usr/bin/env bash
+# gh-autoprofile activation for mise
+# Installed to ~/.config/gh-autoprofile/mise.sh by `gh autoprofile setup`
+#
+# Reference it from a project's mise.toml:
+#
+#   [env]
+#   _.source = "~/.config/gh-autoprofile/mise.sh"
+#
+# mise sources it when it loads the project's environment. The pin covering
+# the directory is read from pins.yml, so mise.toml holds no account
+# details and can be committed. The exported variables are the ones the
+# direnv library sets; the shell hook creates the gh()/git() wrappers as
+# usual.
+
+eval "$(command gh autoprofile env --format sh --dir "$PWD")"
@@ -0,0 +1,94 @@
+
+# --- native backend -----------------------------------------------------------
+# Appended to the hook by `gh autoprofile setup --backend native`, which
+# activates pins without direnv: whenever the working directory changes,
+# the CLI prints the commands that apply the pin covering $PWD (nothing
+# when there is none). Every variable they set is recorded in
+# _GH_AUTOPROFILE_NATIVE_RESTORE first, so leaving the directory puts the
+# previous values back. The record is exported: a shell started inside a
+# pinned directory undoes the inherited pin before resolving its own.
+
+_gh_autoprofile_native_bin=@GH_AUTOPROFILE_BIN@
+_gh_autoprofile_native_dir=""
+_gh_autoprofile_native_out=""
+
+# _gh_autoprofile_native_set <name> <value>
+_gh_autoprofile_native_set() {
+  local name="$1" old
+  if eval "[[ -n \"\${$name+set}\" ]]"; then
+    eval "old=\"\$$name\""
+    _GH_AUTOPROFILE_NATIVE_RESTORE+="export $name=$(printf '%q' "$old");"
+  else
+    _GH_AUTOPROFILE_NATIVE_RESTORE+="unset $name;"
+  fi
+  export "$name=$2"
+}
+
+# _gh_autoprofile_native_account <user> <wrapper|export>
+# Fails fast when gh has no token for the account, like use_gh_autoprofile.
+# Export mode puts the token into the environment.
+_gh_autoprofile_native_account() {
+  local token
+  token=$(command gh auth token --user "$1" 2>/dev/null)
+  if [[ -z "$token" ]]; then
+    echo "gh-autoprofile: no token found for user '$1'. Run: gh auth login" >&2
+    return 1
+  fi
+  if [[ "$2" == "export" ]]; then
+    _gh_autoprofile_native_set GH_TOKEN "$token"
+    _gh_autoprofile_native_set GITHUB_TOKEN "$token"
+  fi
+}
+
+_gh_autoprofile_native_unload() {
+  eval "${_GH_AUTOPROFILE_NATIVE_RESTORE:-}"
+  unset _GH_AUTOPROFILE_NATIVE_RESTORE
+}
+
+_gh_autoprofile_native_apply() {
+  export _GH_AUTOPROFILE_NATIVE_RESTORE=""
+  eval "$1"
+}
+
+_gh_autoprofile_native() {
+  [[ "$PWD" == "$_gh_autoprofile_native_dir" ]] && return 0
+  _gh_autoprofile_native_dir="$PWD"
+
+  local out status
+  if [[ -n "$_gh_autoprofile_native_bin" && -x "$_gh_autoprofile_native_bin" ]]; then
+    out=$("$_gh_autoprofile_native_bin" resolve --native --dir "$PWD")
+  else
+    out=$(command gh autoprofile resolve --native --dir "$PWD")
+  fi
+  status=$?
+  # Still within the same pin: keep it.
+  if [[ $status -eq 0 && -n "$out" && "$out" == "$_gh_autoprofile_native_out" ]]; then
+    return 0
+  fi
+
+  _gh_autoprofile_native_unload
+  _gh_autoprofile_native_out=""
+  [[ $status -eq 0 && -n "$out" ]] || return 0
+  if _gh_autoprofile_native_apply "$out"; then
+    _gh_autoprofile_native_out="$out"
+  else
+    _gh_autoprofile_native_unload
+  fi
+}
+
+# gh_autoprofile_reload re-resolves the current directory, e.g. after
+# `gh autoprofile edit` changed its pin.
+gh_autoprofile_reload() {
+  _gh_autoprofile_native_dir=""
+  _gh_autoprofile_native_out=""
+  _gh_autoprofile_native
+}
+
+# Resolve before the wrapper hook runs, so it sees the new account at the
+# same prompt.
+if [[ -n "$ZSH_VERSION" ]]; then
+  add-zsh-hook chpwd _gh_autoprofile_native
+  _gh_autoprofile_native
+elif [[ -n "$BASH_VERSION" ]]; then
+  PROMPT_COMMAND="_gh_autoprofile_native;${PROMPT_COMMAND}"
+fi
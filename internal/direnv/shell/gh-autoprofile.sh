@@ -12,10 +12,34 @@
 # Export mode (opt-in per pin with --export-token):
 #   use_gh_autoprofile_export <user> [git-email] [git-name] [ssh-key-path]
 #   Exports GH_TOKEN and GITHUB_TOKEN directly into the shell environment.
+#
+# Indirect pins (opt-in per pin with --indirect):
+#   use gh_autoprofile
+#   No arguments: the pin for the directory is resolved from pins.yml with
+#   `gh autoprofile resolve`, so the .envrc holds no account details.
+#
+# Protected accounts (opt-in per pin with --protected):
+#   gh_autoprofile_protect
+#   Exports GH_AUTOPROFILE_PROTECTED so the shell hook asks for confirmation
+#   before pushes and destructive gh operations.
+#
+# Remote owner checks (opt-in per pin with --org / --strict):
+#   gh_autoprofile_owners [--strict] [--host <host>] [org...]
+#   Exports GH_AUTOPROFILE_ORGS, GH_AUTOPROFILE_HOST and GH_AUTOPROFILE_STRICT
+#   so the shell hook checks the origin remote's owner before pushing.
+#
+# Repository policy (.gh-autoprofile.yml committed to the repo):
+#   Both use_ functions look for the file in the directory and its parents
+#   and refuse to activate a pin that violates it.
 
 # --- wrapper mode (default) ---------------------------------------------------
 
 use_gh_autoprofile() {
+  if [[ $# -eq 0 ]]; then
+    _gh_autoprofile_resolve
+    return
+  fi
+
   local user="$1"
   local git_email="${2:-}"
   local git_name="${3:-}"
@@ -40,6 +64,8 @@ use_gh_autoprofile() {
     return 1
   fi
 
+  _gh_autoprofile_policy || return 1
+
   # Export only the non-sensitive marker. The shell hook reads this to
   # create per-invocation wrapper functions.
   export GH_AUTOPROFILE_USER="$user"
@@ -74,6 +100,8 @@ use_gh_autoprofile_export() {
     return 1
   fi
 
+  _gh_autoprofile_policy || return 1
+
   # Export tokens into environment — third-party tools can read them.
   export GH_TOKEN="$token"
   export GITHUB_TOKEN="$token"
@@ -87,8 +115,77 @@ use_gh_autoprofile_export() {
   log_status "gh-autoprofile" "activated '$user' (export mode)"
 }
 
+# --- guardrails ---------------------------------------------------------------
+
+gh_autoprofile_protect() {
+  if [[ -z "${GH_AUTOPROFILE_USER:-}" ]]; then
+    log_error "gh-autoprofile: gh_autoprofile_protect must follow use_gh_autoprofile"
+    return 1
+  fi
+
+  export GH_AUTOPROFILE_PROTECTED=1
+
+  log_status "gh-autoprofile" "'$GH_AUTOPROFILE_USER' is protected (push/merge/delete require confirmation)"
+}
+
+gh_autoprofile_owners() {
+  local strict="" host="" orgs=""
+
+  while [[ $# -gt 0 ]]; do
+    case "$1" in
+      --strict) strict=1 ;;
+      --host)
+        host="${2:-}"
+        shift
+        ;;
+      *) orgs="${orgs:+$orgs,}$1" ;;
+    esac
+    shift
+  done
+
+  export GH_AUTOPROFILE_ORGS="$orgs"
+  if [[ -n "$host" ]]; then
+    export GH_AUTOPROFILE_HOST="$host"
+  fi
+  if [[ -n "$strict" ]]; then
+    export GH_AUTOPROFILE_STRICT=1
+  fi
+}
+
 # --- shared helpers -----------------------------------------------------------
 
+_gh_autoprofile_resolve() {
+  if ! command -v gh &>/dev/null; then
+    log_error "gh-autoprofile: gh CLI not found. Install from https://cli.github.com"
+    return 1
+  fi
+
+  # The CLI prints the commands an inline block would hold (plus a
+  # watch_file on pins.yml), with every value shell-quoted.
+  local out
+  if ! out=$(command gh autoprofile resolve --dir "$PWD"); then
+    log_error "gh-autoprofile: cannot resolve the pin for $PWD"
+    return 1
+  fi
+  eval "$out"
+}
+
+_gh_autoprofile_policy() {
+  local policy
+  policy=$(find_up .gh-autoprofile.yml 2>/dev/null) || return 0
+  [[ -n "$policy" ]] || return 0
+  watch_file "$policy"
+
+  # The pin registry is the source of truth; the CLI resolves the pin for
+  # this directory and checks it against the policy.
+  local out
+  if ! out=$(command gh autoprofile policy check --dir "$PWD" 2>&1); then
+    log_error "gh-autoprofile: pin refused by $policy"
+    log_error "$out"
+    return 1
+  fi
+}
+
 _gh_autoprofile_identity() {
   local git_email="$1"
   local git_name="$2"
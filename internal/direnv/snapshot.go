@@ -0,0 +1,92 @@
+package direnv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+)
+
+// Snapshot remembers the .envrc files of a set of directories as they were
+// before a multi-directory change, so the change can be rolled back.
+type Snapshot struct {
+	files map[string]envrcState
+	order []string
+}
+
+type envrcState struct {
+	exists bool
+	data   []byte
+	mode   os.FileMode
+}
+
+// Capture records the current .envrc in dir. Capturing the same directory
+// twice keeps the first state.
+func (s *Snapshot) Capture(dir string) error {
+	return s.CaptureFile(filepath.Join(dir, ".envrc"))
+}
+
+// CapturePin records the files gh-autoprofile manages for pin.
+func (s *Snapshot) CapturePin(pin config.Pin) error {
+	for _, path := range pin.ManagedFiles() {
+		if err := s.CaptureFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CaptureFile records any other file the change touches.
+func (s *Snapshot) CaptureFile(path string) error {
+	return s.CaptureAs(path, path)
+}
+
+// CaptureAs records path as it is now as the state of as, for files that
+// are about to be moved to as.
+func (s *Snapshot) CaptureAs(path, as string) error {
+	if _, ok := s.files[as]; ok {
+		return nil
+	}
+	if s.files == nil {
+		s.files = map[string]envrcState{}
+	}
+
+	state := envrcState{}
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot snapshot %s: %w", path, err)
+		}
+		state = envrcState{exists: true, data: data, mode: fi.Mode().Perm()}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("cannot snapshot %s: %w", path, err)
+	}
+	s.files[as] = state
+	s.order = append(s.order, as)
+	return nil
+}
+
+// Restore puts every captured .envrc back as it was, deleting files that
+// did not exist. It attempts all files and returns the combined errors.
+func (s *Snapshot) Restore() error {
+	var errs []error
+	for i := len(s.order) - 1; i >= 0; i-- {
+		path := s.order[i]
+		state := s.files[path]
+		if !state.exists {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := fsutil.WriteFileAtomic(path, state.data, state.mode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
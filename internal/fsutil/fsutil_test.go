@@ -0,0 +1,125 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pins.yml")
+
+	if err := WriteFileAtomic(path, []byte("one\n"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte("two\n"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "two\n" {
+		t.Errorf("content = %q, %v", data, err)
+	}
+	if fi, _ := os.Stat(path); runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", fi.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestWriteFileAtomic_FollowsSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles-envrc")
+	link := filepath.Join(dir, ".envrc")
+	if err := os.WriteFile(target, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("cannot write target: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("cannot create symlink: %v", err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("new\n"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced: %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new\n" {
+		t.Errorf("target content = %q", data)
+	}
+}
+
+func TestLockFile_SerialisesReadModifyWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("advisory locks are not implemented on Windows")
+	}
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "counter.lock")
+	counter := filepath.Join(dir, "counter")
+	if err := os.WriteFile(counter, []byte("0"), 0600); err != nil {
+		t.Fatalf("cannot write counter: %v", err)
+	}
+
+	const workers, rounds = 6, 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				lock, err := LockFile(lockPath)
+				if err != nil {
+					errs <- err
+					return
+				}
+				data, _ := os.ReadFile(counter)
+				n, _ := strconv.Atoi(string(data))
+				err = WriteFileAtomic(counter, []byte(strconv.Itoa(n+1)), 0600)
+				lock.Unlock()
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(counter)
+	if string(data) != strconv.Itoa(workers*rounds) {
+		t.Errorf("counter = %s, want %d (lost updates)", data, workers*rounds)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	tests := map[string]string{
+		"~":               home,
+		"~/work":          filepath.Join(home, "work"),
+		"$HOME/.ssh/id":   filepath.Join(home, ".ssh", "id"),
+		"${HOME}/oss":     filepath.Join(home, "oss"),
+		"~bob/work":       "~bob/work",
+		"/srv/~/x":        "/srv/~/x",
+		"relative/~/path": "relative/~/path",
+	}
+	for in, want := range tests {
+		if got := ExpandHome(in); got != want {
+			t.Errorf("ExpandHome(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandHome replaces a leading ~, $HOME or ${HOME} with the user's home
+// directory, for paths that did not pass through a shell. Other paths, and
+// all paths when the home directory is unknown, are returned unchanged.
+func ExpandHome(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	for _, prefix := range []string{"~", "$HOME", "${HOME}"} {
+		if path == prefix {
+			return home
+		}
+		if strings.HasPrefix(path, prefix+"/") {
+			return filepath.Join(home, path[len(prefix)+1:])
+		}
+	}
+	return path
+}
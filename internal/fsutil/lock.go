@@ -0,0 +1,39 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+)
+
+// Lock is an exclusive advisory lock held on a lock file.
+type Lock struct {
+	f *os.File
+}
+
+// LockFile blocks until it holds an exclusive advisory lock on path,
+// creating the file if needed. The lock only excludes other LockFile
+// callers; it does not stop plain reads and writes.
+func LockFile(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open lock file %s: %w", path, err)
+	}
+	if err := lockFD(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot lock %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlockFD(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
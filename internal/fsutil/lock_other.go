@@ -0,0 +1,12 @@
+//go:build !unix
+
+package fsutil
+
+import "os"
+
+// Advisory locking is only implemented on Unix. Elsewhere writes are still
+// atomic, but concurrent read-modify-write cycles are not serialised.
+
+func lockFD(f *os.File) error { return nil }
+
+func unlockFD(f *os.File) error { return nil }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package fsutil
+
+import "os"
+
+// copyOwner is a no-op where files have no Unix owner and group.
+func copyOwner(f *os.File, fi os.FileInfo) {}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+// copyOwner gives f the owner and group of fi. It is best effort: only
+// root may give a file away, but any user may change the group to one of
+// their own groups.
+func copyOwner(f *os.File, fi os.FileInfo) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	uid, gid := int(st.Uid), int(st.Gid)
+	if uid == os.Geteuid() {
+		uid = -1
+	}
+	if gid == os.Getegid() {
+		gid = -1
+	}
+	if uid == -1 && gid == -1 {
+		return
+	}
+	if err := f.Chown(uid, gid); err != nil && uid != -1 {
+		_ = f.Chown(-1, gid)
+	}
+}
@@ -0,0 +1,217 @@
+package ghauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIBase returns the REST API root for a GitHub host: api.github.com for
+// github.com and /api/v3 on GitHub Enterprise Server.
+func APIBase(host string) string {
+	if host == "" || host == "github.com" {
+		return "https://api.github.com"
+	}
+	return "https://" + host + "/api/v3"
+}
+
+// TokenHealth is what the API reveals about a token in the headers of a
+// GET /user response.
+type TokenHealth struct {
+	// Login is the account the token authenticates as.
+	Login string
+	// Scopes are the OAuth scopes granted (X-OAuth-Scopes). They are nil
+	// when ScopesKnown is false, as for fine-grained and app tokens.
+	Scopes      []string
+	ScopesKnown bool
+	// Expires is the token's expiry; zero when it does not expire.
+	Expires time.Time
+	// SSO is the X-GitHub-SSO header, set when a SAML organisation has
+	// not authorised the token.
+	SSO string
+	// Rate limit of the token (X-RateLimit-*); Limit is 0 when unknown.
+	RateLimit, RateRemaining int
+	RateReset                time.Time
+}
+
+// OrgAccess is what the API reveals about a token's access to an
+// organisation.
+type OrgAccess struct {
+	Org string
+	// Status is the HTTP status of GET /orgs/{org}.
+	Status int
+	// SSO is the X-GitHub-SSO header; "required; url=..." means the
+	// token must be authorised for the organisation's SAML SSO.
+	SSO string
+}
+
+// SSORequired reports whether the organisation refuses the token until it
+// is authorised for SAML SSO.
+func (a *OrgAccess) SSORequired() bool {
+	return strings.HasPrefix(a.SSO, "required")
+}
+
+// SSOURL returns the authorisation URL from the SSO header, if any.
+func (a *OrgAccess) SSOURL() string {
+	return ssoURL(a.SSO)
+}
+
+// Checker queries the GitHub REST API with a single token.
+type Checker struct {
+	// Base is the API root, e.g. https://api.github.com.
+	Base   string
+	Token  string
+	Client *http.Client
+}
+
+// CheckToken calls GET /user and reads the token's scopes, expiry, SSO
+// state and rate limit from the response headers.
+func (c *Checker) CheckToken() (*TokenHealth, error) {
+	resp, body, err := c.get("/user")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /user: %s%s", resp.Status, apiMessage(body))
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, fmt.Errorf("cannot parse /user response: %w", err)
+	}
+
+	h := &TokenHealth{Login: user.Login, SSO: resp.Header.Get("X-GitHub-SSO")}
+	if values, ok := resp.Header[http.CanonicalHeaderKey("X-OAuth-Scopes")]; ok {
+		h.ScopesKnown = true
+		h.Scopes = splitScopes(strings.Join(values, ","))
+	}
+	if v := resp.Header.Get("GitHub-Authentication-Token-Expiration"); v != "" {
+		if t, err := parseExpiration(v); err == nil {
+			h.Expires = t
+		}
+	}
+	h.RateLimit, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	h.RateRemaining, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		h.RateReset = time.Unix(reset, 0)
+	}
+	return h, nil
+}
+
+// CheckOrg calls GET /orgs/{org} to see whether the organisation accepts
+// the token.
+func (c *Checker) CheckOrg(org string) (*OrgAccess, error) {
+	resp, _, err := c.get("/orgs/" + url.PathEscape(org))
+	if err != nil {
+		return nil, err
+	}
+	return &OrgAccess{Org: org, Status: resp.StatusCode, SSO: resp.Header.Get("X-GitHub-SSO")}, nil
+}
+
+func (c *Checker) get(path string) (*http.Response, []byte, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.Base, "/")+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Authorization", "token "+c.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, fmt.Errorf("GET %s: %w", path, err)
+	}
+	return resp, body, nil
+}
+
+// MissingScopes returns the scopes in required that granted does not
+// cover, taking implied scopes into account (repo covers public_repo,
+// admin:org covers read:org, ...).
+func MissingScopes(granted, required []string) []string {
+	have := map[string]bool{}
+	for _, s := range granted {
+		have[s] = true
+		for _, implied := range impliedScopes[s] {
+			have[implied] = true
+		}
+	}
+	var missing []string
+	for _, s := range required {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// impliedScopes lists the scopes each OAuth scope grants as well.
+var impliedScopes = map[string][]string{
+	"repo":             {"repo:status", "repo_deployment", "public_repo", "repo:invite", "security_events"},
+	"admin:org":        {"write:org", "read:org", "manage_runners:org"},
+	"write:org":        {"read:org"},
+	"admin:public_key": {"write:public_key", "read:public_key"},
+	"write:public_key": {"read:public_key"},
+	"admin:repo_hook":  {"write:repo_hook", "read:repo_hook"},
+	"write:repo_hook":  {"read:repo_hook"},
+	"admin:gpg_key":    {"write:gpg_key", "read:gpg_key"},
+	"write:gpg_key":    {"read:gpg_key"},
+	"user":             {"read:user", "user:email", "user:follow"},
+	"write:packages":   {"read:packages"},
+	"project":          {"read:project"},
+}
+
+func splitScopes(header string) []string {
+	var scopes []string
+	for _, s := range strings.Split(header, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// parseExpiration parses the token expiry header, e.g.
+// "2026-11-30 12:00:00 UTC" or "2026-11-30 12:00:00 +0000".
+func parseExpiration(v string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse token expiry %q", v)
+}
+
+// ssoURL extracts the url= parameter of an X-GitHub-SSO header.
+func ssoURL(header string) string {
+	for _, part := range strings.Split(header, ";") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(part), "url="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// apiMessage returns the "message" of a GitHub API error body, formatted
+// for appending to an error.
+func apiMessage(body []byte) string {
+	var e struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &e) != nil || e.Message == "" {
+		return ""
+	}
+	return " (" + e.Message + ")"
+}
@@ -0,0 +1,152 @@
+package ghauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAPI stands in for the GitHub REST API. /user answers for the token
+// "good"; /orgs/acme requires SSO and /orgs/open accepts every token.
+func fakeAPI(t *testing.T, headers map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/user":
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+			_, _ = w.Write([]byte(`{"login":"bob-work"}`))
+		case "/orgs/acme":
+			w.Header().Set("X-GitHub-SSO", "required; url=https://github.com/orgs/acme/sso?authorization_request=abc")
+			w.WriteHeader(http.StatusForbidden)
+		case "/orgs/open":
+			_, _ = w.Write([]byte(`{"login":"open"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckToken(t *testing.T) {
+	srv := fakeAPI(t, map[string]string{
+		"X-OAuth-Scopes":                         "gist, read:org, repo",
+		"GitHub-Authentication-Token-Expiration": "2026-11-30 12:00:00 UTC",
+		"X-RateLimit-Limit":                      "5000",
+		"X-RateLimit-Remaining":                  "4990",
+		"X-RateLimit-Reset":                      "1790000000",
+	})
+
+	h, err := (&Checker{Base: srv.URL, Token: "good"}).CheckToken()
+	if err != nil {
+		t.Fatalf("CheckToken: %v", err)
+	}
+	if h.Login != "bob-work" {
+		t.Errorf("expected login bob-work, got %q", h.Login)
+	}
+	if !h.ScopesKnown || !reflect.DeepEqual(h.Scopes, []string{"gist", "read:org", "repo"}) {
+		t.Errorf("unexpected scopes %v (known %v)", h.Scopes, h.ScopesKnown)
+	}
+	if want := time.Date(2026, 11, 30, 12, 0, 0, 0, time.UTC); !h.Expires.Equal(want) {
+		t.Errorf("expected expiry %v, got %v", want, h.Expires)
+	}
+	if h.RateLimit != 5000 || h.RateRemaining != 4990 || h.RateReset.Unix() != 1790000000 {
+		t.Errorf("unexpected rate limit %d/%d reset %v", h.RateRemaining, h.RateLimit, h.RateReset)
+	}
+}
+
+func TestCheckToken_FineGrained(t *testing.T) {
+	srv := fakeAPI(t, nil)
+	h, err := (&Checker{Base: srv.URL + "/", Token: "good"}).CheckToken()
+	if err != nil {
+		t.Fatalf("CheckToken: %v", err)
+	}
+	if h.ScopesKnown || h.Scopes != nil {
+		t.Errorf("expected unknown scopes without X-OAuth-Scopes, got %v", h.Scopes)
+	}
+	if !h.Expires.IsZero() || h.RateLimit != 0 {
+		t.Errorf("expected no expiry and no rate limit, got %v, %d", h.Expires, h.RateLimit)
+	}
+}
+
+func TestCheckToken_EmptyScopes(t *testing.T) {
+	srv := fakeAPI(t, map[string]string{"X-OAuth-Scopes": ""})
+	h, err := (&Checker{Base: srv.URL, Token: "good"}).CheckToken()
+	if err != nil {
+		t.Fatalf("CheckToken: %v", err)
+	}
+	if !h.ScopesKnown || len(h.Scopes) != 0 {
+		t.Errorf("expected a known, empty scope list, got %v (known %v)", h.Scopes, h.ScopesKnown)
+	}
+}
+
+func TestCheckToken_Rejected(t *testing.T) {
+	srv := fakeAPI(t, nil)
+	_, err := (&Checker{Base: srv.URL, Token: "revoked"}).CheckToken()
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Fatalf("expected a 401 error with the API message, got %v", err)
+	}
+}
+
+func TestCheckOrg(t *testing.T) {
+	srv := fakeAPI(t, nil)
+	c := &Checker{Base: srv.URL, Token: "good"}
+
+	acme, err := c.CheckOrg("acme")
+	if err != nil {
+		t.Fatalf("CheckOrg: %v", err)
+	}
+	if !acme.SSORequired() || acme.Status != http.StatusForbidden {
+		t.Errorf("expected acme to require SSO, got %+v", acme)
+	}
+	if want := "https://github.com/orgs/acme/sso?authorization_request=abc"; acme.SSOURL() != want {
+		t.Errorf("expected SSO URL %q, got %q", want, acme.SSOURL())
+	}
+
+	open, err := c.CheckOrg("open")
+	if err != nil {
+		t.Fatalf("CheckOrg: %v", err)
+	}
+	if open.SSORequired() || open.Status != http.StatusOK {
+		t.Errorf("expected open to accept the token, got %+v", open)
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	tests := []struct {
+		granted, required, want []string
+	}{
+		{[]string{"repo", "read:org"}, []string{"repo", "read:org"}, nil},
+		{[]string{"repo"}, []string{"repo", "read:org"}, []string{"read:org"}},
+		{[]string{"repo", "admin:org"}, []string{"public_repo", "read:org"}, nil},
+		{[]string{"public_repo"}, []string{"repo"}, []string{"repo"}},
+		{nil, []string{"repo", "workflow"}, []string{"repo", "workflow"}},
+	}
+	for _, tc := range tests {
+		if got := MissingScopes(tc.granted, tc.required); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("MissingScopes(%v, %v): expected %v, got %v", tc.granted, tc.required, tc.want, got)
+		}
+	}
+}
+
+func TestAPIBase(t *testing.T) {
+	if got := APIBase(""); got != "https://api.github.com" {
+		t.Errorf("expected api.github.com for the default host, got %q", got)
+	}
+	if got := APIBase("github.com"); got != "https://api.github.com" {
+		t.Errorf("expected api.github.com, got %q", got)
+	}
+	if got := APIBase("ghe.example.com"); got != "https://ghe.example.com/api/v3" {
+		t.Errorf("expected the GHES API root, got %q", got)
+	}
+}
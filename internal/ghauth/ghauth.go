@@ -1,8 +1,11 @@
 package ghauth
 
 import (
+	"encoding/json"
 	"fmt"
 	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -17,8 +20,17 @@ type UserInfo struct {
 // GetToken retrieves the OAuth token for a specific gh user from the keyring
 // without changing the active account.
 func GetToken(user string) (string, error) {
-	cmd := exec.Command("gh", "auth", "token", "--user", user)
-	out, err := cmd.Output()
+	return GetTokenForHost(user, "")
+}
+
+// GetTokenForHost is GetToken for an account on host; an empty host leaves
+// the choice to gh.
+func GetTokenForHost(user, host string) (string, error) {
+	args := []string{"auth", "token", "--user", user}
+	if host != "" {
+		args = append(args, "--hostname", host)
+	}
+	out, err := exec.Command("gh", args...).Output()
 	if err != nil {
 		return "", fmt.Errorf("cannot get token for user '%s': %w (is the user logged in via 'gh auth login'?)", user, err)
 	}
@@ -37,8 +49,44 @@ func ValidateUser(user string) error {
 	return nil
 }
 
-// ListUsers parses `gh auth status` output to list all logged-in accounts.
+// jsonStatusVersion is the first gh release whose `gh auth status` accepts
+// --json. Older releases are not asked, saving a failing call; should a
+// newer one still reject the flag, ListUsers falls back all the same.
+const jsonStatusVersion = "2.72.0"
+
+// ListUsers lists all logged-in accounts. It asks `gh auth status --json`
+// where gh supports it, then reads gh's hosts.yml, and only as a last
+// resort scrapes the human-readable `gh auth status` output. A JSON answer
+// with no usable account — every token timed out, say — falls through to
+// hosts.yml, which lists the accounts without validating them.
 func ListUsers() ([]UserInfo, error) {
+	if version, err := GetGHVersion(); err != nil || versionAtLeast(version, jsonStatusVersion) {
+		if users, err := listUsersJSON(); err == nil && len(users) > 0 {
+			return users, nil
+		}
+	}
+	if users, err := ReadHosts(); err == nil && len(users) > 0 {
+		return users, nil
+	}
+	return listUsersText()
+}
+
+// listUsersJSON runs `gh auth status --json hosts`. gh exits non-zero when
+// an account fails validation but still prints the JSON document.
+func listUsersJSON() ([]UserInfo, error) {
+	out, err := exec.Command("gh", "auth", "status", "--json", "hosts").Output()
+	users, parseErr := parseAuthStatusJSON(out)
+	if parseErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("cannot get auth status: %w", err)
+		}
+		return nil, parseErr
+	}
+	return users, nil
+}
+
+// listUsersText parses the human-readable `gh auth status` output.
+func listUsersText() ([]UserInfo, error) {
 	cmd := exec.Command("gh", "auth", "status")
 	// gh auth status exits non-zero when there are inactive accounts,
 	// but still prints all info — so we always parse the output.
@@ -50,6 +98,95 @@ func ListUsers() ([]UserInfo, error) {
 	return parseAuthStatus(output), nil
 }
 
+// authStatusJSON is the document printed by `gh auth status --json hosts`.
+type authStatusJSON struct {
+	Hosts map[string][]struct {
+		State       string `json:"state"`
+		Active      bool   `json:"active"`
+		Host        string `json:"host"`
+		Login       string `json:"login"`
+		GitProtocol string `json:"gitProtocol"`
+	} `json:"hosts"`
+}
+
+// parseAuthStatusJSON extracts user info from `gh auth status --json
+// hosts`. Hosts are sorted by name; accounts keep gh's order. Accounts
+// whose token failed validation or timed out are left out, as the text
+// output reports them as "Failed to log in" rather than "Logged in".
+func parseAuthStatusJSON(data []byte) ([]UserInfo, error) {
+	var doc authStatusJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse auth status: %w", err)
+	}
+	if doc.Hosts == nil {
+		return nil, fmt.Errorf("cannot parse auth status: no hosts field")
+	}
+	hosts := make([]string, 0, len(doc.Hosts))
+	for host := range doc.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var users []UserInfo
+	for _, host := range hosts {
+		for _, entry := range doc.Hosts[host] {
+			if entry.Login == "" || entry.State != "success" {
+				continue
+			}
+			if entry.Host == "" {
+				entry.Host = host
+			}
+			protocol := entry.GitProtocol
+			if protocol == "" {
+				protocol = "https"
+			}
+			users = append(users, UserInfo{
+				User:     entry.Login,
+				Host:     entry.Host,
+				Active:   entry.Active,
+				Protocol: protocol,
+			})
+		}
+	}
+	return users, nil
+}
+
+// versionAtLeast reports whether the dotted version v is at least min.
+// Versions that do not parse are assumed to be recent.
+func versionAtLeast(v, min string) bool {
+	have, ok := parseVersion(v)
+	if !ok {
+		return true
+	}
+	want, _ := parseVersion(min)
+	for i := range want {
+		if have[i] != want[i] {
+			return have[i] > want[i]
+		}
+	}
+	return true
+}
+
+func parseVersion(v string) ([3]int, bool) {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) < 2 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
 // GetGHVersion returns the gh CLI version string (e.g., "2.86.0").
 func GetGHVersion() (string, error) {
 	cmd := exec.Command("gh", "--version")
@@ -69,66 +206,56 @@ func GetGHVersion() (string, error) {
 	return lines[0], nil
 }
 
-// parseAuthStatus extracts user info from `gh auth status` output.
+// parseAuthStatus extracts user info from `gh auth status` output. It
+// reads both the multi-account layout of gh 2.40 and later ("Logged in to
+// github.com account alice (keyring)" followed by "- Active account:")
+// and the earlier one ("Logged in to github.com as alice (...)"), which
+// had a single, implicitly active, account per host.
 func parseAuthStatus(output string) []UserInfo {
 	var users []UserInfo
-	var currentHost string
 	lines := strings.Split(output, "\n")
 
 	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		// Host line: non-indented, contains a dot, no spaces (e.g., "github.com")
-		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") &&
-			strings.Contains(trimmed, ".") && !strings.Contains(trimmed, " ") && trimmed != "" {
-			currentHost = trimmed
+		_, rest, ok := strings.Cut(line, "Logged in to ")
+		if !ok {
+			continue
+		}
+		// host, "account" or "as", user, then an optional "(source)"
+		fields := strings.Fields(rest)
+		if len(fields) < 3 || (fields[1] != "account" && fields[1] != "as") {
 			continue
 		}
+		host, user := fields[0], fields[2]
+		legacy := fields[1] == "as"
 
-		// Account line: "Logged in to github.com account <user> (keyring)"
-		if strings.Contains(trimmed, "Logged in to") && strings.Contains(trimmed, "account") {
-			parts := strings.SplitN(trimmed, "account ", 2)
-			if len(parts) < 2 {
-				continue
+		// Look ahead for Active and Protocol lines
+		active := legacy
+		protocol := "https"
+		for j := i + 1; j < len(lines) && j <= i+4; j++ {
+			nextLine := strings.TrimSpace(lines[j])
+			// Stop look-ahead at next account or host
+			if strings.Contains(nextLine, "Logged in to") {
+				break
 			}
-			rest := parts[1]
-			// Username ends at " (" or end of string
-			userEnd := strings.Index(rest, " (")
-			if userEnd == -1 {
-				userEnd = len(rest)
+			if value, ok := strings.CutPrefix(strings.TrimLeft(nextLine, "-✓ "), "Active account:"); ok {
+				active = strings.TrimSpace(value) == "true"
 			}
-			user := rest[:userEnd]
-
-			// Look ahead for Active and Protocol lines
-			active := false
-			protocol := "https"
-			for j := i + 1; j < len(lines) && j <= i+4; j++ {
-				nextLine := strings.TrimSpace(lines[j])
-				if strings.Contains(nextLine, "Active account: true") {
-					active = true
-				}
-				if strings.Contains(nextLine, "Active account: false") {
-					// explicitly false
-				}
-				if strings.Contains(nextLine, "Git operations protocol:") {
-					colonParts := strings.SplitN(nextLine, ":", 2)
-					if len(colonParts) == 2 {
-						protocol = strings.TrimSpace(colonParts[1])
-					}
-				}
-				// Stop look-ahead at next account or host
-				if strings.Contains(nextLine, "Logged in to") {
-					break
+			if _, value, ok := strings.Cut(nextLine, "Git operations protocol:"); ok {
+				protocol = strings.TrimSpace(value)
+			}
+			if _, value, ok := strings.Cut(nextLine, "configured to use "); ok {
+				if words := strings.Fields(value); len(words) > 0 {
+					protocol = words[0]
 				}
 			}
-
-			users = append(users, UserInfo{
-				User:     user,
-				Host:     currentHost,
-				Active:   active,
-				Protocol: protocol,
-			})
 		}
+
+		users = append(users, UserInfo{
+			User:     user,
+			Host:     host,
+			Active:   active,
+			Protocol: protocol,
+		})
 	}
 	return users
 }
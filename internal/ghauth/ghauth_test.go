@@ -1,6 +1,9 @@
 package ghauth
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -85,3 +88,155 @@ func TestParseAuthStatus_SingleUser(t *testing.T) {
 		t.Errorf("expected protocol 'ssh', got '%s'", users[0].Protocol)
 	}
 }
+
+func TestParseProfile(t *testing.T) {
+	p, err := parseProfile([]byte(`{"login":"bob-work","id":42,"name":"Bob Smith","email":null}`))
+	if err != nil {
+		t.Fatalf("parseProfile failed: %v", err)
+	}
+	if p.Login != "bob-work" || p.Name != "Bob Smith" || p.Email != "" {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+
+	if _, err := parseProfile([]byte("not json")); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+// TestParseFixtures checks every parser against the output formats of
+// several gh releases. The fixtures are hand-written from those formats,
+// with made-up accounts and hosts, not captured from real installations.
+func TestParseFixtures(t *testing.T) {
+	bob := UserInfo{User: "bob-work", Host: "github.com", Active: true, Protocol: "ssh"}
+	alice := UserInfo{User: "alice", Host: "github.com", Active: false, Protocol: "ssh"}
+	aliceOnly := UserInfo{User: "alice", Host: "github.com", Active: true, Protocol: "ssh"}
+	carol := UserInfo{User: "carol", Host: "ghe.example.com", Active: true, Protocol: "https"}
+	carolInactive := UserInfo{User: "carol", Host: "ghe.example.com", Active: false, Protocol: "https"}
+
+	tests := []struct {
+		file  string
+		parse func([]byte) ([]UserInfo, error)
+		want  []UserInfo
+	}{
+		{"auth-status-2.20.txt", parseText, []UserInfo{aliceOnly, carol}},
+		{"auth-status-2.40.txt", parseText, []UserInfo{bob, alice, carolInactive}},
+		{"auth-status-2.72.json", parseAuthStatusJSON, []UserInfo{bob, alice}},
+		{"auth-status-2.72-timeout.json", parseAuthStatusJSON, nil},
+		{"hosts-2.20.yml", parseHosts, []UserInfo{aliceOnly, carol}},
+		{"hosts-2.40.yml", parseHosts, []UserInfo{bob, alice, carol}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			users, err := tc.parse(data)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(users, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, users)
+			}
+		})
+	}
+}
+
+func parseText(data []byte) ([]UserInfo, error) {
+	return parseAuthStatus(string(data)), nil
+}
+
+func TestListUsers_AllTimedOutFallsBackToHosts(t *testing.T) {
+	status, err := filepath.Abs(filepath.Join("testdata", "auth-status-2.72-timeout.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	// gh exits non-zero when accounts fail validation, JSON and all.
+	fakeGh := "#!/bin/sh\n" +
+		"case \"$1 $2\" in\n" +
+		"\"--version \") echo \"gh version 2.72.0 (2025-04-30)\";;\n" +
+		"\"auth status\") cat '" + status + "'; exit 1;;\n" +
+		"esac\n"
+	if err := os.WriteFile(filepath.Join(bin, "gh"), []byte(fakeGh), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	config := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", config)
+	hosts, err := os.ReadFile(filepath.Join("testdata", "hosts-2.40.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config, "hosts.yml"), hosts, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	want := []UserInfo{
+		{User: "bob-work", Host: "github.com", Active: true, Protocol: "ssh"},
+		{User: "alice", Host: "github.com", Active: false, Protocol: "ssh"},
+		{User: "carol", Host: "ghe.example.com", Active: true, Protocol: "https"},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("expected the hosts.yml accounts %+v, got %+v", want, users)
+	}
+}
+
+func TestParseAuthStatusJSON_Invalid(t *testing.T) {
+	for _, input := range []string{"", "unknown flag: --json", `{"other": 1}`} {
+		if _, err := parseAuthStatusJSON([]byte(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"2.72.0", true},
+		{"2.72.1", true},
+		{"2.100.0", true},
+		{"3.0", true},
+		{"v2.80.0", true},
+		{"2.71.9", false},
+		{"2.9.0", false},
+		{"1.99.99", false},
+		{"2.40.0-rc1", false},
+		{"gh version unknown", true},
+	}
+	for _, tc := range tests {
+		if got := versionAtLeast(tc.version, jsonStatusVersion); got != tc.want {
+			t.Errorf("versionAtLeast(%q): expected %v, got %v", tc.version, tc.want, got)
+		}
+	}
+}
+
+func TestGetTokenForHost(t *testing.T) {
+	bin := t.TempDir()
+	fakeGh := "#!/bin/sh\necho \"token-for $*\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "gh"), []byte(fakeGh), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	token, err := GetTokenForHost("carol", "ghe.example.com")
+	if err != nil {
+		t.Fatalf("GetTokenForHost: %v", err)
+	}
+	if want := "token-for auth token --user carol --hostname ghe.example.com"; token != want {
+		t.Errorf("expected %q, got %q", want, token)
+	}
+	token, err = GetToken("alice")
+	if err != nil {
+		t.Fatalf("GetToken: %v", err)
+	}
+	if want := "token-for auth token --user alice"; token != want {
+		t.Errorf("expected %q, got %q", want, token)
+	}
+}
@@ -0,0 +1,110 @@
+package ghauth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigDir returns gh's configuration directory, resolved the way gh
+// does: GH_CONFIG_DIR, then XDG_CONFIG_HOME/gh, then %AppData%/GitHub CLI
+// on Windows, then ~/.config/gh.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "gh"), nil
+	}
+	if appData := os.Getenv("AppData"); runtime.GOOS == "windows" && appData != "" {
+		return filepath.Join(appData, "GitHub CLI"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "gh"), nil
+}
+
+// HostsPath returns the path of gh's hosts.yml.
+func HostsPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hosts.yml"), nil
+}
+
+// ReadHosts lists the accounts recorded in gh's hosts.yml, in file order,
+// without running gh or touching the network. Tokens are not read.
+func ReadHosts() ([]UserInfo, error) {
+	path, err := HostsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read gh hosts file: %w", err)
+	}
+	users, err := parseHosts(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// hostEntry is the part of a hosts.yml host entry gh-autoprofile uses.
+// gh 2.40+ lists every account under users and names the active one in
+// user; older files hold a single account in user.
+type hostEntry struct {
+	User        string    `yaml:"user"`
+	GitProtocol string    `yaml:"git_protocol"`
+	Users       yaml.Node `yaml:"users"`
+}
+
+func parseHosts(data []byte) ([]UserInfo, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping of hosts")
+	}
+
+	var users []UserInfo
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		host := root.Content[i].Value
+		var entry hostEntry
+		if err := root.Content[i+1].Decode(&entry); err != nil {
+			return nil, fmt.Errorf("host %s: %w", host, err)
+		}
+		protocol := entry.GitProtocol
+		if protocol == "" {
+			protocol = "https"
+		}
+		var names []string
+		if entry.Users.Kind == yaml.MappingNode {
+			for j := 0; j < len(entry.Users.Content); j += 2 {
+				names = append(names, entry.Users.Content[j].Value)
+			}
+		} else if entry.User != "" {
+			names = []string{entry.User}
+		}
+		for _, name := range names {
+			users = append(users, UserInfo{
+				User:     name,
+				Host:     host,
+				Active:   name == entry.User,
+				Protocol: protocol,
+			})
+		}
+	}
+	return users, nil
+}
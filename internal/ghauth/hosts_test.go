@@ -0,0 +1,75 @@
+package ghauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	data := `github.com:
+    users:
+        alice:
+        bob-work:
+            oauth_token: gho_secret
+    git_protocol: ssh
+    user: bob-work
+    oauth_token: gho_secret
+ghe.example.com:
+    user: carol
+`
+	users, err := parseHosts([]byte(data))
+	if err != nil {
+		t.Fatalf("parseHosts: %v", err)
+	}
+	want := []UserInfo{
+		{User: "alice", Host: "github.com", Active: false, Protocol: "ssh"},
+		{User: "bob-work", Host: "github.com", Active: true, Protocol: "ssh"},
+		{User: "carol", Host: "ghe.example.com", Active: true, Protocol: "https"},
+	}
+	if len(users) != len(want) {
+		t.Fatalf("expected %d users, got %+v", len(want), users)
+	}
+	for i := range want {
+		if users[i] != want[i] {
+			t.Errorf("user %d: expected %+v, got %+v", i, want[i], users[i])
+		}
+	}
+}
+
+func TestParseHosts_Empty(t *testing.T) {
+	users, err := parseHosts(nil)
+	if err != nil || len(users) != 0 {
+		t.Fatalf("expected no users and no error, got %+v, %v", users, err)
+	}
+	if _, err := parseHosts([]byte("- not a mapping\n")); err == nil {
+		t.Fatal("expected an error for a non-mapping hosts file")
+	}
+}
+
+func TestHostsPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", dir)
+	path, err := HostsPath()
+	if err != nil || path != filepath.Join(dir, "hosts.yml") {
+		t.Fatalf("expected GH_CONFIG_DIR to win, got %q, %v", path, err)
+	}
+
+	t.Setenv("GH_CONFIG_DIR", "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	path, err = HostsPath()
+	if err != nil || path != filepath.Join(dir, "gh", "hosts.yml") {
+		t.Fatalf("expected XDG_CONFIG_HOME/gh, got %q, %v", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "gh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("github.com:\n    user: alice\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := ReadHosts()
+	if err != nil || len(users) != 1 || users[0].User != "alice" || !users[0].Active {
+		t.Fatalf("ReadHosts: got %+v, %v", users, err)
+	}
+}
@@ -0,0 +1,44 @@
+package ghauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Profile holds the public profile fields of a GitHub account.
+type Profile struct {
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// GetProfile fetches the public profile of a logged-in account through
+// `gh api`, authenticating with that account's token so the active account
+// does not need to change.
+func GetProfile(user, host string) (*Profile, error) {
+	token, err := GetTokenForHost(user, host)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"api", "user"}
+	if host != "" {
+		args = append(args, "--hostname", host)
+	}
+	cmd := exec.Command("gh", args...)
+	cmd.Env = append(os.Environ(), "GH_TOKEN="+token, "GH_ENTERPRISE_TOKEN="+token)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch profile for '%s': %w", user, err)
+	}
+	return parseProfile(out)
+}
+
+func parseProfile(data []byte) (*Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse profile: %w", err)
+	}
+	return &p, nil
+}
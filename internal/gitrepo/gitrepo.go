@@ -0,0 +1,108 @@
+package gitrepo
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Remote holds the parts of a GitHub remote URL that identify a repository.
+type Remote struct {
+	URL   string
+	Host  string
+	Owner string
+	Repo  string
+}
+
+// String returns the remote as host/owner/repo.
+func (r Remote) String() string {
+	return r.Host + "/" + r.Owner + "/" + r.Repo
+}
+
+// OriginRemote returns the parsed `origin` remote of the repository that
+// contains dir.
+func OriginRemote(dir string) (Remote, error) {
+	cmd := exec.Command("git", "-C", dir, "remote", "get-url", "origin")
+	out, err := cmd.Output()
+	if err != nil {
+		return Remote{}, fmt.Errorf("cannot read origin remote in %s: %w", dir, err)
+	}
+	return ParseRemote(strings.TrimSpace(string(out)))
+}
+
+// ParseRemote extracts host, owner and repository name from a git remote
+// URL. Supported forms:
+//
+//	https://github.com/owner/repo(.git)
+//	ssh://git@github.com(:22)/owner/repo(.git)
+//	git@github.com:owner/repo(.git)
+func ParseRemote(url string) (Remote, error) {
+	rest := url
+	if i := strings.Index(rest, "://"); i != -1 {
+		rest = rest[i+3:]
+		if at := strings.Index(rest, "@"); at != -1 && at < strings.Index(rest+"/", "/") {
+			rest = rest[at+1:]
+		}
+	} else {
+		// scp-like syntax: [user@]host:owner/repo. Anything without a
+		// colon before the first slash is a local path.
+		colon := strings.Index(rest, ":")
+		if colon == -1 || colon > strings.Index(rest+"/", "/") {
+			return Remote{}, fmt.Errorf("unrecognised remote URL: %s", url)
+		}
+		if at := strings.Index(rest, "@"); at != -1 && at < colon {
+			rest = rest[at+1:]
+		}
+		rest = strings.Replace(rest, ":", "/", 1)
+	}
+
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return Remote{}, fmt.Errorf("unrecognised remote URL: %s", url)
+	}
+
+	host := parts[0]
+	if colon := strings.Index(host, ":"); colon != -1 {
+		host = host[:colon]
+	}
+
+	return Remote{
+		URL:   url,
+		Host:  host,
+		Owner: parts[1],
+		Repo:  strings.TrimSuffix(parts[len(parts)-1], ".git"),
+	}, nil
+}
+
+// Identity is a git author name and email.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// RecentIdentities returns the distinct author identities of the last limit
+// commits in the repository that contains dir, most frequent first.
+func RecentIdentities(dir string, limit int) ([]Identity, error) {
+	cmd := exec.Command("git", "-C", dir, "log", fmt.Sprintf("-n%d", limit), "--format=%aN%x00%aE")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read git log in %s: %w", dir, err)
+	}
+
+	counts := map[Identity]int{}
+	var order []Identity
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, email, ok := strings.Cut(line, "\x00")
+		if !ok || email == "" {
+			continue
+		}
+		id := Identity{Name: name, Email: email}
+		if counts[id] == 0 {
+			order = append(order, id)
+		}
+		counts[id]++
+	}
+	sort.SliceStable(order, func(i, j int) bool { return counts[order[i]] > counts[order[j]] })
+	return order, nil
+}
@@ -0,0 +1,168 @@
+package gitrepo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		url   string
+		host  string
+		owner string
+		repo  string
+	}{
+		{"https://github.com/acme/widgets.git", "github.com", "acme", "widgets"},
+		{"https://github.com/acme/widgets", "github.com", "acme", "widgets"},
+		{"https://bob@github.com/acme/widgets", "github.com", "acme", "widgets"},
+		{"git@github.com:acme/widgets.git", "github.com", "acme", "widgets"},
+		{"ssh://git@ghe.acme.com:2222/platform/infra.git", "ghe.acme.com", "platform", "infra"},
+		{"git@github-work:acme/widgets.git", "github-work", "acme", "widgets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			r, err := ParseRemote(tt.url)
+			if err != nil {
+				t.Fatalf("ParseRemote(%q) failed: %v", tt.url, err)
+			}
+			if r.Host != tt.host || r.Owner != tt.owner || r.Repo != tt.repo {
+				t.Errorf("ParseRemote(%q) = %s, want %s/%s/%s", tt.url, r, tt.host, tt.owner, tt.repo)
+			}
+		})
+	}
+}
+
+func TestParseRemote_Invalid(t *testing.T) {
+	for _, url := range []string{"", "github.com", "https://github.com/acme", "/srv/git/widgets.git"} {
+		if _, err := ParseRemote(url); err == nil {
+			t.Errorf("ParseRemote(%q) should fail", url)
+		}
+	}
+}
+
+func TestOriginRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", "git@github.com:acme/widgets.git"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	r, err := OriginRemote(dir)
+	if err != nil {
+		t.Fatalf("OriginRemote failed: %v", err)
+	}
+	if r.Owner != "acme" || r.Repo != "widgets" {
+		t.Errorf("unexpected remote: %s", r)
+	}
+}
+
+func TestRecentIdentities(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+
+	dir := t.TempDir()
+	commit := func(name, email string) {
+		cmd := exec.Command("git", "-C", dir, "-c", "user.name="+name, "-c", "user.email="+email,
+			"commit", "-q", "--allow-empty", "-m", "c")
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME="+name, "GIT_AUTHOR_EMAIL="+email)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git commit failed: %v\n%s", err, out)
+		}
+	}
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, out)
+	}
+	commit("Alice", "alice@example.org")
+	commit("Bob Smith", "bob@acme.com")
+	commit("Bob Smith", "bob@acme.com")
+
+	ids, err := RecentIdentities(dir, 50)
+	if err != nil {
+		t.Fatalf("RecentIdentities failed: %v", err)
+	}
+	want := []Identity{{"Bob Smith", "bob@acme.com"}, {"Alice", "alice@example.org"}}
+	if len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] {
+		t.Errorf("RecentIdentities = %v, want %v", ids, want)
+	}
+
+	if _, err := RecentIdentities(t.TempDir(), 50); err == nil {
+		t.Error("expected error outside a repository")
+	}
+}
+
+func TestStatFileAndExclude(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+
+	if state, err := StatFile(filepath.Join(t.TempDir(), ".envrc")); state != Outside || err != nil {
+		t.Errorf("outside a repository: %v, %v", state, err)
+	}
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "svc")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	for _, name := range []string{"tracked", "ignored"} {
+		if err := os.WriteFile(filepath.Join(sub, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("ignored\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "svc/tracked")
+
+	for name, want := range map[string]FileState{"tracked": Tracked, "ignored": Ignored, ".envrc": Untracked} {
+		if state, err := StatFile(filepath.Join(sub, name)); state != want || err != nil {
+			t.Errorf("StatFile(%s) = %v, %v; want %v", name, state, err, want)
+		}
+	}
+
+	envrc := filepath.Join(sub, ".envrc")
+	file, entry, err := ExcludeFile(envrc)
+	if err != nil {
+		t.Fatalf("ExcludeFile: %v", err)
+	}
+	current, _ := os.ReadFile(file)
+	data, changed := AddExclude(current, entry)
+	if !changed {
+		t.Fatalf("AddExclude did not add %q", entry)
+	}
+	if !strings.HasSuffix(string(data), "\n/svc/.envrc\n") {
+		t.Errorf("exclude content = %q", data)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := StatFile(envrc); state != Ignored {
+		t.Errorf("after exclude: %v, want ignored", state)
+	}
+	if _, changed := AddExclude(data, entry); changed {
+		t.Error("second AddExclude changed the file; want unchanged")
+	}
+}
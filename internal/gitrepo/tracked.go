@@ -0,0 +1,116 @@
+package gitrepo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FileState is how git treats a file in a work tree.
+type FileState int
+
+const (
+	// Outside means the file is not in a git work tree, or git is not
+	// installed.
+	Outside FileState = iota
+	// Ignored means the file is untracked and matched by an ignore rule.
+	Ignored
+	// Untracked means the file is neither tracked nor ignored, so
+	// `git add .` would pick it up.
+	Untracked
+	// Tracked means the file is in the index; commits include its changes.
+	Tracked
+)
+
+func (s FileState) String() string {
+	switch s {
+	case Ignored:
+		return "ignored"
+	case Untracked:
+		return "untracked and not ignored"
+	case Tracked:
+		return "tracked by git"
+	}
+	return "outside a git repository"
+}
+
+// Committable reports whether changes to a file in this state can end up
+// in a commit without the user noticing.
+func (s FileState) Committable() bool {
+	return s == Untracked || s == Tracked
+}
+
+// StatFile returns how git treats the file at path. The file need not
+// exist.
+func StatFile(path string) (FileState, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return Outside, nil
+	}
+	dir, name := filepath.Split(path)
+	if err := exec.Command("git", "-C", dir, "rev-parse", "--is-inside-work-tree").Run(); err != nil {
+		return Outside, nil
+	}
+	if err := exec.Command("git", "-C", dir, "ls-files", "--error-unmatch", "--", name).Run(); err == nil {
+		return Tracked, nil
+	}
+
+	err := exec.Command("git", "-C", dir, "check-ignore", "-q", "--", name).Run()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return Ignored, nil
+	case errors.As(err, &exit) && exit.ExitCode() == 1:
+		return Untracked, nil
+	}
+	return Outside, fmt.Errorf("cannot check whether %s is ignored: %w", path, err)
+}
+
+// ExcludeFile returns the info/exclude file of the repository containing
+// path and the entry that excludes path. Excluding only hides untracked
+// files; a tracked file stays tracked.
+func ExcludeFile(path string) (file, entry string, err error) {
+	dir, name := filepath.Split(path)
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--git-path", "info/exclude", "--show-prefix").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("cannot locate git info/exclude for %s: %w", path, err)
+	}
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	file = lines[0]
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	prefix := ""
+	if len(lines) > 1 {
+		prefix = lines[1]
+	}
+	return file, "/" + escapePattern(prefix+name), nil
+}
+
+// AddExclude returns the info/exclude content data with entry added.
+// changed is false when the entry is already there.
+func AddExclude(data []byte, entry string) (updated []byte, changed bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return data, false
+		}
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	return append(data, entry+"\n"...), true
+}
+
+// escapePattern quotes the characters gitignore patterns treat specially.
+func escapePattern(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`\*?[`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
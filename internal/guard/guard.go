@@ -0,0 +1,216 @@
+package guard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+// HookNames lists the git hooks managed by `gh autoprofile guard`.
+var HookNames = []string{"pre-commit", "pre-push"}
+
+// hookMarker identifies hook scripts written by gh-autoprofile so they can
+// be replaced or removed without touching user-written hooks.
+const hookMarker = "# gh-autoprofile:guard"
+
+// ErrForeignHook is returned when a hook file exists that was not written
+// by gh-autoprofile.
+var ErrForeignHook = errors.New("hook exists and is not managed by gh-autoprofile")
+
+// Script returns the managed hook script for the given git hook.
+func Script(hook string) []byte {
+	return []byte(`#!/bin/sh
+` + hookMarker + `
+# Managed by 'gh autoprofile guard install' — do not edit.
+# Rejects commits, and pushes of commits, whose author email does not match
+# the pinned account.
+if command -v gh >/dev/null 2>&1; then
+  exec gh autoprofile guard check --hook ` + hook + `
+fi
+echo "gh-autoprofile: gh not found; skipping identity check" >&2
+exit 0
+`)
+}
+
+// IsManaged reports whether the hook file at path was written by
+// gh-autoprofile.
+func IsManaged(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(data), hookMarker)
+}
+
+// HooksDir returns the hooks directory git uses for the repository
+// containing dir. It honours core.hooksPath.
+func HooksDir(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "rev-parse", "--git-path", "hooks")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s is not inside a git repository: %w", dir, err)
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	return hooksDir, nil
+}
+
+// Install writes the managed hooks into hooksDir. Existing hooks that were
+// not written by gh-autoprofile are left alone unless force is set.
+// Returns the paths of the installed hooks.
+func Install(hooksDir string, force bool) ([]string, error) {
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create hooks directory %s: %w", hooksDir, err)
+	}
+
+	var installed []string
+	for _, name := range HookNames {
+		path := filepath.Join(hooksDir, name)
+		if _, err := os.Stat(path); err == nil && !IsManaged(path) && !force {
+			return installed, fmt.Errorf("%s: %w (use --force to replace it)", path, ErrForeignHook)
+		}
+		if err := os.WriteFile(path, Script(name), 0755); err != nil {
+			return installed, fmt.Errorf("cannot write hook %s: %w", path, err)
+		}
+		installed = append(installed, path)
+	}
+	return installed, nil
+}
+
+// Uninstall removes the managed hooks from hooksDir. Hooks not written by
+// gh-autoprofile are kept. Returns the paths of the removed hooks.
+func Uninstall(hooksDir string) ([]string, error) {
+	var removed []string
+	for _, name := range HookNames {
+		path := filepath.Join(hooksDir, name)
+		if !IsManaged(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("cannot remove hook %s: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// AuthorEmail returns the author email git would record for a commit made
+// in dir, taking GIT_AUTHOR_EMAIL and git config into account.
+func AuthorEmail(dir string) (string, error) {
+	cmd := exec.Command("git", "-C", dir, "var", "GIT_AUTHOR_IDENT")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine git author identity: %w", err)
+	}
+	// Output: "Name <email> 1700000000 +0100"
+	ident := string(out)
+	start := strings.Index(ident, "<")
+	end := strings.Index(ident, ">")
+	if start == -1 || end < start {
+		return "", fmt.Errorf("unexpected git author identity: %s", strings.TrimSpace(ident))
+	}
+	return ident[start+1 : end], nil
+}
+
+// CheckIdentity verifies that email matches the git email of the pin.
+// Pins without a git email accept any identity.
+func CheckIdentity(pin *config.Pin, email string) error {
+	if pin.GitEmail == "" || strings.EqualFold(pin.GitEmail, email) {
+		return nil
+	}
+	return fmt.Errorf("author email %s does not match %s pinned for '%s' in %s", email, pin.GitEmail, pin.User, pin.Dir)
+}
+
+// PushRef is one line git passes to a pre-push hook on stdin.
+type PushRef struct {
+	LocalRef, LocalSHA, RemoteRef, RemoteSHA string
+}
+
+// ParsePushRefs reads the "<local ref> <local sha> <remote ref> <remote
+// sha>" lines of a pre-push hook's stdin.
+func ParsePushRefs(r io.Reader) ([]PushRef, error) {
+	var refs []PushRef
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected pre-push input: %q", scanner.Text())
+		}
+		refs = append(refs, PushRef{fields[0], fields[1], fields[2], fields[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read pre-push input: %w", err)
+	}
+	return refs, nil
+}
+
+// Commit is a commit about to be pushed and its author email.
+type Commit struct {
+	SHA, Email string
+}
+
+// PushedCommits lists the commits in dir that pushing refs would send:
+// those between each remote and local sha, or, for a new remote ref, those
+// not on any remote-tracking branch. Deletions send nothing.
+func PushedCommits(dir string, refs []PushRef) ([]Commit, error) {
+	var commits []Commit
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if isZeroSHA(ref.LocalSHA) {
+			continue
+		}
+		args := []string{ref.LocalSHA, "--not", "--remotes"}
+		if !isZeroSHA(ref.RemoteSHA) && hasCommit(dir, ref.RemoteSHA) {
+			args = []string{ref.RemoteSHA + ".." + ref.LocalSHA}
+		}
+		out, err := exec.Command("git", append([]string{"-C", dir, "log", "--format=%H %aE"}, args...)...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("cannot list commits pushed to %s: %w", ref.RemoteRef, err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			sha, email, ok := strings.Cut(line, " ")
+			if !ok || seen[sha] {
+				continue
+			}
+			seen[sha] = true
+			commits = append(commits, Commit{SHA: sha, Email: email})
+		}
+	}
+	return commits, nil
+}
+
+// CheckCommits verifies the author email of every commit against the pin.
+// The error lists each offending commit.
+func CheckCommits(pin *config.Pin, commits []Commit) error {
+	var bad []string
+	for _, c := range commits {
+		if CheckIdentity(pin, c.Email) != nil {
+			bad = append(bad, fmt.Sprintf("%.12s %s", c.SHA, c.Email))
+		}
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d commit(s) not authored as %s pinned for '%s' in %s:\n  %s",
+		len(bad), pin.GitEmail, pin.User, pin.Dir, strings.Join(bad, "\n  "))
+}
+
+func isZeroSHA(sha string) bool {
+	return strings.Trim(sha, "0") == ""
+}
+
+func hasCommit(dir, sha string) bool {
+	return exec.Command("git", "-C", dir, "cat-file", "-e", sha+"^{commit}").Run() == nil
+}
@@ -0,0 +1,202 @@
+package guard
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func TestInstallAndUninstall(t *testing.T) {
+	hooksDir := filepath.Join(t.TempDir(), "hooks")
+
+	installed, err := Install(hooksDir, false)
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if len(installed) != len(HookNames) {
+		t.Fatalf("expected %d hooks installed, got %d", len(HookNames), len(installed))
+	}
+	for _, name := range HookNames {
+		path := filepath.Join(hooksDir, name)
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("hook %s not written: %v", name, err)
+		}
+		if fi.Mode().Perm()&0100 == 0 {
+			t.Errorf("hook %s is not executable: %o", name, fi.Mode().Perm())
+		}
+		content, _ := os.ReadFile(path)
+		if !strings.Contains(string(content), "guard check --hook "+name) {
+			t.Errorf("hook %s does not call guard check:\n%s", name, content)
+		}
+	}
+
+	// Re-installing over managed hooks is fine.
+	if _, err := Install(hooksDir, false); err != nil {
+		t.Fatalf("second Install failed: %v", err)
+	}
+
+	removed, err := Uninstall(hooksDir)
+	if err != nil {
+		t.Fatalf("Uninstall failed: %v", err)
+	}
+	if len(removed) != len(HookNames) {
+		t.Errorf("expected %d hooks removed, got %d", len(HookNames), len(removed))
+	}
+	for _, name := range HookNames {
+		if _, err := os.Stat(filepath.Join(hooksDir, name)); !os.IsNotExist(err) {
+			t.Errorf("hook %s still present after Uninstall", name)
+		}
+	}
+}
+
+func TestInstall_RefusesForeignHook(t *testing.T) {
+	hooksDir := t.TempDir()
+	foreign := filepath.Join(hooksDir, "pre-commit")
+	if err := os.WriteFile(foreign, []byte("#!/bin/sh\nmake lint\n"), 0755); err != nil {
+		t.Fatalf("cannot write foreign hook: %v", err)
+	}
+
+	if _, err := Install(hooksDir, false); !errors.Is(err, ErrForeignHook) {
+		t.Fatalf("expected ErrForeignHook, got %v", err)
+	}
+	content, _ := os.ReadFile(foreign)
+	if !strings.Contains(string(content), "make lint") {
+		t.Error("foreign hook was overwritten without --force")
+	}
+
+	// Uninstall must not remove the foreign hook either.
+	if _, err := Uninstall(hooksDir); err != nil {
+		t.Fatalf("Uninstall failed: %v", err)
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Error("foreign hook was removed by Uninstall")
+	}
+
+	if _, err := Install(hooksDir, true); err != nil {
+		t.Fatalf("Install with force failed: %v", err)
+	}
+	if !IsManaged(foreign) {
+		t.Error("expected foreign hook to be replaced with --force")
+	}
+}
+
+func TestCheckIdentity(t *testing.T) {
+	pin := &config.Pin{User: "bob-work", Dir: "/work", GitEmail: "bob@company.com"}
+
+	if err := CheckIdentity(pin, "bob@company.com"); err != nil {
+		t.Errorf("matching email rejected: %v", err)
+	}
+	if err := CheckIdentity(pin, "Bob@Company.com"); err != nil {
+		t.Errorf("email comparison should be case-insensitive: %v", err)
+	}
+	if err := CheckIdentity(pin, "bob@personal.dev"); err == nil {
+		t.Error("mismatching email accepted")
+	}
+	if err := CheckIdentity(&config.Pin{User: "alice", Dir: "/home"}, "any@where"); err != nil {
+		t.Errorf("pin without email should accept any identity: %v", err)
+	}
+}
+
+func TestHooksDirAndAuthorEmail(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v\n%s", err, out)
+	}
+
+	hooksDir, err := HooksDir(dir)
+	if err != nil {
+		t.Fatalf("HooksDir failed: %v", err)
+	}
+	if hooksDir != filepath.Join(dir, ".git", "hooks") {
+		t.Errorf("HooksDir = %s, want %s", hooksDir, filepath.Join(dir, ".git", "hooks"))
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "Bob")
+	t.Setenv("GIT_AUTHOR_EMAIL", "bob@company.com")
+	email, err := AuthorEmail(dir)
+	if err != nil {
+		t.Fatalf("AuthorEmail failed: %v", err)
+	}
+	if email != "bob@company.com" {
+		t.Errorf("AuthorEmail = %q, want bob@company.com", email)
+	}
+}
+
+func TestPushedCommits_WrongAuthor(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	dir := filepath.Join(root, "work")
+	git := func(env []string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), env...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(email, msg string) string {
+		ident := []string{"GIT_AUTHOR_NAME=Bob", "GIT_AUTHOR_EMAIL=" + email,
+			"GIT_COMMITTER_NAME=Bob", "GIT_COMMITTER_EMAIL=" + email}
+		git(ident, "-C", dir, "commit", "-q", "--allow-empty", "-m", msg)
+		return git(nil, "-C", dir, "rev-parse", "HEAD")
+	}
+
+	git(nil, "init", "-q", "--bare", remote)
+	git(nil, "init", "-q", "-b", "main", dir)
+	git(nil, "-C", dir, "remote", "add", "origin", remote)
+	pushed := commit("bob@company.com", "already pushed")
+	git(nil, "-C", dir, "push", "-q", "origin", "main")
+	good := commit("bob@company.com", "good")
+	bad := commit("bob@personal.dev", "wrong author")
+
+	pin := &config.Pin{User: "bob-work", Dir: dir, GitEmail: "bob@company.com"}
+	input := "refs/heads/main " + bad + " refs/heads/main " + pushed + "\n" +
+		"refs/heads/topic " + good + " refs/heads/topic " + strings.Repeat("0", 40) + "\n" +
+		"(delete) " + strings.Repeat("0", 40) + " refs/heads/old " + pushed + "\n"
+	refs, err := ParsePushRefs(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParsePushRefs: %v", err)
+	}
+	commits, err := PushedCommits(dir, refs)
+	if err != nil {
+		t.Fatalf("PushedCommits: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected the 2 unpushed commits, got %+v", commits)
+	}
+	err = CheckCommits(pin, commits)
+	if err == nil || !strings.Contains(err.Error(), bad[:12]+" bob@personal.dev") || strings.Contains(err.Error(), good[:12]) {
+		t.Fatalf("expected only the wrong-author commit to be rejected, got %v", err)
+	}
+
+	// The new branch alone holds only commits with the pinned author.
+	commits, err = PushedCommits(dir, refs[1:])
+	if err != nil {
+		t.Fatalf("PushedCommits: %v", err)
+	}
+	if err := CheckCommits(pin, commits); err != nil {
+		t.Errorf("expected the good commits to pass, got %v", err)
+	}
+
+	if _, err := ParsePushRefs(strings.NewReader("garbage\n")); err == nil {
+		t.Error("expected malformed pre-push input to be rejected")
+	}
+}
@@ -0,0 +1,338 @@
+// Package history keeps a bounded log of the files each mutating command
+// changed, so the last operation can be undone.
+package history
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxEntries is the number of operations kept; older ones are pruned.
+const MaxEntries = 20
+
+const entryFile = "entry.yml"
+
+// Entry is one recorded operation.
+type Entry struct {
+	ID      string    `yaml:"-"`
+	Command string    `yaml:"command"`
+	Time    time.Time `yaml:"time"`
+	Files   []File    `yaml:"files"`
+	Renames []Rename  `yaml:"renames,omitempty"`
+}
+
+// File is the state of one file before the operation.
+type File struct {
+	Path    string      `yaml:"path"`
+	Existed bool        `yaml:"existed"`
+	Mode    os.FileMode `yaml:"mode,omitempty"`
+	// Blob names the saved previous content inside the entry directory.
+	Blob string `yaml:"blob,omitempty"`
+	// After fingerprints the file as the operation left it, so undo can
+	// tell when it was changed since.
+	After string `yaml:"after"`
+}
+
+// Rename is a directory moved by the operation.
+type Rename struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// ErrEmpty is returned by Undo when there is nothing to undo.
+var ErrEmpty = errors.New("no recorded operations to undo")
+
+// Dir returns the directory holding the history entries.
+func Dir() (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history"), nil
+}
+
+type fileState struct {
+	exists bool
+	data   []byte
+	mode   os.FileMode
+}
+
+func readState(path string) (fileState, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return fileState{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{exists: true, data: data, mode: fi.Mode().Perm()}, nil
+}
+
+func (s fileState) fingerprint() string {
+	if !s.exists {
+		return ""
+	}
+	sum := sha256.Sum256(s.data)
+	return fmt.Sprintf("%04o:%s", s.mode, hex.EncodeToString(sum[:]))
+}
+
+// Recorder captures files before a command changes them.
+type Recorder struct {
+	command string
+	paths   []string
+	before  map[string]fileState
+	renames []Rename
+}
+
+// Begin starts recording an operation of command and captures pins.yml.
+func Begin(command string) (*Recorder, error) {
+	r := &Recorder{command: command, before: map[string]fileState{}}
+	pinsPath, err := config.PinsFilePath()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Capture(pinsPath); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Capture records path as it is now. Capturing a path twice keeps the
+// first state.
+func (r *Recorder) Capture(path string) error {
+	return r.CaptureAs(path, path)
+}
+
+// CaptureAs records path as it is now as the state of as, for files that
+// are about to be moved to as.
+func (r *Recorder) CaptureAs(path, as string) error {
+	if _, ok := r.before[as]; ok {
+		return nil
+	}
+	state, err := readState(path)
+	if err != nil {
+		return fmt.Errorf("cannot record %s: %w", path, err)
+	}
+	r.before[as] = state
+	r.paths = append(r.paths, as)
+	return nil
+}
+
+// CaptureEnvrc records the .envrc in dir.
+func (r *Recorder) CaptureEnvrc(dir string) error {
+	return r.Capture(filepath.Join(dir, ".envrc"))
+}
+
+// CapturePin records the files gh-autoprofile manages for pin.
+func (r *Recorder) CapturePin(pin config.Pin) error {
+	for _, path := range pin.ManagedFiles() {
+		if err := r.Capture(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename records that the directory from was moved to to. Capture files
+// inside the moved directory under their new path, with CaptureAs before
+// the move.
+func (r *Recorder) Rename(from, to string) {
+	r.renames = append(r.renames, Rename{From: from, To: to})
+}
+
+// Commit saves the captured files that the operation changed as a new
+// history entry and prunes old entries. Nothing is saved when no file
+// changed.
+func (r *Recorder) Commit() error {
+	entry := Entry{Command: r.command, Time: time.Now(), Renames: r.renames}
+	var blobs [][]byte
+	for _, path := range r.paths {
+		before := r.before[path]
+		after, err := readState(path)
+		if err != nil {
+			return fmt.Errorf("cannot record %s: %w", path, err)
+		}
+		if before.exists == after.exists && before.mode == after.mode && bytes.Equal(before.data, after.data) {
+			continue
+		}
+		f := File{Path: path, Existed: before.exists, After: after.fingerprint()}
+		if before.exists {
+			f.Mode = before.mode
+			f.Blob = strconv.Itoa(len(blobs))
+			blobs = append(blobs, before.data)
+		}
+		entry.Files = append(entry.Files, f)
+	}
+	if len(entry.Files) == 0 && len(entry.Renames) == 0 {
+		return nil
+	}
+
+	root, err := Dir()
+	if err != nil {
+		return err
+	}
+	entryDir := filepath.Join(root, entry.Time.UTC().Format("20060102T150405.000000000Z"))
+	if err := os.MkdirAll(entryDir, 0700); err != nil {
+		return fmt.Errorf("cannot create history entry: %w", err)
+	}
+	for i, data := range blobs {
+		if err := os.WriteFile(filepath.Join(entryDir, strconv.Itoa(i)), data, 0600); err != nil {
+			return fmt.Errorf("cannot write history entry: %w", err)
+		}
+	}
+	data, err := yaml.Marshal(&entry)
+	if err != nil {
+		return fmt.Errorf("cannot encode history entry: %w", err)
+	}
+	// entry.yml is written last: a directory without it is incomplete and
+	// ignored by List.
+	if err := fsutil.WriteFileAtomic(filepath.Join(entryDir, entryFile), data, 0600); err != nil {
+		return fmt.Errorf("cannot write history entry: %w", err)
+	}
+	return prune(root)
+}
+
+// List returns the recorded operations, newest first.
+func List() ([]Entry, error) {
+	root, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read history: %w", err)
+	}
+
+	var entries []Entry
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if !dirs[i].IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, dirs[i].Name(), entryFile))
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if err := yaml.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("cannot parse history entry %s: %w", dirs[i].Name(), err)
+		}
+		e.ID = dirs[i].Name()
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func prune(root string) error {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, d := range dirs {
+		if d.IsDir() {
+			names = append(names, d.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > MaxEntries {
+		if err := os.RemoveAll(filepath.Join(root, names[0])); err != nil {
+			return fmt.Errorf("cannot prune history: %w", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Conflicts lists the files and directories of e that changed after the
+// operation, which Undo would overwrite.
+func (e *Entry) Conflicts() []string {
+	var conflicts []string
+	for _, f := range e.Files {
+		state, err := readState(f.Path)
+		if err != nil || state.fingerprint() != f.After {
+			conflicts = append(conflicts, f.Path)
+		}
+	}
+	for _, r := range e.Renames {
+		if _, err := os.Stat(r.From); err == nil {
+			conflicts = append(conflicts, r.From+" exists again")
+		} else if _, err := os.Stat(r.To); err != nil {
+			conflicts = append(conflicts, r.To+" is gone")
+		}
+	}
+	return conflicts
+}
+
+// Undo reverts the newest recorded operation and removes it from the
+// history. Unless force is set it refuses when files changed since the
+// operation. The caller holds the pins lock.
+func Undo(force bool) (*Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrEmpty
+	}
+	e := entries[0]
+	if !force {
+		if conflicts := e.Conflicts(); len(conflicts) > 0 {
+			return nil, fmt.Errorf("changed since '%s' ran (use --force to overwrite):\n  %s", e.Command, strings.Join(conflicts, "\n  "))
+		}
+	}
+
+	root, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entryDir := filepath.Join(root, e.ID)
+
+	var errs []error
+	for i := len(e.Files) - 1; i >= 0; i-- {
+		f := e.Files[i]
+		if !f.Existed {
+			if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(entryDir, f.Blob))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot read saved copy of %s: %w", f.Path, err))
+			continue
+		}
+		if err := fsutil.WriteFileAtomic(f.Path, data, f.Mode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := len(e.Renames) - 1; i >= 0; i-- {
+		r := e.Renames[i]
+		if err := os.Rename(r.To, r.From); err != nil {
+			errs = append(errs, fmt.Errorf("cannot move %s back: %w", r.To, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return &e, err
+	}
+	return &e, os.RemoveAll(entryDir)
+}
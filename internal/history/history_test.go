@@ -0,0 +1,184 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func writeFile(t *testing.T, path, content string, perm os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndo_RestoresChangedAndDeletedFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	envrc := filepath.Join(dir, ".envrc")
+	writeFile(t, envrc, "export FOO=1\n", 0640)
+	created := filepath.Join(t.TempDir(), ".envrc")
+
+	if err := config.SavePins(&config.PinRegistry{}); err != nil {
+		t.Fatal(err)
+	}
+	pinsPath, _ := config.PinsFilePath()
+	before := readFile(t, pinsPath)
+
+	rec, err := Begin("unpin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{envrc, created} {
+		if err := rec.Capture(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := config.SavePins(&config.PinRegistry{Pins: []config.Pin{{User: "alice", Dir: dir}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(envrc); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, created, "new\n", 0600)
+	if err := rec.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("List = %v, %v; want one entry", entries, err)
+	}
+	if entries[0].Command != "unpin" || len(entries[0].Files) != 3 {
+		t.Errorf("entry = %+v", entries[0])
+	}
+
+	if _, err := Undo(false); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got := readFile(t, pinsPath); got != before {
+		t.Errorf("pins.yml = %q, want %q", got, before)
+	}
+	if got := readFile(t, envrc); got != "export FOO=1\n" {
+		t.Errorf(".envrc = %q", got)
+	}
+	if fi, _ := os.Stat(envrc); fi.Mode().Perm() != 0640 {
+		t.Errorf(".envrc mode = %04o, want 0640", fi.Mode().Perm())
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("created file still exists: %v", err)
+	}
+	if _, err := Undo(false); err != ErrEmpty {
+		t.Errorf("second Undo = %v, want ErrEmpty", err)
+	}
+}
+
+func TestCommit_SkipsUnchangedOperations(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	rec, err := Begin("edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.CaptureEnvrc(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := List(); len(entries) != 0 {
+		t.Errorf("recorded %d entries for a no-op", len(entries))
+	}
+}
+
+func TestUndo_RefusesWhenChangedSince(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	envrc := filepath.Join(t.TempDir(), ".envrc")
+	writeFile(t, envrc, "old\n", 0600)
+
+	rec, _ := Begin("pin")
+	if err := rec.Capture(envrc); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, envrc, "pinned\n", 0600)
+	if err := rec.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, envrc, "edited by hand\n", 0600)
+
+	_, err := Undo(false)
+	if err == nil || !strings.Contains(err.Error(), envrc) {
+		t.Fatalf("Undo = %v, want conflict on %s", err, envrc)
+	}
+	if _, err := Undo(true); err != nil {
+		t.Fatalf("Undo(force): %v", err)
+	}
+	if got := readFile(t, envrc); got != "old\n" {
+		t.Errorf(".envrc = %q, want old", got)
+	}
+}
+
+func TestUndo_MovesRenamedDirectoryBack(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	parent := t.TempDir()
+	from, to := filepath.Join(parent, "a"), filepath.Join(parent, "b")
+	if err := os.Mkdir(from, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(from, ".envrc"), "a\n", 0600)
+
+	rec, _ := Begin("mv")
+	if err := rec.CaptureAs(filepath.Join(from, ".envrc"), filepath.Join(to, ".envrc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+	rec.Rename(from, to)
+	writeFile(t, filepath.Join(to, ".envrc"), "b\n", 0600)
+	if err := rec.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Undo(false); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got := readFile(t, filepath.Join(from, ".envrc")); got != "a\n" {
+		t.Errorf(".envrc = %q, want a", got)
+	}
+	if _, err := os.Stat(to); !os.IsNotExist(err) {
+		t.Errorf("%s still exists", to)
+	}
+}
+
+func TestPrune_KeepsNewestEntries(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < MaxEntries+3; i++ {
+		if err := os.Mkdir(filepath.Join(root, fmt.Sprintf("20260101T0000%02d.000000000Z", i)), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := prune(root); err != nil {
+		t.Fatal(err)
+	}
+	dirs, _ := os.ReadDir(root)
+	if len(dirs) != MaxEntries {
+		t.Fatalf("kept %d entries, want %d", len(dirs), MaxEntries)
+	}
+	if dirs[0].Name() != "20260101T000003.000000000Z" {
+		t.Errorf("oldest kept = %s, want the 4th", dirs[0].Name())
+	}
+}
@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+)
+
+// FromGitconfig converts `[includeIf "gitdir:<dir>/"]` sections of the given
+// git config file into candidates. Identity comes from the included file's
+// user.email, user.name and core.sshCommand; the account from its
+// github.user, falling back to defaultUser when set.
+func FromGitconfig(path, defaultUser string) (*Result, error) {
+	res := &Result{}
+
+	out, err := exec.Command("git", "config", "--file", path, "--get-regexp", `^includeif\..*\.path$`).Output()
+	if err != nil {
+		// git config exits 1 when nothing matches.
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return res, nil
+		}
+		return nil, err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		condition := strings.TrimSuffix(strings.TrimPrefix(key, "includeif."), ".path")
+		pattern, ok := gitdirPattern(condition)
+		if !ok {
+			continue
+		}
+		dir, ok := gitdirToDir(pattern)
+		if !ok {
+			res.warnf("%s: includeIf %q uses a wildcard pattern; pin it manually", path, condition)
+			continue
+		}
+
+		included := fsutil.ExpandHome(value)
+		if !filepath.IsAbs(included) {
+			included = filepath.Join(filepath.Dir(path), included)
+		}
+
+		pin := config.Pin{
+			Dir:      dir,
+			Mode:     config.ModeWrapper,
+			User:     gitConfigValue(included, "github.user"),
+			GitEmail: gitConfigValue(included, "user.email"),
+			GitName:  gitConfigValue(included, "user.name"),
+		}
+		if sm := sshIdentityRe.FindStringSubmatch(gitConfigValue(included, "core.sshCommand")); sm != nil {
+			pin.SSHKey = fsutil.ExpandHome(sm[1])
+		}
+		if pin.User == "" {
+			pin.User = defaultUser
+		}
+		if pin.User == "" {
+			res.warnf("%s: no github.user in %s for %s; pass --user", path, included, dir)
+			continue
+		}
+
+		res.Candidates = append(res.Candidates, Candidate{
+			Pin:    pin,
+			Source: SourceGitconfig,
+			Origin: path,
+		})
+	}
+	return res, nil
+}
+
+// gitdirPattern extracts the pattern of a gitdir: or gitdir/i: condition.
+func gitdirPattern(condition string) (string, bool) {
+	for _, prefix := range []string{"gitdir:", "gitdir/i:"} {
+		if strings.HasPrefix(condition, prefix) {
+			return strings.TrimPrefix(condition, prefix), true
+		}
+	}
+	return "", false
+}
+
+// gitdirToDir converts a gitdir pattern such as "~/work/" or "~/work/**"
+// into the directory it covers. Patterns with other wildcards are rejected.
+func gitdirToDir(pattern string) (string, bool) {
+	p := strings.TrimSuffix(pattern, "**")
+	p = strings.TrimSuffix(p, "/.git")
+	p = strings.TrimSuffix(p, "/")
+	if p == "" || strings.ContainsAny(p, "*?[") {
+		return "", false
+	}
+	p = fsutil.ExpandHome(p)
+	if !filepath.IsAbs(p) {
+		return "", false
+	}
+	return filepath.Clean(p), true
+}
+
+func gitConfigValue(path, key string) string {
+	out, err := exec.Command("git", "config", "--file", path, "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,348 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+	"github.com/mdiloreto/gh-autoprofile/internal/ghauth"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// Sources supported by the importer.
+const (
+	SourceGhProfile = "gh-profile"
+	SourceGitconfig = "gitconfig"
+	SourceEnvrc     = "envrc"
+)
+
+// Candidate is a pin discovered in another tool's configuration.
+type Candidate struct {
+	Pin config.Pin
+
+	// Source is one of the Source* constants.
+	Source string
+
+	// Origin is the file the pin was derived from.
+	Origin string
+
+	// Superseded lists 1-based line numbers in Origin that the managed
+	// block replaces. They are commented out on import.
+	Superseded []int
+}
+
+// Result holds the candidates found by an importer and any entries that
+// could not be converted.
+type Result struct {
+	Candidates []Candidate
+	Warnings   []string
+}
+
+func (r *Result) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// maxScanDepth bounds how deep ScanEnvrcs descends below each root.
+const maxScanDepth = 4
+
+// ScanEnvrcs returns the .envrc files found under roots, skipping VCS
+// metadata, dependency directories and hidden directories.
+func ScanEnvrcs(roots []string) ([]string, error) {
+	var found []string
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %w", root, err)
+		}
+		err = filepath.WalkDir(absRoot, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				// Unreadable directories are skipped, not fatal.
+				if d != nil && d.IsDir() && path != absRoot {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if path == absRoot {
+					return nil
+				}
+				name := d.Name()
+				if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+					return filepath.SkipDir
+				}
+				rel, _ := filepath.Rel(absRoot, path)
+				if strings.Count(rel, string(filepath.Separator))+1 > maxScanDepth {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Name() == ".envrc" {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan %s: %w", absRoot, err)
+		}
+	}
+	return found, nil
+}
+
+var (
+	tokenUserRe   = regexp.MustCompile(`gh\s+auth\s+token\s+(?:.*\s)?--user[= ]\s*['"]?([A-Za-z0-9][A-Za-z0-9-]*)`)
+	exportVarRe   = regexp.MustCompile(`^\s*(?:export\s+)?([A-Z_][A-Z0-9_]*)=(.*)$`)
+	sshIdentityRe = regexp.MustCompile(`-i\s+['"]?([^'"\s]+)`)
+)
+
+// FromEnvrcs converts hand-written .envrc files that export
+// GH_TOKEN=$(gh auth token --user ...) into candidates. Files that already
+// contain a gh-autoprofile block are skipped.
+func FromEnvrcs(paths []string) (*Result, error) {
+	res := &Result{}
+	for _, path := range paths {
+		lines, err := readLines(path)
+		if err != nil {
+			return nil, err
+		}
+		if containsManagedBlock(lines) {
+			continue
+		}
+
+		pin := config.Pin{Dir: filepath.Dir(path), Mode: config.ModeExport}
+		var superseded []int
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			m := exportVarRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			name, value := m[1], unquote(m[2])
+			switch name {
+			case "GH_TOKEN", "GITHUB_TOKEN":
+				um := tokenUserRe.FindStringSubmatch(value)
+				if um == nil {
+					// GITHUB_TOKEN="$GH_TOKEN" copies are superseded too.
+					if strings.Contains(value, "$GH_TOKEN") || strings.Contains(value, "${GH_TOKEN}") {
+						superseded = append(superseded, i+1)
+					}
+					continue
+				}
+				if pin.User != "" && pin.User != um[1] {
+					res.warnf("%s: tokens for both '%s' and '%s'; keeping '%s'", path, pin.User, um[1], pin.User)
+				} else {
+					pin.User = um[1]
+				}
+			case "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL":
+				if pin.GitEmail == "" {
+					pin.GitEmail = value
+				}
+			case "GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME":
+				if pin.GitName == "" {
+					pin.GitName = value
+				}
+			case "GIT_SSH_COMMAND":
+				if sm := sshIdentityRe.FindStringSubmatch(value); sm != nil {
+					pin.SSHKey = fsutil.ExpandHome(sm[1])
+				}
+			default:
+				continue
+			}
+			superseded = append(superseded, i+1)
+		}
+
+		if pin.User == "" {
+			continue
+		}
+		res.Candidates = append(res.Candidates, Candidate{
+			Pin:        pin,
+			Source:     SourceEnvrc,
+			Origin:     path,
+			Superseded: superseded,
+		})
+	}
+	return res, nil
+}
+
+var ghConfigDirRe = regexp.MustCompile(`^\s*(?:export\s+)?GH_CONFIG_DIR=(.*)$`)
+
+// FromGhProfile converts directories activated with gh-profile (which
+// writes `export GH_CONFIG_DIR=<gh config>/profiles/<name>` into .envrc)
+// into candidates. The account is read from the profile's hosts.yml.
+// gh-profile records no directories of its own, so profiles in gh's
+// profiles directory that none of the .envrc files activate cannot be
+// converted; each is reported as a warning.
+func FromGhProfile(paths []string) (*Result, error) {
+	res := &Result{}
+	used := map[string]bool{}
+	for _, path := range paths {
+		lines, err := readLines(path)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range lines {
+			m := ghConfigDirRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			profileDir := fsutil.ExpandHome(unquote(m[1]))
+			if filepath.Base(filepath.Dir(profileDir)) != "profiles" {
+				continue
+			}
+			used[filepath.Clean(profileDir)] = true
+
+			user, err := profileUser(filepath.Join(profileDir, "hosts.yml"))
+			if err != nil {
+				res.warnf("%s: profile %s: %v", path, filepath.Base(profileDir), err)
+				break
+			}
+			res.Candidates = append(res.Candidates, Candidate{
+				Pin:        config.Pin{User: user, Dir: filepath.Dir(path), Mode: config.ModeWrapper},
+				Source:     SourceGhProfile,
+				Origin:     path,
+				Superseded: []int{i + 1},
+			})
+			break
+		}
+	}
+
+	profiles, err := ghProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range profiles {
+		if used[dir] {
+			continue
+		}
+		name := filepath.Base(dir)
+		user, err := profileUser(filepath.Join(dir, "hosts.yml"))
+		if err != nil {
+			res.warnf("gh-profile %s: %v", name, err)
+			continue
+		}
+		res.warnf("gh-profile %s (account %s) is not activated by any scanned .envrc; pin it with: gh autoprofile pin %s --dir <directory>", name, user, user)
+	}
+	return res, nil
+}
+
+// ghProfiles lists the profile directories gh-profile keeps under gh's
+// configuration directory, in name order.
+func ghProfiles() ([]string, error) {
+	configDir, err := ghauth.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	// Inside a gh-profile directory GH_CONFIG_DIR names the profile itself.
+	if filepath.Base(filepath.Dir(configDir)) == "profiles" {
+		configDir = filepath.Dir(filepath.Dir(configDir))
+	}
+	profilesDir := filepath.Join(configDir, "profiles")
+	entries, err := os.ReadDir(profilesDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot list gh-profile profiles: %w", err)
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(profilesDir, e.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+// profileUser returns the active account recorded in a gh hosts.yml.
+func profileUser(hostsPath string) (string, error) {
+	lines, err := readLines(hostsPath)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		// Host-level "user: <login>" (indented one level under the host).
+		if strings.HasPrefix(trimmed, "user:") && line != trimmed {
+			user := unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "user:")))
+			if user != "" {
+				return user, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no user found in %s", hostsPath)
+}
+
+// DisableLines comments out the given 1-based lines of path so that the
+// settings they held are only applied by the managed block. The change goes
+// through x, so a dry run only records it.
+func DisableLines(x plan.Executor, path string, lines []int) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	data, err := x.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	fi, err := x.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot stat %s: %w", path, err)
+	}
+	content, err := scanLines(bytes.NewReader(data), path)
+	if err != nil {
+		return err
+	}
+	for _, n := range lines {
+		if n >= 1 && n <= len(content) {
+			content[n-1] = "# disabled by gh-autoprofile import: " + content[n-1]
+		}
+	}
+	return x.WriteFile(path, []byte(strings.Join(content, "\n")+"\n"), fi.Mode().Perm())
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	defer f.Close()
+	return scanLines(f, path)
+}
+
+func scanLines(r io.Reader, path string) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+func containsManagedBlock(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "# gh-autoprofile:start" {
+			return true
+		}
+	}
+	return false
+}
+
+// unquote strips one level of matching single or double quotes.
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,220 @@
+package importer
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("cannot create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write %s: %v", path, err)
+	}
+}
+
+func TestScanEnvrcs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a", ".envrc"), "")
+	writeFile(t, filepath.Join(root, "b", "c", ".envrc"), "")
+	writeFile(t, filepath.Join(root, "node_modules", "x", ".envrc"), "")
+	writeFile(t, filepath.Join(root, ".cache", ".envrc"), "")
+	writeFile(t, filepath.Join(root, "1", "2", "3", "4", "5", ".envrc"), "")
+
+	found, err := ScanEnvrcs([]string{root})
+	if err != nil {
+		t.Fatalf("ScanEnvrcs failed: %v", err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 .envrc files, got %v", found)
+	}
+	for _, path := range found {
+		if strings.Contains(path, "node_modules") || strings.Contains(path, ".cache") {
+			t.Errorf("unexpected file scanned: %s", path)
+		}
+	}
+}
+
+func TestFromEnvrcs(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+
+	handWritten := filepath.Join(root, "work", ".envrc")
+	writeFile(t, handWritten, `# work account
+export GH_TOKEN=$(gh auth token --user bob-work)
+export GITHUB_TOKEN="$GH_TOKEN"
+export GIT_AUTHOR_EMAIL="bob@company.com"
+export GIT_AUTHOR_NAME='Bob Smith'
+export GIT_SSH_COMMAND="ssh -i ~/.ssh/id_work -o IdentitiesOnly=yes"
+export OTHER=1
+`)
+	managed := filepath.Join(root, "managed", ".envrc")
+	writeFile(t, managed, "# gh-autoprofile:start\nexport GH_TOKEN=$(gh auth token --user alice)\n# gh-autoprofile:end\n")
+	unrelated := filepath.Join(root, "plain", ".envrc")
+	writeFile(t, unrelated, "export FOO=bar\n")
+
+	res, err := FromEnvrcs([]string{handWritten, managed, unrelated})
+	if err != nil {
+		t.Fatalf("FromEnvrcs failed: %v", err)
+	}
+	if len(res.Candidates) != 1 {
+		t.Fatalf("expected 1 candidate, got %+v", res.Candidates)
+	}
+
+	c := res.Candidates[0]
+	want := config.Pin{
+		User:     "bob-work",
+		Dir:      filepath.Join(root, "work"),
+		Mode:     config.ModeExport,
+		GitEmail: "bob@company.com",
+		GitName:  "Bob Smith",
+		SSHKey:   filepath.Join(root, ".ssh", "id_work"),
+	}
+	if c.Pin.User != want.User || c.Pin.Dir != want.Dir || c.Pin.Mode != want.Mode ||
+		c.Pin.GitEmail != want.GitEmail || c.Pin.GitName != want.GitName || c.Pin.SSHKey != want.SSHKey {
+		t.Errorf("candidate pin = %+v, want %+v", c.Pin, want)
+	}
+	if got := len(c.Superseded); got != 5 {
+		t.Errorf("expected 5 superseded lines (tokens, email, name, ssh), got %v", c.Superseded)
+	}
+
+	if err := DisableLines(plan.Disk, handWritten, c.Superseded); err != nil {
+		t.Fatalf("DisableLines failed: %v", err)
+	}
+	content, _ := os.ReadFile(handWritten)
+	s := string(content)
+	if !strings.Contains(s, "# disabled by gh-autoprofile import: export GH_TOKEN=$(gh auth token --user bob-work)") {
+		t.Errorf("GH_TOKEN line not disabled:\n%s", s)
+	}
+	if !strings.Contains(s, "\nexport OTHER=1\n") {
+		t.Errorf("unrelated line was changed:\n%s", s)
+	}
+}
+
+func TestFromGhProfile(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GH_CONFIG_DIR", "")
+
+	writeFile(t, filepath.Join(root, ".config", "gh", "profiles", "work", "hosts.yml"), `github.com:
+    users:
+        bob-work:
+    git_protocol: ssh
+    user: bob-work
+`)
+	envrc := filepath.Join(root, "src", "acme", ".envrc")
+	writeFile(t, envrc, "export GH_CONFIG_DIR=\"$HOME/.config/gh/profiles/work\"\n")
+	missing := filepath.Join(root, "src", "gone", ".envrc")
+	writeFile(t, missing, "export GH_CONFIG_DIR=~/.config/gh/profiles/deleted\n")
+
+	res, err := FromGhProfile([]string{envrc, missing})
+	if err != nil {
+		t.Fatalf("FromGhProfile failed: %v", err)
+	}
+	if len(res.Candidates) != 1 {
+		t.Fatalf("expected 1 candidate, got %+v", res.Candidates)
+	}
+	c := res.Candidates[0]
+	if c.Pin.User != "bob-work" || c.Pin.Dir != filepath.Join(root, "src", "acme") {
+		t.Errorf("unexpected candidate: %+v", c.Pin)
+	}
+	if len(c.Superseded) != 1 || c.Superseded[0] != 1 {
+		t.Errorf("expected GH_CONFIG_DIR line superseded, got %v", c.Superseded)
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("expected a warning for the missing profile, got %v", res.Warnings)
+	}
+}
+
+func TestFromGhProfile_UnusedProfiles(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	profiles := filepath.Join(root, ".config", "gh", "profiles")
+	// Run from inside an activated directory: GH_CONFIG_DIR names a profile.
+	t.Setenv("GH_CONFIG_DIR", filepath.Join(profiles, "work"))
+
+	writeFile(t, filepath.Join(profiles, "work", "hosts.yml"), "github.com:\n    user: bob-work\n")
+	writeFile(t, filepath.Join(profiles, "oss", "hosts.yml"), "github.com:\n    user: alice\n")
+	envrc := filepath.Join(root, "src", "acme", ".envrc")
+	writeFile(t, envrc, "export GH_CONFIG_DIR=~/.config/gh/profiles/work\n")
+
+	res, err := FromGhProfile([]string{envrc})
+	if err != nil {
+		t.Fatalf("FromGhProfile failed: %v", err)
+	}
+	if len(res.Candidates) != 1 || res.Candidates[0].Pin.User != "bob-work" {
+		t.Fatalf("expected the work profile as the only candidate, got %+v", res.Candidates)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "gh-profile oss (account alice) is not activated") {
+		t.Errorf("expected a warning for the unused oss profile, got %v", res.Warnings)
+	}
+}
+
+func TestFromGitconfig(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+
+	writeFile(t, filepath.Join(root, ".gitconfig-work"), `[user]
+	email = bob@company.com
+	name = Bob Smith
+[github]
+	user = bob-work
+[core]
+	sshCommand = ssh -i ~/.ssh/id_work
+`)
+	writeFile(t, filepath.Join(root, ".gitconfig-oss"), "[user]\n\temail = alice@example.org\n")
+	gitconfig := filepath.Join(root, ".gitconfig")
+	writeFile(t, gitconfig, `[user]
+	email = alice@example.org
+[includeIf "gitdir:~/work/"]
+	path = ~/.gitconfig-work
+[includeIf "gitdir/i:~/oss/**"]
+	path = .gitconfig-oss
+[includeIf "gitdir:~/clients/*/acme/"]
+	path = ~/.gitconfig-work
+[includeIf "onbranch:main"]
+	path = ~/.gitconfig-work
+`)
+
+	res, err := FromGitconfig(gitconfig, "")
+	if err != nil {
+		t.Fatalf("FromGitconfig failed: %v", err)
+	}
+	if len(res.Candidates) != 1 {
+		t.Fatalf("expected 1 candidate, got %+v", res.Candidates)
+	}
+	pin := res.Candidates[0].Pin
+	if pin.User != "bob-work" || pin.Dir != filepath.Join(root, "work") || pin.GitEmail != "bob@company.com" ||
+		pin.GitName != "Bob Smith" || pin.SSHKey != filepath.Join(root, ".ssh", "id_work") {
+		t.Errorf("unexpected candidate: %+v", pin)
+	}
+	if len(res.Warnings) != 2 {
+		t.Errorf("expected warnings for missing user and wildcard pattern, got %v", res.Warnings)
+	}
+
+	// With a default user, the oss section becomes importable too.
+	res, err = FromGitconfig(gitconfig, "alice")
+	if err != nil {
+		t.Fatalf("FromGitconfig failed: %v", err)
+	}
+	if len(res.Candidates) != 2 {
+		t.Fatalf("expected 2 candidates with default user, got %+v", res.Candidates)
+	}
+	if res.Candidates[1].Pin.User != "alice" || res.Candidates[1].Pin.GitEmail != "alice@example.org" {
+		t.Errorf("unexpected candidate: %+v", res.Candidates[1].Pin)
+	}
+}
@@ -0,0 +1,110 @@
+package migrate
+
+import (
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// Step is one ordered upgrade of the pin registry or the files it manages.
+// Applying every step up to Version brings a registry to that schema
+// version.
+type Step struct {
+	Version int
+	Name    string
+
+	// Describe says what Apply does, for setup output.
+	Describe string
+
+	// Healthy is reported by doctor when Detect finds nothing to do.
+	Healthy string
+
+	// Detect returns one finding per item Apply would change. It must not
+	// modify anything.
+	Detect func(*config.PinRegistry) []string
+
+	// Apply performs the step, changing the registry in place and files
+	// through the executor. Pins whose managed block it rewrites go
+	// through the guard first. Items it cannot fix are returned as
+	// warnings; an error stops the migration.
+	Apply func(*config.PinRegistry, plan.Executor, Guard) (Result, error)
+}
+
+// Guard vets a pin before a step writes its managed block and returns the
+// pin to write, possibly with the block moved to another file. A pin it
+// rejects is left alone and reported as a warning. A nil Guard accepts
+// every pin.
+type Guard func(pin config.Pin, x plan.Executor) (config.Pin, error)
+
+// Result summarises what a step changed.
+type Result struct {
+	Changed  int
+	Warnings []string
+}
+
+// Status is the state of one step for a given registry.
+type Status struct {
+	Step     Step
+	Recorded bool
+	Findings []string
+}
+
+// Pending reports whether Run would apply the step.
+func (s Status) Pending() bool {
+	return !s.Recorded || len(s.Findings) > 0
+}
+
+// Outcome is the result of applying one step.
+type Outcome struct {
+	Step   Step
+	Result Result
+}
+
+// Latest returns the schema version reached by applying every step.
+func Latest() int {
+	return Steps[len(Steps)-1].Version
+}
+
+// Check runs every step's Detect against the registry.
+func Check(registry *config.PinRegistry) []Status {
+	var statuses []Status
+	for _, step := range Steps {
+		statuses = append(statuses, Status{
+			Step:     step,
+			Recorded: registry.Version >= step.Version,
+			Findings: step.Detect(registry),
+		})
+	}
+	return statuses
+}
+
+// Pending returns the steps Run would apply: those newer than the
+// registry's recorded version, and older ones whose Detect finds drift
+// again (e.g. permissions loosened by hand).
+func Pending(registry *config.PinRegistry) []Step {
+	var pending []Step
+	for _, st := range Check(registry) {
+		if st.Pending() {
+			pending = append(pending, st.Step)
+		}
+	}
+	return pending
+}
+
+// Run applies the pending steps in order through x and records each
+// successful one in registry.Version. It stops at the first failing step.
+// The caller saves the registry, including when an error is returned, so
+// completed steps stay recorded. Pass a *plan.Plan to preview a migration.
+func Run(registry *config.PinRegistry, x plan.Executor, guard Guard) ([]Outcome, error) {
+	var outcomes []Outcome
+	for _, step := range Pending(registry) {
+		res, err := step.Apply(registry, x, guard)
+		if err != nil {
+			return outcomes, err
+		}
+		outcomes = append(outcomes, Outcome{Step: step, Result: res})
+		if step.Version > registry.Version {
+			registry.Version = step.Version
+		}
+	}
+	return outcomes, nil
+}
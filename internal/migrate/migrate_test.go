@@ -0,0 +1,236 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+func setup(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("PATH", t.TempDir()) // no direnv: skip `direnv allow`
+}
+
+func TestLatestMatchesSchemaVersion(t *testing.T) {
+	if Latest() != config.SchemaVersion {
+		t.Fatalf("Latest() = %d, config.SchemaVersion = %d", Latest(), config.SchemaVersion)
+	}
+	for i := 1; i < len(Steps); i++ {
+		if Steps[i].Version != Steps[i-1].Version+1 {
+			t.Errorf("step %s has version %d after %d", Steps[i].Name, Steps[i].Version, Steps[i-1].Version)
+		}
+	}
+}
+
+func TestRun_UpgradesLegacyRegistry(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("use_gh_autoprofile old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "gone")
+
+	registry := &config.PinRegistry{Pins: []config.Pin{
+		{User: "alice", Dir: dir},
+		{User: "bob", Dir: missing, Mode: config.ModeExport},
+	}}
+	if err := config.SavePins(registry); err != nil {
+		t.Fatal(err)
+	}
+	pinsPath, _ := config.PinsFilePath()
+	if err := os.Chmod(pinsPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outcomes, err := Run(registry, plan.Disk, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(outcomes) != len(Steps) {
+		t.Fatalf("applied %d steps, want %d", len(outcomes), len(Steps))
+	}
+	if registry.Version != config.SchemaVersion {
+		t.Errorf("Version = %d, want %d", registry.Version, config.SchemaVersion)
+	}
+	if registry.Pins[0].Mode != config.ModeWrapper {
+		t.Errorf("Mode = %q, want wrapper", registry.Pins[0].Mode)
+	}
+	if outcomes[0].Result.Changed != 1 {
+		t.Errorf("pin-modes changed %d, want 1", outcomes[0].Result.Changed)
+	}
+	if fi, _ := os.Stat(pinsPath); fi.Mode().Perm() != 0600 {
+		t.Errorf("pins.yml is %04o, want 0600", fi.Mode().Perm())
+	}
+	if current, err := direnvlib.BlockCurrent(registry.Pins[0]); err != nil || !current {
+		t.Errorf("BlockCurrent = %v, %v; want true", current, err)
+	}
+	envrc := outcomes[2].Result
+	if envrc.Changed != 1 || len(envrc.Warnings) != 1 {
+		t.Errorf("envrc-blocks = %+v, want 1 changed and 1 warning for the missing dir", envrc)
+	}
+
+	if pending := Pending(registry); len(pending) != 0 {
+		t.Errorf("Pending after Run = %d steps, want 0", len(pending))
+	}
+}
+
+func TestPending_DetectsDriftInRecordedSteps(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeExport}
+	registry := &config.PinRegistry{Version: config.SchemaVersion, Pins: []config.Pin{pin}}
+	if err := direnvlib.WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatal(err)
+	}
+	if pending := Pending(registry); len(pending) != 0 {
+		t.Fatalf("Pending = %d steps, want 0", len(pending))
+	}
+
+	if err := os.Chmod(filepath.Join(dir, ".envrc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pending := Pending(registry)
+	if len(pending) != 1 || pending[0].Name != "envrc-permissions" {
+		t.Fatalf("Pending = %+v, want only envrc-permissions", pending)
+	}
+	if st := Check(registry)[4]; len(st.Findings) != 1 {
+		t.Errorf("Findings = %v, want 1", st.Findings)
+	}
+}
+
+func TestRun_PlanLeavesDiskUntouched(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	envrc := filepath.Join(dir, ".envrc")
+	if err := os.WriteFile(envrc, []byte("use_gh_autoprofile old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry := &config.PinRegistry{Pins: []config.Pin{{User: "alice", Dir: dir}}}
+
+	p := plan.New()
+	if _, err := Run(registry, p, nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if data, _ := os.ReadFile(envrc); string(data) != "use_gh_autoprofile old\n" {
+		t.Errorf(".envrc changed on disk: %q", data)
+	}
+	if files := p.Files(); len(files) != 1 || files[0] != envrc {
+		t.Errorf("planned files = %v, want %s", files, envrc)
+	}
+}
+
+func TestCheck_EnvrcPermissionPolicy(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeWrapper}
+	if err := direnvlib.WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, ".envrc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy   config.PermissionPolicy
+		findings int
+	}{
+		{"", 0},
+		{config.PermPreserve, 0},
+		{config.PermStrict, 1},
+		{"bogus", 1},
+	}
+	for _, tt := range tests {
+		registry := &config.PinRegistry{Version: config.SchemaVersion, EnvrcPermissions: tt.policy, Pins: []config.Pin{pin}}
+		if got := len(detectEnvrcPermissions(registry)); got != tt.findings {
+			t.Errorf("policy %q: %d findings, want %d", tt.policy, got, tt.findings)
+		}
+	}
+}
+
+func TestPending_EnvrcPlacementStep(t *testing.T) {
+	setup(t)
+	dir := t.TempDir()
+	pin := config.Pin{User: "alice", Dir: dir, Mode: config.ModeExport}
+	if err := direnvlib.WriteEnvrc(pin, config.PermAuto); err != nil {
+		t.Fatal(err)
+	}
+	envrc := filepath.Join(dir, ".envrc")
+	data, err := os.ReadFile(envrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(envrc, append(data, "use flake\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A registry from before the placement step only has that step to run.
+	registry := &config.PinRegistry{Version: 5, Pins: []config.Pin{pin}}
+	pending := Pending(registry)
+	if len(pending) != 1 || pending[0].Name != "envrc-placement" {
+		t.Fatalf("Pending = %+v, want only envrc-placement", pending)
+	}
+	outcomes, err := Run(registry, plan.Disk, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(outcomes) != 1 || outcomes[0].Result.Changed != 1 {
+		t.Fatalf("outcomes = %+v, want envrc-placement with 1 change", outcomes)
+	}
+	if registry.Version != config.SchemaVersion {
+		t.Errorf("Version = %d, want %d", registry.Version, config.SchemaVersion)
+	}
+	if current, err := direnvlib.BlockCurrent(pin); err != nil || !current {
+		t.Errorf("BlockCurrent = %v, %v; want true after moving the block", current, err)
+	}
+}
+
+func TestRun_GuardMovesOrRejectsBlocks(t *testing.T) {
+	setup(t)
+	moved, rejected := t.TempDir(), t.TempDir()
+	for _, dir := range []string{moved, rejected} {
+		if err := os.WriteFile(filepath.Join(dir, ".envrc"), []byte("use_gh_autoprofile old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := &config.PinRegistry{Version: 2, Pins: []config.Pin{
+		{User: "alice", Dir: moved, Mode: config.ModeWrapper},
+		{User: "bob", Dir: rejected, Mode: config.ModeWrapper},
+	}}
+	guard := func(pin config.Pin, x plan.Executor) (config.Pin, error) {
+		if pin.Dir == rejected {
+			return pin, os.ErrPermission
+		}
+		pin.EnvrcFile = ".envrc.local"
+		return pin, nil
+	}
+
+	outcomes, err := Run(registry, plan.Disk, guard)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	warnings := 0
+	for _, o := range outcomes {
+		warnings += len(o.Result.Warnings)
+	}
+	if warnings == 0 {
+		t.Error("expected a warning for the rejected pin")
+	}
+	if registry.Pins[0].EnvrcFile != ".envrc.local" {
+		t.Errorf("EnvrcFile = %q, want the guard's .envrc.local", registry.Pins[0].EnvrcFile)
+	}
+	if current, err := direnvlib.BlockCurrent(registry.Pins[0]); err != nil || !current {
+		t.Errorf("BlockCurrent = %v, %v; want the block in .envrc.local", current, err)
+	}
+	data, err := os.ReadFile(filepath.Join(rejected, ".envrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "use_gh_autoprofile old\n" {
+		t.Errorf("rejected .envrc changed:\n%s", data)
+	}
+}
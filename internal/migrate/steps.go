@@ -0,0 +1,325 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	direnvlib "github.com/mdiloreto/gh-autoprofile/internal/direnv"
+	"github.com/mdiloreto/gh-autoprofile/internal/plan"
+)
+
+// Steps lists every migration in version order. A change to what pins.yml
+// or the managed files must look like gets a new step: append it with the
+// next version and bump config.SchemaVersion to match.
+var Steps = []Step{
+	{
+		Version:  1,
+		Name:     "pin-modes",
+		Describe: "backfill missing pin modes (default: wrapper)",
+		Healthy:  "pin modes normalized",
+		Detect:   detectPinModes,
+		Apply:    applyPinModes,
+	},
+	{
+		Version:  2,
+		Name:     "config-permissions",
+		Describe: "restrict the config directory to 0700 and pins.yml to 0600",
+		Healthy:  "config directory 0700, pins.yml 0600",
+		Detect:   detectConfigPermissions,
+		Apply:    applyConfigPermissions,
+	},
+	{
+		Version:  3,
+		Name:     "envrc-blocks",
+		Describe: "rewrite missing or outdated managed .envrc blocks and re-allow them",
+		Healthy:  "managed .envrc blocks current",
+		Detect:   detectEnvrcBlocks,
+		Apply:    applyEnvrcBlocks,
+	},
+	{
+		Version:  4,
+		Name:     "envrc-markers",
+		Describe: "repair duplicate or unbalanced managed .envrc block markers",
+		Healthy:  "managed .envrc block markers well-formed",
+		Detect:   detectEnvrcMarkers,
+		Apply:    applyEnvrcMarkers,
+	},
+	{
+		Version:  5,
+		Name:     "envrc-permissions",
+		Describe: "set .envrc permissions from the envrc_permissions policy",
+		Healthy:  "managed .envrc files permitted by envrc_permissions",
+		Detect:   detectEnvrcPermissions,
+		Apply:    applyEnvrcPermissions,
+	},
+	{
+		Version:  6,
+		Name:     "envrc-placement",
+		Describe: "move managed .envrc blocks below devshell lines (use flake, use nix, ...)",
+		Healthy:  "managed .envrc blocks placed after devshell lines",
+		Detect:   detectEnvrcPlacement,
+		Apply:    applyEnvrcPlacement,
+	},
+}
+
+func detectPinModes(registry *config.PinRegistry) []string {
+	var findings []string
+	for _, pin := range registry.Pins {
+		if pin.Mode == "" {
+			findings = append(findings, fmt.Sprintf("%s: no mode (will default to wrapper)", pin.Dir))
+		}
+	}
+	return findings
+}
+
+func applyPinModes(registry *config.PinRegistry, x plan.Executor, guard Guard) (Result, error) {
+	var res Result
+	for i := range registry.Pins {
+		if registry.Pins[i].Mode == "" {
+			registry.Pins[i].Mode = config.ModeWrapper
+			res.Changed++
+		}
+	}
+	return res, nil
+}
+
+// configFiles returns the config directory and pins.yml with the
+// permissions each should have.
+func configFiles() (map[string]os.FileMode, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	pinsPath, err := config.PinsFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]os.FileMode{dir: 0700, pinsPath: 0600}, nil
+}
+
+func detectConfigPermissions(registry *config.PinRegistry) []string {
+	files, err := configFiles()
+	if err != nil {
+		return nil
+	}
+	var findings []string
+	for _, path := range sortedKeys(files) {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().Perm() != files[path] {
+			findings = append(findings, fmt.Sprintf("%s is %04o, want %04o", path, fi.Mode().Perm(), files[path]))
+		}
+	}
+	return findings
+}
+
+func applyConfigPermissions(registry *config.PinRegistry, x plan.Executor, guard Guard) (Result, error) {
+	var res Result
+	files, err := configFiles()
+	if err != nil {
+		return res, err
+	}
+	for _, path := range sortedKeys(files) {
+		fi, err := os.Stat(path)
+		if err != nil || fi.Mode().Perm() == files[path] {
+			continue
+		}
+		if err := x.Chmod(path, files[path]); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("cannot chmod %s: %v", path, err))
+			continue
+		}
+		res.Changed++
+	}
+	return res, nil
+}
+
+// envrcCheck reports why the managed block of pin needs a step, or ""
+// when it does not. Pins whose directory is missing are skipped. Each
+// check leaves the problems of the other steps to them.
+type envrcCheck func(pin config.Pin, policy config.PermissionPolicy) string
+
+func malformedEnvrc(pin config.Pin, policy config.PermissionPolicy) string {
+	if _, err := os.Stat(pin.Dir); err != nil {
+		return ""
+	}
+	problems, err := direnvlib.CheckEnvrc(pin)
+	if err != nil || len(problems) == 0 {
+		return ""
+	}
+	msgs := make([]string, len(problems))
+	for i, p := range problems {
+		msgs[i] = p.Error()
+	}
+	return "malformed managed block (" + strings.Join(msgs, "; ") + ")"
+}
+
+func shadowedEnvrc(pin config.Pin, policy config.PermissionPolicy) string {
+	if _, err := os.Stat(pin.Dir); err != nil {
+		return ""
+	}
+	if malformedEnvrc(pin, policy) != "" {
+		return ""
+	}
+	if _, line, err := direnvlib.ShadowedBlock(pin); err == nil && line != "" {
+		return fmt.Sprintf("managed block runs before `%s`, which could override it", line)
+	}
+	return ""
+}
+
+func staleEnvrc(pin config.Pin, policy config.PermissionPolicy) string {
+	if _, err := os.Stat(pin.Dir); err != nil {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(pin.Dir, pin.EnvrcName())); err != nil {
+		return "managed block missing"
+	}
+	// BlockCurrent is false for malformed and shadowed blocks too.
+	if malformedEnvrc(pin, policy) != "" || shadowedEnvrc(pin, policy) != "" {
+		return ""
+	}
+	if current, err := direnvlib.BlockCurrent(pin); err != nil || !current {
+		return "managed block outdated"
+	}
+	return ""
+}
+
+func loosePermissions(pin config.Pin, policy config.PermissionPolicy) string {
+	fi, err := os.Stat(filepath.Join(pin.Dir, pin.EnvrcName()))
+	if err != nil {
+		return ""
+	}
+	if want := policy.EnvrcPerm(pin.EffectiveMode(), fi.Mode().Perm(), true); fi.Mode().Perm() != want {
+		return fmt.Sprintf("permissions %04o, want %04o (envrc_permissions: %s)", fi.Mode().Perm(), want, policy)
+	}
+	return ""
+}
+
+// detectEnvrc returns a finding for each pin check reports.
+func detectEnvrc(registry *config.PinRegistry, check envrcCheck) []string {
+	// The native backend writes no .envrc files.
+	if registry.Native() {
+		return nil
+	}
+	var findings []string
+	for _, pin := range registry.Pins {
+		if reason := check(pin, registry.PermissionPolicy()); reason != "" {
+			findings = append(findings, fmt.Sprintf("%s: %s", filepath.Join(pin.Dir, pin.EnvrcName()), reason))
+		}
+	}
+	return findings
+}
+
+// repairEnvrc rewrites the managed block of each pin check reports and
+// re-allows it. Each pin goes through guard first; when it moves the block
+// to another file, the old block is removed and the pin updated.
+func repairEnvrc(registry *config.PinRegistry, x plan.Executor, guard Guard, check envrcCheck) (Result, error) {
+	var res Result
+	if registry.Native() {
+		return res, nil
+	}
+	policy := registry.PermissionPolicy()
+	for i, pin := range registry.Pins {
+		if check(pin, policy) == "" {
+			continue
+		}
+		if guard != nil {
+			guarded, err := guard(pin, x)
+			if err != nil {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("%s: %v", pin.Dir, err))
+				continue
+			}
+			if guarded.EnvrcName() != pin.EnvrcName() {
+				if err := direnvlib.RemoveEnvrcWith(x, pin, policy); err != nil {
+					res.Warnings = append(res.Warnings, fmt.Sprintf("%s: %v", pin.Dir, err))
+					continue
+				}
+				registry.Pins[i] = guarded
+			}
+			pin = guarded
+		}
+		if err := direnvlib.RepairEnvrcWith(x, pin, policy); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s: %v", pin.Dir, err))
+			continue
+		}
+		res.Changed++
+		if direnvlib.IsInstalled() {
+			if err := direnvlib.AllowEnvrcWith(x, pin.Dir); err != nil {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("%s: %v", pin.Dir, err))
+			}
+		}
+	}
+	return res, nil
+}
+
+func detectEnvrcBlocks(registry *config.PinRegistry) []string {
+	return detectEnvrc(registry, staleEnvrc)
+}
+
+func applyEnvrcBlocks(registry *config.PinRegistry, x plan.Executor, guard Guard) (Result, error) {
+	res, err := repairEnvrc(registry, x, guard, staleEnvrc)
+	if err != nil || registry.Native() {
+		return res, err
+	}
+	for _, pin := range registry.Pins {
+		if _, err := os.Stat(pin.Dir); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s: directory missing", pin.Dir))
+		}
+	}
+	return res, nil
+}
+
+func detectEnvrcMarkers(registry *config.PinRegistry) []string {
+	return detectEnvrc(registry, malformedEnvrc)
+}
+
+func applyEnvrcMarkers(registry *config.PinRegistry, x plan.Executor, guard Guard) (Result, error) {
+	return repairEnvrc(registry, x, guard, malformedEnvrc)
+}
+
+func detectEnvrcPermissions(registry *config.PinRegistry) []string {
+	return detectEnvrc(registry, loosePermissions)
+}
+
+func applyEnvrcPermissions(registry *config.PinRegistry, x plan.Executor, guard Guard) (Result, error) {
+	var res Result
+	if registry.Native() {
+		return res, nil
+	}
+	policy := registry.PermissionPolicy()
+	for _, pin := range registry.Pins {
+		path := filepath.Join(pin.Dir, pin.EnvrcName())
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		want := policy.EnvrcPerm(pin.EffectiveMode(), fi.Mode().Perm(), true)
+		if fi.Mode().Perm() == want {
+			continue
+		}
+		if err := x.Chmod(path, want); err != nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("cannot chmod %s: %v", path, err))
+			continue
+		}
+		res.Changed++
+	}
+	return res, nil
+}
+
+func detectEnvrcPlacement(registry *config.PinRegistry) []string {
+	return detectEnvrc(registry, shadowedEnvrc)
+}
+
+func applyEnvrcPlacement(registry *config.PinRegistry, x plan.Executor, guard Guard) (Result, error) {
+	return repairEnvrc(registry, x, guard, shadowedEnvrc)
+}
+
+func sortedKeys(m map[string]os.FileMode) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
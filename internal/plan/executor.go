@@ -0,0 +1,67 @@
+// Package plan lets commands describe their side effects once and either
+// perform them or, for --dry-run, record them as a reviewable plan.
+package plan
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+)
+
+// Executor performs file changes and external commands. ReadFile and Stat
+// see the files as the executor's earlier changes left them.
+type Executor interface {
+	ReadFile(path string) ([]byte, error)
+	Stat(path string) (os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	Remove(path string) error
+	Chmod(path string, perm os.FileMode) error
+	// Run executes name with args in dir.
+	Run(dir, name string, args ...string) error
+}
+
+// Disk is the Executor that changes the file system and runs commands.
+var Disk Executor = disk{}
+
+type disk struct{}
+
+func (disk) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (disk) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (disk) MkdirAll(path string, perm os.FileMode) error {
+	if err := os.MkdirAll(path, perm); err != nil {
+		return fmt.Errorf("cannot create directory %s: %w", path, err)
+	}
+	return nil
+}
+
+func (disk) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return fsutil.WriteFileAtomic(path, data, perm)
+}
+
+func (disk) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (disk) Chmod(path string, perm os.FileMode) error {
+	return os.Chmod(path, perm)
+}
+
+func (disk) Run(dir, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %s: %w", name, strings.Join(args, " "), strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Plan is an Executor that records what would change instead of changing
+// it. The diff is relative to the files on disk, but ReadFile and Stat
+// return the planned state, so changes chained on one file build on each
+// other as they would when performed.
+type Plan struct {
+	order    []string
+	files    map[string]*fileChange
+	dirs     map[string]bool
+	commands []string
+}
+
+type fileChange struct {
+	oldExists, newExists bool
+	oldData, newData     string
+	oldMode, newMode     os.FileMode
+}
+
+// New returns an empty plan.
+func New() *Plan {
+	return &Plan{files: map[string]*fileChange{}, dirs: map[string]bool{}}
+}
+
+// ReadFile returns the planned content of path, or the file on disk when
+// the plan does not change it.
+func (p *Plan) ReadFile(path string) ([]byte, error) {
+	if c, ok := p.files[path]; ok {
+		if !c.newExists {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		}
+		return []byte(c.newData), nil
+	}
+	return os.ReadFile(path)
+}
+
+// Stat describes path as the plan would leave it.
+func (p *Plan) Stat(path string) (os.FileInfo, error) {
+	if c, ok := p.files[path]; ok {
+		if !c.newExists {
+			return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+		}
+		return plannedInfo{name: filepath.Base(path), size: int64(len(c.newData)), mode: c.newMode}, nil
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) && p.dirs[filepath.Clean(path)] {
+		return plannedInfo{name: filepath.Base(path), mode: fs.ModeDir | 0755}, nil
+	}
+	return fi, err
+}
+
+// plannedInfo is the os.FileInfo of a file or directory the plan creates
+// or changes.
+type plannedInfo struct {
+	name string
+	size int64
+	mode os.FileMode
+}
+
+func (i plannedInfo) Name() string       { return i.name }
+func (i plannedInfo) Size() int64        { return i.size }
+func (i plannedInfo) Mode() os.FileMode  { return i.mode }
+func (i plannedInfo) ModTime() time.Time { return time.Time{} }
+func (i plannedInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i plannedInfo) Sys() any           { return nil }
+
+// change returns the recorded change for path, seeding it from disk.
+func (p *Plan) change(path string) *fileChange {
+	if c, ok := p.files[path]; ok {
+		return c
+	}
+	c := &fileChange{}
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+		c.oldExists = true
+		c.oldMode = fi.Mode().Perm()
+		if data, err := os.ReadFile(path); err == nil {
+			c.oldData = string(data)
+		}
+	}
+	c.newExists, c.newData, c.newMode = c.oldExists, c.oldData, c.oldMode
+	p.files[path] = c
+	p.order = append(p.order, path)
+	return c
+}
+
+// MkdirAll records a directory creation when path does not exist yet.
+func (p *Plan) MkdirAll(path string, perm os.FileMode) error {
+	if _, err := p.Stat(path); os.IsNotExist(err) {
+		p.commands = append(p.commands, fmt.Sprintf("mkdir -p -m %04o %s", perm, path))
+		for dir := filepath.Clean(path); !p.dirs[dir]; dir = filepath.Dir(dir) {
+			p.dirs[dir] = true
+		}
+	}
+	return nil
+}
+
+// WriteFile records the new content of path.
+func (p *Plan) WriteFile(path string, data []byte, perm os.FileMode) error {
+	c := p.change(path)
+	c.newExists, c.newData, c.newMode = true, string(data), perm
+	return nil
+}
+
+// Remove records the deletion of path.
+func (p *Plan) Remove(path string) error {
+	c := p.change(path)
+	c.newExists, c.newData = false, ""
+	return nil
+}
+
+// Chmod records a permission change of path.
+func (p *Plan) Chmod(path string, perm os.FileMode) error {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		if fi.Mode().Perm() != perm {
+			p.commands = append(p.commands, fmt.Sprintf("chmod %04o %s", perm, path))
+		}
+		return nil
+	}
+	p.change(path).newMode = perm
+	return nil
+}
+
+// Run records a command.
+func (p *Plan) Run(dir, name string, args ...string) error {
+	p.commands = append(p.commands, strings.Join(append([]string{name}, args...), " "))
+	return nil
+}
+
+// Empty reports whether the plan changes nothing.
+func (p *Plan) Empty() bool {
+	return len(p.Files()) == 0 && len(p.commands) == 0
+}
+
+// Files returns the paths the plan would change, in the order they were
+// first touched.
+func (p *Plan) Files() []string {
+	var paths []string
+	for _, path := range p.order {
+		c := p.files[path]
+		if c.oldExists != c.newExists || c.oldData != c.newData || (c.newExists && c.oldMode != c.newMode) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Print writes a unified diff of every changed file followed by the
+// commands that would run.
+func (p *Plan) Print(w io.Writer) {
+	if p.Empty() {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+	for _, path := range p.Files() {
+		c := p.files[path]
+		oldName, newName := "a"+path, "b"+path
+		fmt.Fprintf(w, "diff %s %s\n", oldName, newName)
+		switch {
+		case !c.oldExists:
+			oldName = "/dev/null"
+			fmt.Fprintf(w, "new file mode %04o\n", c.newMode)
+		case !c.newExists:
+			newName = "/dev/null"
+			fmt.Fprintln(w, "deleted file")
+		case c.oldMode != c.newMode:
+			fmt.Fprintf(w, "old mode %04o\nnew mode %04o\n", c.oldMode, c.newMode)
+		}
+		if c.oldData != c.newData {
+			fmt.Fprint(w, Unified(oldName, newName, c.oldData, c.newData))
+		} else {
+			fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+		}
+	}
+	if len(p.commands) > 0 {
+		fmt.Fprintln(w, "\nWould run:")
+		for _, c := range p.commands {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+	}
+}
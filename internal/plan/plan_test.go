@@ -0,0 +1,137 @@
+package plan
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "x\n", "x\n", ""},
+		{
+			name: "append to empty",
+			a:    "",
+			b:    "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "replace middle line with context",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			name: "missing final newline",
+			a:    "a\n",
+			b:    "a\nb",
+			want: "--- old\n+++ new\n@@ -1 +1,2 @@\n a\n+b\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.a, tt.b); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan_RecordsWithoutTouchingDisk(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existing, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "created")
+	unchanged := filepath.Join(dir, "unchanged")
+	if err := os.WriteFile(unchanged, []byte("same\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New()
+	var x Executor = p
+	_ = x.WriteFile(existing, []byte("new\n"), 0600)
+	_ = x.WriteFile(created, []byte("hello\n"), 0600)
+	_ = x.WriteFile(unchanged, []byte("same\n"), 0600)
+	_ = x.Run(dir, "direnv", "allow", existing)
+
+	if data, _ := os.ReadFile(existing); string(data) != "old\n" {
+		t.Errorf("existing file changed on disk: %q", data)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("created file exists on disk")
+	}
+	if files := p.Files(); len(files) != 2 {
+		t.Errorf("Files() = %v, want existing and created only", files)
+	}
+
+	var out bytes.Buffer
+	p.Print(&out)
+	for _, want := range []string{
+		"old mode 0644\nnew mode 0600\n",
+		"-old\n+new\n",
+		"new file mode 0600\n--- /dev/null\n",
+		"Would run:\n  direnv allow " + existing,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestPlan_Empty(t *testing.T) {
+	p := New()
+	var out bytes.Buffer
+	p.Print(&out)
+	if !p.Empty() || out.String() != "No changes.\n" {
+		t.Errorf("empty plan printed %q", out.String())
+	}
+}
+
+func TestPlan_ReadsPlannedState(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existing, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "sub", "created")
+
+	p := New()
+	_ = p.MkdirAll(filepath.Dir(created), 0755)
+	_ = p.WriteFile(created, []byte("hello\n"), 0600)
+	_ = p.Remove(existing)
+
+	if data, err := p.ReadFile(created); err != nil || string(data) != "hello\n" {
+		t.Errorf("ReadFile(created) = %q, %v; want the planned content", data, err)
+	}
+	if fi, err := p.Stat(created); err != nil || fi.Mode().Perm() != 0600 || fi.Size() != 6 {
+		t.Errorf("Stat(created) = %v, %v; want a planned 0600 file", fi, err)
+	}
+	if fi, err := p.Stat(filepath.Dir(created)); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(sub) = %v, %v; want a planned directory", fi, err)
+	}
+	if _, err := p.ReadFile(existing); !os.IsNotExist(err) {
+		t.Errorf("ReadFile(existing) = %v; want not exist after the planned removal", err)
+	}
+
+	// Writing again after the removal is diffed against the disk.
+	_ = p.WriteFile(existing, []byte("new\n"), 0600)
+	var out bytes.Buffer
+	p.Print(&out)
+	if !strings.Contains(out.String(), "old mode 0644\nnew mode 0600\n") || !strings.Contains(out.String(), "-old\n+new\n") {
+		t.Errorf("unexpected diff after remove and write:\n%s", out.String())
+	}
+}
@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the team policy file committed to a repository.
+const FileName = ".gh-autoprofile.yml"
+
+// Policy declares the requirements a repository places on whatever local
+// account a developer pins to it.
+type Policy struct {
+	// Host is the GitHub host the account must belong to.
+	Host string `yaml:"host,omitempty"`
+
+	// AllowedOrgs lists organisations of which the account must be a
+	// declared member (via `pin --org`).
+	AllowedOrgs []string `yaml:"allowed_orgs,omitempty"`
+
+	// EmailDomain is the domain the pinned git email must belong to.
+	EmailDomain string `yaml:"email_domain,omitempty"`
+
+	// Path is the file the policy was loaded from.
+	Path string `yaml:"-"`
+}
+
+// Violation describes one policy requirement a pin does not meet.
+type Violation struct {
+	Field   string
+	Message string
+}
+
+// Find looks for a policy file in dir and its parents. Returns nil with no
+// error when there is none.
+func Find(dir string) (*Policy, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(absDir, FileName)
+		if _, err := os.Stat(path); err == nil {
+			return Load(path)
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return nil, nil
+		}
+		absDir = parent
+	}
+}
+
+// Load reads a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %w", err)
+	}
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse policy file %s: %w", path, err)
+	}
+	p.Path = path
+	p.EmailDomain = strings.TrimPrefix(p.EmailDomain, "@")
+	return &p, nil
+}
+
+// Check returns the requirements pin does not satisfy.
+func (p *Policy) Check(pin config.Pin) []Violation {
+	var violations []Violation
+
+	if p.Host != "" && !strings.EqualFold(p.Host, pin.EffectiveHost()) {
+		violations = append(violations, Violation{
+			Field:   "host",
+			Message: fmt.Sprintf("account '%s' is on %s, policy requires %s", pin.User, pin.EffectiveHost(), p.Host),
+		})
+	}
+
+	if len(p.AllowedOrgs) > 0 && !p.orgAllowed(pin) {
+		violations = append(violations, Violation{
+			Field:   "allowed_orgs",
+			Message: fmt.Sprintf("account '%s' is not declared a member of %s", pin.User, strings.Join(p.AllowedOrgs, " or ")),
+		})
+	}
+
+	if p.EmailDomain != "" {
+		_, domain, _ := strings.Cut(pin.GitEmail, "@")
+		if !strings.EqualFold(domain, p.EmailDomain) {
+			email := pin.GitEmail
+			if email == "" {
+				email = "(none)"
+			}
+			violations = append(violations, Violation{
+				Field:   "email_domain",
+				Message: fmt.Sprintf("git email %s is not an @%s address", email, p.EmailDomain),
+			})
+		}
+	}
+
+	return violations
+}
+
+// Suggest returns a `gh autoprofile pin` command line that would satisfy
+// the policy for dir, keeping the settings of pin where they comply.
+func (p *Policy) Suggest(pin config.Pin, dir string) string {
+	args := []string{"gh autoprofile pin", pin.User, "--dir", dir}
+	if p.Host != "" {
+		args = append(args, "--host", p.Host)
+	}
+	if len(p.AllowedOrgs) > 0 {
+		if p.orgAllowed(pin) {
+			for _, org := range pin.Orgs {
+				args = append(args, "--org", org)
+			}
+		} else {
+			args = append(args, "--org", p.AllowedOrgs[0])
+		}
+	}
+	if p.EmailDomain != "" {
+		email := pin.GitEmail
+		if _, domain, _ := strings.Cut(email, "@"); !strings.EqualFold(domain, p.EmailDomain) {
+			email = "<you>@" + p.EmailDomain
+		}
+		args = append(args, "--git-email", email)
+	}
+	return strings.Join(args, " ")
+}
+
+func (p *Policy) orgAllowed(pin config.Pin) bool {
+	for _, allowed := range p.AllowedOrgs {
+		if strings.EqualFold(allowed, pin.User) {
+			return true
+		}
+		for _, org := range pin.Orgs {
+			if strings.EqualFold(allowed, org) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func writePolicy(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write policy: %v", err)
+	}
+	return path
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "services", "api")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("cannot create dirs: %v", err)
+	}
+
+	p, err := Find(sub)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if p != nil {
+		t.Fatalf("expected no policy, got %+v", p)
+	}
+
+	path := writePolicy(t, root, "host: github.com\nallowed_orgs: [acme]\nemail_domain: \"@acme.com\"\n")
+	p, err = Find(sub)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if p == nil || p.Path != path {
+		t.Fatalf("expected policy from %s, got %+v", path, p)
+	}
+	if p.EmailDomain != "acme.com" {
+		t.Errorf("expected leading @ to be stripped, got %q", p.EmailDomain)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := writePolicy(t, t.TempDir(), "allowed_orgs: {broken\n")
+	if _, err := Load(path); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := &Policy{Host: "github.com", AllowedOrgs: []string{"acme"}, EmailDomain: "acme.com"}
+
+	tests := []struct {
+		name   string
+		pin    config.Pin
+		fields []string
+	}{
+		{"compliant", config.Pin{User: "bob", Orgs: []string{"ACME"}, GitEmail: "bob@acme.com"}, nil},
+		{"org account itself", config.Pin{User: "acme", GitEmail: "bot@acme.com"}, nil},
+		{"wrong host", config.Pin{User: "bob", Host: "ghe.other.com", Orgs: []string{"acme"}, GitEmail: "bob@acme.com"}, []string{"host"}},
+		{"no org", config.Pin{User: "bob", GitEmail: "bob@acme.com"}, []string{"allowed_orgs"}},
+		{"personal email", config.Pin{User: "bob", Orgs: []string{"acme"}, GitEmail: "bob@gmail.com"}, []string{"email_domain"}},
+		{"no email", config.Pin{User: "bob", Orgs: []string{"acme"}}, []string{"email_domain"}},
+		{"subdomain is not the domain", config.Pin{User: "bob", Orgs: []string{"acme"}, GitEmail: "bob@eu.acme.com"}, []string{"email_domain"}},
+		{"everything wrong", config.Pin{User: "bob", Host: "x.com"}, []string{"host", "allowed_orgs", "email_domain"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := p.Check(tt.pin)
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Field)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("violations = %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCheck_EmptyPolicy(t *testing.T) {
+	if v := (&Policy{}).Check(config.Pin{User: "anyone"}); len(v) != 0 {
+		t.Errorf("empty policy should accept any pin, got %v", v)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	p := &Policy{Host: "github.com", AllowedOrgs: []string{"acme"}, EmailDomain: "acme.com"}
+
+	got := p.Suggest(config.Pin{User: "bob", GitEmail: "bob@gmail.com"}, "/src/mono")
+	want := "gh autoprofile pin bob --dir /src/mono --host github.com --org acme --git-email <you>@acme.com"
+	if got != want {
+		t.Errorf("Suggest = %q, want %q", got, want)
+	}
+
+	got = p.Suggest(config.Pin{User: "bob", Orgs: []string{"acme", "acme-labs"}, GitEmail: "bob@acme.com"}, "/src/mono")
+	want = "gh autoprofile pin bob --dir /src/mono --host github.com --org acme --org acme-labs --git-email bob@acme.com"
+	if got != want {
+		t.Errorf("Suggest = %q, want %q", got, want)
+	}
+}
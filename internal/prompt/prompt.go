@@ -0,0 +1,117 @@
+// Package prompt renders the prompt segment showing the active account.
+// It reads only the environment and the pin registry, so it is cheap
+// enough to run on every prompt: no gh invocations and no network.
+package prompt
+
+import (
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+// State is what the prompt segment reports.
+type State int
+
+const (
+	// Inactive means no account is active and none is pinned.
+	Inactive State = iota
+	// Wrapper means the pinned account is active in wrapper mode.
+	Wrapper
+	// Export means the pinned account is active with its token exported.
+	Export
+	// Mismatch means the active account or mode differs from the pin
+	// covering the directory: direnv did not load (or blocked) the
+	// .envrc, another account was exported, or an account is active
+	// outside any pinned directory.
+	Mismatch
+)
+
+func (s State) String() string {
+	switch s {
+	case Wrapper:
+		return "wrapper"
+	case Export:
+		return "export"
+	case Mismatch:
+		return "mismatch"
+	}
+	return "inactive"
+}
+
+// Default formats of the segment. {user} is the active account ("-" when
+// none), {mode} wrapper or export, {pinned} the pinned account ("-" when
+// none) and {state} the State.
+const (
+	DefaultFormat         = "gh:{user}({mode})"
+	DefaultMismatchFormat = "gh:{user}!={pinned}"
+)
+
+// Info describes the account situation of a directory.
+type Info struct {
+	State State
+	// User is the active account (GH_AUTOPROFILE_USER).
+	User string
+	// Mode is the active token mode: export when GH_TOKEN is set.
+	Mode config.PinMode
+	// Pinned is the account pinned to the directory, if any.
+	Pinned string
+}
+
+// Detect compares the environment, read through getenv, with pin, the pin
+// covering the directory (nil when none does).
+func Detect(getenv func(string) string, pin *config.Pin) Info {
+	info := Info{User: getenv("GH_AUTOPROFILE_USER"), Mode: config.ModeWrapper}
+	if getenv("GH_TOKEN") != "" {
+		info.Mode = config.ModeExport
+	}
+	if pin != nil {
+		info.Pinned = pin.User
+	}
+
+	switch {
+	case info.User == "" && pin == nil:
+		info.State = Inactive
+	case pin == nil || !strings.EqualFold(info.User, pin.User) || info.Mode != pin.EffectiveMode():
+		info.State = Mismatch
+	case info.Mode == config.ModeExport:
+		info.State = Export
+	default:
+		info.State = Wrapper
+	}
+	return info
+}
+
+// ANSI colours of the states.
+var colors = map[State]string{
+	Wrapper:  "\033[32m",
+	Export:   "\033[33m",
+	Mismatch: "\033[31m",
+}
+
+// Render returns the segment for info: format, or mismatchFormat in the
+// Mismatch state, with its placeholders filled in, and "" when inactive.
+// color wraps it in the state's ANSI colour.
+func (info Info) Render(format, mismatchFormat string, color bool) string {
+	if info.State == Inactive {
+		return ""
+	}
+	if info.State == Mismatch {
+		format = mismatchFormat
+	}
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	out := strings.NewReplacer(
+		"{user}", dash(info.User),
+		"{mode}", string(info.Mode),
+		"{pinned}", dash(info.Pinned),
+		"{state}", info.State.String(),
+	).Replace(format)
+	if color {
+		out = colors[info.State] + out + "\033[0m"
+	}
+	return out
+}
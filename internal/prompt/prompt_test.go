@@ -0,0 +1,49 @@
+package prompt
+
+import (
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func TestDetectAndRender(t *testing.T) {
+	wrapper := &config.Pin{User: "bob-work", Mode: config.ModeWrapper}
+	export := &config.Pin{User: "bob-work", Mode: config.ModeExport}
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		pin   *config.Pin
+		state State
+		out   string
+	}{
+		{"nothing", nil, nil, Inactive, ""},
+		{"wrapper", map[string]string{"GH_AUTOPROFILE_USER": "bob-work"}, wrapper, Wrapper, "gh:bob-work(wrapper)"},
+		{"export", map[string]string{"GH_AUTOPROFILE_USER": "bob-work", "GH_TOKEN": "t"}, export, Export, "gh:bob-work(export)"},
+		{"not loaded", nil, wrapper, Mismatch, "gh:-!=bob-work"},
+		{"other account", map[string]string{"GH_AUTOPROFILE_USER": "alice"}, wrapper, Mismatch, "gh:alice!=bob-work"},
+		{"token in wrapper dir", map[string]string{"GH_AUTOPROFILE_USER": "bob-work", "GH_TOKEN": "t"}, wrapper, Mismatch, "gh:bob-work!=bob-work"},
+		{"outside pins", map[string]string{"GH_AUTOPROFILE_USER": "alice"}, nil, Mismatch, "gh:alice!=-"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info := Detect(func(k string) string { return tc.env[k] }, tc.pin)
+			if info.State != tc.state {
+				t.Errorf("state = %v, want %v", info.State, tc.state)
+			}
+			if got := info.Render(DefaultFormat, DefaultMismatchFormat, false); got != tc.out {
+				t.Errorf("Render = %q, want %q", got, tc.out)
+			}
+		})
+	}
+}
+
+func TestRender_FormatAndColor(t *testing.T) {
+	info := Info{State: Export, User: "bob-work", Mode: config.ModeExport, Pinned: "bob-work"}
+	if got := info.Render("{state}:{user}@{pinned}", "", false); got != "export:bob-work@bob-work" {
+		t.Errorf("Render = %q", got)
+	}
+	if got := info.Render("{user}", "", true); got != "\033[33mbob-work\033[0m" {
+		t.Errorf("coloured Render = %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package repair
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+	"github.com/mdiloreto/gh-autoprofile/internal/fsutil"
+)
+
+// Move re-associates a registry pin whose directory vanished with the
+// directory where its managed .envrc block now lives.
+type Move struct {
+	From config.Pin
+	To   string
+}
+
+// Result is the outcome of matching orphaned blocks with stale pins.
+type Result struct {
+	Moves []Move
+
+	// Unmatched lists orphaned blocks no stale pin fits.
+	Unmatched []config.Pin
+
+	// Ambiguous lists orphaned blocks that fit several stale pins, or
+	// stale pins claimed by several blocks. They are left for `mv`.
+	Ambiguous []config.Pin
+}
+
+// StalePins returns the pins whose directory no longer exists.
+func StalePins(registry *config.PinRegistry) []config.Pin {
+	var stale []config.Pin
+	for _, pin := range registry.Pins {
+		if _, err := os.Stat(pin.Dir); os.IsNotExist(err) {
+			stale = append(stale, pin)
+		}
+	}
+	return stale
+}
+
+// ScanRoots returns the directories to search for moved blocks: the
+// configured roots plus the existing parents of stale pins, since renames
+// usually stay within the same parent.
+func ScanRoots(registry *config.PinRegistry, stale []config.Pin) []string {
+	seen := map[string]bool{}
+	var roots []string
+	add := func(dir string) {
+		if dir == "" || seen[dir] {
+			return
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return
+		}
+		seen[dir] = true
+		roots = append(roots, dir)
+	}
+	for _, root := range registry.Roots {
+		add(fsutil.ExpandHome(root))
+	}
+	for _, pin := range stale {
+		add(filepath.Dir(pin.Dir))
+	}
+	return roots
+}
+
+// Match pairs orphaned blocks (pins read from .envrc files the registry
+// does not know) with stale pins by account and, when the block records
+// one, git email. A block matching several stale pins is resolved in
+// favour of the one that lived in the same parent directory. The block of
+// an indirect pin names no account, so it only matches a stale indirect
+// pin that lived in the same parent directory.
+func Match(stale, orphans []config.Pin) Result {
+	var res Result
+	claimed := map[string][]int{}
+	choice := make([]int, len(orphans))
+
+	for i, orphan := range orphans {
+		var candidates []int
+		for j, pin := range stale {
+			if orphan.Indirect && orphan.User == "" {
+				if !pin.Indirect || filepath.Dir(pin.Dir) != filepath.Dir(orphan.Dir) {
+					continue
+				}
+				candidates = append(candidates, j)
+				continue
+			}
+			if !strings.EqualFold(pin.User, orphan.User) {
+				continue
+			}
+			if orphan.GitEmail != "" && !strings.EqualFold(pin.GitEmail, orphan.GitEmail) {
+				continue
+			}
+			candidates = append(candidates, j)
+		}
+		if len(candidates) > 1 {
+			var sameParent []int
+			for _, j := range candidates {
+				if filepath.Dir(stale[j].Dir) == filepath.Dir(orphan.Dir) {
+					sameParent = append(sameParent, j)
+				}
+			}
+			candidates = sameParent
+			if len(candidates) != 1 {
+				choice[i] = -2
+				continue
+			}
+		}
+		if len(candidates) == 0 {
+			choice[i] = -1
+			continue
+		}
+		choice[i] = candidates[0]
+		claimed[stale[candidates[0]].Dir] = append(claimed[stale[candidates[0]].Dir], i)
+	}
+
+	for i, orphan := range orphans {
+		switch {
+		case choice[i] == -1:
+			res.Unmatched = append(res.Unmatched, orphan)
+		case choice[i] == -2 || len(claimed[stale[choice[i]].Dir]) > 1:
+			res.Ambiguous = append(res.Ambiguous, orphan)
+		default:
+			res.Moves = append(res.Moves, Move{From: stale[choice[i]], To: orphan.Dir})
+		}
+	}
+	return res
+}
@@ -0,0 +1,98 @@
+package repair
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdiloreto/gh-autoprofile/internal/config"
+)
+
+func TestStalePinsAndScanRoots(t *testing.T) {
+	root := t.TempDir()
+	live := filepath.Join(root, "work", "live")
+	if err := os.MkdirAll(live, 0755); err != nil {
+		t.Fatalf("cannot create dirs: %v", err)
+	}
+	registry := &config.PinRegistry{
+		Roots: []string{root, filepath.Join(root, "missing-root")},
+		Pins: []config.Pin{
+			{User: "alice", Dir: live},
+			{User: "bob", Dir: filepath.Join(root, "work", "gone")},
+			{User: "carol", Dir: filepath.Join(root, "vanished", "too")},
+		},
+	}
+
+	stale := StalePins(registry)
+	if len(stale) != 2 || stale[0].User != "bob" || stale[1].User != "carol" {
+		t.Fatalf("StalePins = %+v", stale)
+	}
+
+	roots := ScanRoots(registry, stale)
+	want := []string{root, filepath.Join(root, "work")}
+	if len(roots) != len(want) || roots[0] != want[0] || roots[1] != want[1] {
+		t.Errorf("ScanRoots = %v, want %v", roots, want)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	stale := []config.Pin{
+		{User: "bob-work", Dir: "/w/foo", GitEmail: "bob@acme.com"},
+		{User: "alice", Dir: "/p/notes"},
+		{User: "alice", Dir: "/p/blog"},
+		{User: "alice", Dir: "/q/blog"},
+		{User: "carol", Dir: "/c/one"},
+	}
+	orphans := []config.Pin{
+		{User: "bob-work", Dir: "/w/bar", GitEmail: "bob@acme.com"}, // unique by user and email
+		{User: "alice", Dir: "/p/notes2"},                           // two stale alice pins share its parent
+		{User: "alice", Dir: "/q/blog2"},                            // only one of them lived in /q
+		{User: "bob-work", Dir: "/w/other", GitEmail: "bob@home.org"},
+		{User: "carol", Dir: "/c/two"},
+		{User: "carol", Dir: "/c/three"}, // both claim carol's only stale pin
+	}
+
+	res := Match(stale, orphans)
+
+	if len(res.Moves) != 2 {
+		t.Fatalf("expected 2 moves, got %+v", res.Moves)
+	}
+	if res.Moves[0].From.Dir != "/w/foo" || res.Moves[0].To != "/w/bar" {
+		t.Errorf("unexpected move: %+v", res.Moves[0])
+	}
+	if res.Moves[1].From.Dir != "/q/blog" || res.Moves[1].To != "/q/blog2" {
+		t.Errorf("unexpected move: %+v", res.Moves[1])
+	}
+	if len(res.Unmatched) != 1 || res.Unmatched[0].Dir != "/w/other" {
+		t.Errorf("unexpected unmatched: %+v", res.Unmatched)
+	}
+	if len(res.Ambiguous) != 3 {
+		t.Errorf("expected 3 ambiguous blocks, got %+v", res.Ambiguous)
+	}
+}
+
+func TestMatch_Indirect(t *testing.T) {
+	stale := []config.Pin{
+		{User: "alice", Dir: "/p/notes", Indirect: true},
+		{User: "bob", Dir: "/q/one", Indirect: true},
+		{User: "carol", Dir: "/q/two", Indirect: true},
+		{User: "dave", Dir: "/r/plain"},
+	}
+	orphans := []config.Pin{
+		{Dir: "/p/notes2", Indirect: true}, // the only stale indirect pin in /p
+		{Dir: "/q/three", Indirect: true},  // two stale indirect pins lived in /q
+		{Dir: "/r/plain2", Indirect: true}, // dave's pin was not indirect
+	}
+
+	res := Match(stale, orphans)
+
+	if len(res.Moves) != 1 || res.Moves[0].From.Dir != "/p/notes" || res.Moves[0].To != "/p/notes2" {
+		t.Errorf("unexpected moves: %+v", res.Moves)
+	}
+	if len(res.Ambiguous) != 1 || res.Ambiguous[0].Dir != "/q/three" {
+		t.Errorf("unexpected ambiguous: %+v", res.Ambiguous)
+	}
+	if len(res.Unmatched) != 1 || res.Unmatched[0].Dir != "/r/plain2" {
+		t.Errorf("unexpected unmatched: %+v", res.Unmatched)
+	}
+}
@@ -0,0 +1,89 @@
+package wizard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrAborted is returned when the input ends before a question is answered.
+var ErrAborted = errors.New("aborted")
+
+// Prompter asks numbered-choice and free-text questions on a line-based
+// terminal.
+type Prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewPrompter creates a Prompter reading answers from in and writing
+// questions to out.
+func NewPrompter(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{in: bufio.NewReader(in), out: out}
+}
+
+// IsTerminal reports whether f is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Select shows options numbered from 1 and returns the index of the chosen
+// one. An empty answer selects def. Invalid answers are asked again.
+func (p *Prompter) Select(label string, options []string, def int) (int, error) {
+	fmt.Fprintf(p.out, "%s\n", label)
+	for i, opt := range options {
+		marker := " "
+		if i == def {
+			marker = "*"
+		}
+		fmt.Fprintf(p.out, " %s %d) %s\n", marker, i+1, opt)
+	}
+	for {
+		fmt.Fprintf(p.out, "Choose [%d]: ", def+1)
+		answer, err := p.readLine()
+		if err != nil {
+			return 0, err
+		}
+		if answer == "" {
+			return def, nil
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(p.out, "Enter a number between 1 and %d.\n", len(options))
+	}
+}
+
+// Input asks for a line of text. An empty answer returns def.
+func (p *Prompter) Input(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", label)
+	}
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+func (p *Prompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", ErrAborted
+	}
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,26 @@
+package wizard
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SSHKeys returns the private keys in sshDir, recognised by having a
+// matching .pub file next to them.
+func SSHKeys(sshDir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(sshDir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, pub := range matches {
+		private := strings.TrimSuffix(pub, ".pub")
+		if fi, err := os.Stat(private); err == nil && fi.Mode().IsRegular() {
+			keys = append(keys, private)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
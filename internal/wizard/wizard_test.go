@@ -0,0 +1,75 @@
+package wizard
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{"default", "\n", 1},
+		{"explicit", "3\n", 2},
+		{"retry after invalid", "9\nx\n1\n", 0},
+		{"last line without newline", "3", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := NewPrompter(strings.NewReader(tt.input), &out)
+			got, err := p.Select("Pick one:", []string{"a", "b", "c"}, 1)
+			if err != nil {
+				t.Fatalf("Select failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Select = %d, want %d", got, tt.want)
+			}
+			if !strings.Contains(out.String(), " * 2) b") {
+				t.Errorf("default not marked:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestSelect_Aborted(t *testing.T) {
+	p := NewPrompter(strings.NewReader(""), &bytes.Buffer{})
+	if _, err := p.Select("Pick one:", []string{"a"}, 0); err != ErrAborted {
+		t.Errorf("expected ErrAborted, got %v", err)
+	}
+}
+
+func TestInput(t *testing.T) {
+	p := NewPrompter(strings.NewReader("\n  bob@acme.com \n"), &bytes.Buffer{})
+	got, err := p.Input("Email", "default@acme.com")
+	if err != nil || got != "default@acme.com" {
+		t.Errorf("Input = %q, %v; want default", got, err)
+	}
+	got, err = p.Input("Email", "default@acme.com")
+	if err != nil || got != "bob@acme.com" {
+		t.Errorf("Input = %q, %v; want bob@acme.com", got, err)
+	}
+}
+
+func TestSSHKeys(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"id_ed25519", "id_ed25519.pub", "id_work", "id_work.pub", "orphan.pub", "config", "known_hosts"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatalf("cannot write %s: %v", name, err)
+		}
+	}
+
+	keys, err := SSHKeys(dir)
+	if err != nil {
+		t.Fatalf("SSHKeys failed: %v", err)
+	}
+	want := []string{filepath.Join(dir, "id_ed25519"), filepath.Join(dir, "id_work")}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("SSHKeys = %v, want %v", keys, want)
+	}
+}